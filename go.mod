@@ -12,6 +12,8 @@ replace pkg/humanize => ./pkg/humanize
 
 replace pkg/nrpe => ./pkg/nrpe
 
+replace pkg/nsca => ./pkg/nsca
+
 replace pkg/snclient => ./pkg/snclient
 
 replace pkg/snclient/cmd => ./pkg/snclient/cmd
@@ -24,6 +26,8 @@ replace pkg/check_dns => ./pkg/check_dns
 
 replace pkg/check_tcp => ./pkg/check_tcp
 
+replace pkg/check_nrpe => ./pkg/check_nrpe
+
 // use fork with pulled patches
 replace github.com/shirou/gopsutil/v3 => github.com/sni/gopsutil/v3 v3.0.0-20240129124248-a5f3e5722a21
 
@@ -92,11 +96,13 @@ require (
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	pkg/check_dns v0.0.0-00010101000000-000000000000 // indirect
+	pkg/check_nrpe v0.0.0-00010101000000-000000000000 // indirect
 	pkg/check_tcp v0.0.0-00010101000000-000000000000 // indirect
 	pkg/convert v0.0.0-00010101000000-000000000000 // indirect
 	pkg/eventlog v0.0.0-00010101000000-000000000000 // indirect
 	pkg/humanize v0.0.0-00010101000000-000000000000 // indirect
 	pkg/nrpe v0.0.0-00010101000000-000000000000 // indirect
+	pkg/nsca v0.0.0-00010101000000-000000000000 // indirect
 	pkg/snclient v0.0.0-00010101000000-000000000000 // indirect
 	pkg/wmi v0.0.0-00010101000000-000000000000 // indirect
 )
@@ -0,0 +1,231 @@
+package check_nrpe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/nrpe"
+
+	"github.com/jessevdk/go-flags"
+)
+
+const (
+	stateOK       = 0
+	stateCritical = 2
+	stateUnknown  = 3
+)
+
+var stateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// errRetry marks errors which might be solved by using a lower protocol version
+var errRetry = errors.New("retry with lower protocol version")
+
+type nrpeOpts struct {
+	Host       string   `short:"H" long:"host" required:"true" description:"The address of the host running the NRPE daemon"`
+	Port       int      `short:"p" long:"port" default:"5666" description:"The port on which the daemon is running"`
+	Command    string   `short:"c" long:"command" default:"_NRPE_CHECK" description:"The name of the command that the remote daemon should run"`
+	Args       []string `short:"a" long:"args" description:"Optional arguments that should be passed to the command, all remaining arguments are appended as well"`
+	Timeout    int      `short:"t" long:"timeout" default:"10" description:"Number of seconds before connection times out"`
+	Unknown    bool     `short:"u" long:"unknown-timeout" description:"Make connection problems and timeouts return UNKNOWN instead of CRITICAL"`
+	NoSSL      bool     `short:"n" long:"no-ssl" description:"Do not use SSL"`
+	V2Only     bool     `short:"2" long:"v2-packets-only" description:"Only use version 2 packets, do not try version 4 first"`
+	CACert     string   `short:"A" long:"ca-cert-file" description:"CA certificate file to verify the server certificate, server certificate is not verified unless set"`
+	ClientCert string   `short:"C" long:"client-cert" description:"Client certificate file to use (PEM format)"`
+	ClientKey  string   `short:"K" long:"key-file" description:"Client certificate key file to use (PEM format)"`
+}
+
+// Check queries a remote nrpe daemon and writes the plugin output to output.
+// It returns the state of the remote check.
+func Check(ctx context.Context, output io.Writer, args []string) int {
+	opts, err := parseArgs(args)
+	if err != nil {
+		fmt.Fprintf(output, "%s", err.Error())
+
+		return stateUnknown
+	}
+
+	state, out := opts.run(ctx)
+	fmt.Fprintf(output, "%s", out)
+
+	return state
+}
+
+func parseArgs(args []string) (*nrpeOpts, error) {
+	opts := &nrpeOpts{}
+	parser := flags.NewParser(opts, flags.HelpFlag|flags.PassDoubleDash)
+	parser.Name = "check_nrpe"
+	remaining, err := parser.ParseArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s", err.Error())
+	}
+
+	// like the original check_nrpe, -a consumes all remaining arguments
+	opts.Args = append(opts.Args, remaining...)
+
+	return opts, nil
+}
+
+func (opts *nrpeOpts) run(ctx context.Context) (state int, output string) {
+	versions := []uint16{nrpe.NrpeV4PacketVersion, nrpe.NrpeV2PacketVersion}
+	if opts.V2Only {
+		versions = []uint16{nrpe.NrpeV2PacketVersion}
+	}
+
+	var err error
+	for _, version := range versions {
+		state, output, err = opts.query(ctx, version)
+		if err == nil {
+			return state, output
+		}
+		if !errors.Is(err, errRetry) {
+			break
+		}
+	}
+
+	return opts.errorResult(err)
+}
+
+// errorResult converts connection errors into a plugin result.
+func (opts *nrpeOpts) errorResult(err error) (state int, output string) {
+	state = stateCritical
+	if opts.Unknown {
+		state = stateUnknown
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return state, fmt.Sprintf("CHECK_NRPE STATE %s: Socket timeout after %d seconds.", stateNames[state], opts.Timeout)
+	}
+
+	return state, fmt.Sprintf("CHECK_NRPE STATE %s: %s", stateNames[state], err.Error())
+}
+
+// query sends a single request with given protocol version.
+func (opts *nrpeOpts) query(ctx context.Context, version uint16) (state int, output string, err error) {
+	timeout := time.Duration(opts.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := opts.connect(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return 0, "", fmt.Errorf("set deadline: %w", err)
+	}
+
+	query := opts.Command
+	if len(opts.Args) > 0 {
+		query += "!" + strings.Join(opts.Args, "!")
+	}
+
+	request := nrpe.BuildPacket(version, nrpe.NrpeQueryPacket, 0, []byte(query))
+	if err = request.Write(conn); err != nil {
+		return 0, "", err
+	}
+
+	response, err := nrpe.ReadNrpePacket(conn)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return 0, "", err
+		}
+		// older daemons simply close the connection when receiving unsupported packets
+		if version != nrpe.NrpeV2PacketVersion {
+			return 0, "", fmt.Errorf("%w: %w", errRetry, err)
+		}
+
+		return 0, "", fmt.Errorf("failed to read response from %s: %w", opts.address(), err)
+	}
+
+	if err = response.Verify(nrpe.NrpeResponsePacket); err != nil {
+		if version != nrpe.NrpeV2PacketVersion {
+			return 0, "", fmt.Errorf("%w: %w", errRetry, err)
+		}
+
+		return 0, "", fmt.Errorf("invalid response from %s: %w", opts.address(), err)
+	}
+
+	output, _ = response.Data()
+	state = int(response.StatusCode())
+	if state < stateOK || state > stateUnknown {
+		state = stateUnknown
+	}
+
+	return state, output, nil
+}
+
+func (opts *nrpeOpts) address() string {
+	return net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+}
+
+func (opts *nrpeOpts) connect(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if opts.NoSSL {
+		conn, err := dialer.DialContext(ctx, "tcp", opts.address())
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to %s: %w", opts.address(), err)
+		}
+
+		return conn, nil
+	}
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+	conn, err := tlsDialer.DialContext(ctx, "tcp", opts.address())
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", opts.address(), err)
+	}
+
+	return conn, nil
+}
+
+func (opts *nrpeOpts) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: opts.Host,
+		// nrpe daemons usually use self signed certificates, so verification only happens with a ca file
+		InsecureSkipVerify: opts.CACert == "", //nolint:gosec // same behavior as the original check_nrpe
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if opts.CACert != "" {
+		caPEM, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca cert file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in ca cert file %s", opts.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case opts.ClientCert != "" && opts.ClientKey != "":
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case opts.ClientCert != "" || opts.ClientKey != "":
+		return nil, fmt.Errorf("client certificate requires both, --client-cert and --key-file")
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,147 @@
+package check_nrpe
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/nrpe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestServer starts a fake nrpe daemon which answers every query with a warning.
+// Queries with packet versions other than maxVersion are dropped.
+func startTestServer(t *testing.T, tlsConfig *tls.Config, maxVersion uint16) (port string) {
+	t.Helper()
+
+	var listener net.Listener
+	var err error
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoErrorf(t, err, "listener started")
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				request, err := nrpe.ReadNrpePacket(conn)
+				if err != nil {
+					return
+				}
+				if request.Version() > maxVersion {
+					return
+				}
+				cmd, args := request.Data()
+				output := fmt.Sprintf("WARNING - v%d %s %s", request.Version(), cmd, strings.Join(args, ","))
+				response := nrpe.BuildPacket(request.Version(), nrpe.NrpeResponsePacket, 1, []byte(output))
+				_ = response.Write(conn)
+			}(conn)
+		}
+	}()
+
+	_, port, err = net.SplitHostPort(listener.Addr().String())
+	require.NoErrorf(t, err, "got listener port")
+
+	return port
+}
+
+func testCheck(args ...string) (int, string) {
+	output := new(bytes.Buffer)
+	rc := Check(context.Background(), output, args)
+
+	return rc, output.String()
+}
+
+func TestCheckNRPEPlain(t *testing.T) {
+	port := startTestServer(t, nil, nrpe.NrpeV4PacketVersion)
+
+	rc, output := testCheck("-H", "127.0.0.1", "-p", port, "-n", "-c", "check_test", "-a", "1", "2")
+	assert.Equalf(t, 1, rc, "state warning")
+	assert.Equalf(t, "WARNING - v4 check_test 1,2", output, "output")
+
+	rc, output = testCheck("-H", "127.0.0.1", "-p", port, "-n", "-2")
+	assert.Equalf(t, 1, rc, "state warning")
+	assert.Equalf(t, "WARNING - v2 _NRPE_CHECK ", output, "output")
+}
+
+func TestCheckNRPEFallback(t *testing.T) {
+	port := startTestServer(t, nil, nrpe.NrpeV2PacketVersion)
+
+	rc, output := testCheck("-H", "127.0.0.1", "-p", port, "-n", "-c", "check_test")
+	assert.Equalf(t, 1, rc, "state warning")
+	assert.Equalf(t, "WARNING - v2 check_test ", output, "fallback to v2")
+}
+
+func TestCheckNRPESSL(t *testing.T) {
+	port := startTestServer(t, testServerTLSConfig(t), nrpe.NrpeV4PacketVersion)
+
+	rc, output := testCheck("-H", "127.0.0.1", "-p", port, "-c", "check_ssl")
+	assert.Equalf(t, 1, rc, "state warning")
+	assert.Equalf(t, "WARNING - v4 check_ssl ", output, "output")
+
+	rc, output = testCheck("-H", "127.0.0.1", "-p", port, "-n", "-c", "check_ssl", "-t", "1")
+	assert.Equalf(t, 2, rc, "plain request to ssl daemon fails")
+	assert.Containsf(t, output, "CHECK_NRPE STATE CRITICAL", "output")
+}
+
+func TestCheckNRPEErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoErrorf(t, err, "listener started")
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	rc, output := testCheck("-H", "127.0.0.1", "-p", port, "-n")
+	assert.Equalf(t, 2, rc, "connection refused is critical")
+	assert.Containsf(t, output, "CHECK_NRPE STATE CRITICAL: could not connect", "output")
+
+	rc, output = testCheck("-H", "127.0.0.1", "-p", port, "-n", "-u")
+	assert.Equalf(t, 3, rc, "connection refused is unknown with -u")
+	assert.Containsf(t, output, "CHECK_NRPE STATE UNKNOWN: could not connect", "output")
+
+	rc, output = testCheck("-p", port)
+	assert.Equalf(t, 3, rc, "missing host is unknown")
+	assert.Containsf(t, output, "required flag", "output")
+}
+
+func testServerTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoErrorf(t, err, "key generated")
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoErrorf(t, err, "certificate created")
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
@@ -0,0 +1,18 @@
+module check_nrpe
+
+go 1.21
+
+replace pkg/nrpe => ../nrpe
+
+require (
+	github.com/jessevdk/go-flags v1.5.0
+	github.com/stretchr/testify v1.9.0
+	pkg/nrpe v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -148,10 +148,18 @@ func (p *Packet) Version() uint16 {
 	return binary.BigEndian.Uint16(p.packetVersion)
 }
 
+// StatusCode returns the status code from response packets.
+func (p *Packet) StatusCode() uint16 {
+	return binary.BigEndian.Uint16(p.statusCode)
+}
+
 // Data returns nrpe payload.
 func (p *Packet) Data() (cmd string, args []string) {
 	rpt := binary.BigEndian.Uint16(p.packetType)
 	pos := bytes.IndexByte(p.data, 0)
+	if pos == -1 {
+		pos = len(p.data)
+	}
 
 	if rpt == NrpeResponsePacket {
 		return string(p.data[:pos]), nil
@@ -167,12 +175,9 @@ func ReadNrpePacket(conn io.Reader) (*Packet, error) {
 	packet := NewNrpePacket()
 
 	// read first 1036 bytes, all packages have at least this size
-	n, err := conn.Read(packet.all)
+	_, err := io.ReadFull(conn, packet.all)
 	if err != nil {
-		return nil, fmt.Errorf("reading request failed: %s", err.Error())
-	}
-	if n != len(packet.all) {
-		return nil, fmt.Errorf("nrpe: error while reading")
+		return nil, fmt.Errorf("reading packet failed: %s", err.Error())
 	}
 
 	packet.parseSize()
@@ -74,6 +74,8 @@ func TestNRPEResponseV2(t *testing.T) {
 
 	require.NoErrorf(t, pkg.Verify(NrpeResponsePacket), "verify ok")
 
+	assert.Equalf(t, uint16(1), pkg.StatusCode(), "parsed status code")
+
 	data, args := pkg.Data()
 	assert.Equalf(t, "USERS WARNING - 8 users currently logged in |users=8;5;10;0", data, "parsed package data")
 	assert.Nil(t, args, "no args in response package")
@@ -0,0 +1,273 @@
+package nsca
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+/*
+ * nsca protocol v3 is explained here
+ * https://github.com/NagiosEnterprises/nsca/blob/master/include/common.h
+ *
+ * reference implementation is here:
+ * https://github.com/NagiosEnterprises/nsca/blob/master/src/send_nsca.c
+ *
+ * the server starts the conversation by sending an init packet with
+ * a 128 byte initialization vector and a timestamp. The client then sends
+ * one data packet per check result using the received timestamp.
+ */
+
+const (
+	NscaPacketVersion = 3
+
+	NscaIVLength         = 128
+	NscaInitPacketLength = NscaIVLength + 4
+
+	NscaMaxHostNameLength = 64
+	NscaMaxServiceLength  = 128
+
+	// NscaMaxOutputLength is the output size used by nsca >= 2.9
+	NscaMaxOutputLength = 4096
+	// NscaLegacyMaxOutputLength is the output size used by nsca < 2.9
+	NscaLegacyMaxOutputLength = 512
+
+	// header consists of version, padding, crc32, timestamp and return code
+	nscaHeaderLength = 2 + 2 + 4 + 4 + 2
+)
+
+// supported encryption methods, the numbers match the ones from nsca
+const (
+	EncryptionNone = 0
+	EncryptionXOR  = 1
+)
+
+// InitPacket stores the nsca server init packet.
+type InitPacket struct {
+	IV        []byte
+	Timestamp uint32
+}
+
+// Packet stores nsca data packet.
+type Packet struct {
+	packetVersion []byte
+	crc32         []byte
+	timestamp     []byte
+	returnCode    []byte
+	hostName      []byte
+	service       []byte
+	output        []byte
+	all           []byte
+}
+
+// ParseEncryption returns the encryption method for given name.
+func ParseEncryption(name string) (int, error) {
+	switch strings.ToLower(name) {
+	case "", "0", "none", "plain":
+		return EncryptionNone, nil
+	case "1", "xor":
+		return EncryptionXOR, nil
+	default:
+		return 0, fmt.Errorf("unsupported encryption method: %s (supported are: none, xor)", name)
+	}
+}
+
+// ReadInitPacket reads the init packet from the wire.
+func ReadInitPacket(conn io.Reader) (*InitPacket, error) {
+	buf := make([]byte, NscaInitPacketLength)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, fmt.Errorf("reading nsca init packet failed: %s", err.Error())
+	}
+
+	init := &InitPacket{
+		IV:        buf[0:NscaIVLength],
+		Timestamp: binary.BigEndian.Uint32(buf[NscaIVLength:]),
+	}
+
+	return init, nil
+}
+
+// Write sends the init packet to given connection (used by tests and servers).
+func (i *InitPacket) Write(conn io.Writer) error {
+	buf := make([]byte, NscaInitPacketLength)
+	copy(buf, i.IV)
+	binary.BigEndian.PutUint32(buf[NscaIVLength:], i.Timestamp)
+
+	_, err := conn.Write(buf)
+	if err != nil {
+		return fmt.Errorf("nsca write init packet failed: %s", err.Error())
+	}
+
+	return nil
+}
+
+// NewPacket returns a new empty packet with given output size.
+func NewPacket(maxOutput int) *Packet {
+	if maxOutput <= 0 {
+		maxOutput = NscaMaxOutputLength
+	}
+
+	// data packet has 2 bytes trailing padding
+	packet := &Packet{
+		all: make([]byte, nscaHeaderLength+NscaMaxHostNameLength+NscaMaxServiceLength+maxOutput+2),
+	}
+	packet.parseSize(maxOutput)
+
+	return packet
+}
+
+// BuildPacket creates new data packet structure.
+func BuildPacket(timestamp uint32, returnCode uint16, hostName, service, output string, maxOutput int) *Packet {
+	packet := NewPacket(maxOutput)
+
+	binary.BigEndian.PutUint16(packet.packetVersion, NscaPacketVersion)
+	binary.BigEndian.PutUint32(packet.crc32, 0)
+	binary.BigEndian.PutUint32(packet.timestamp, timestamp)
+	binary.BigEndian.PutUint16(packet.returnCode, returnCode)
+
+	copyString(packet.hostName, hostName)
+	copyString(packet.service, service)
+	copyString(packet.output, output)
+
+	binary.BigEndian.PutUint32(packet.crc32, packet.BuildCRC32())
+
+	return packet
+}
+
+// ReadPacket reads an (already decrypted) data packet with given output size.
+func ReadPacket(conn io.Reader, maxOutput int) (*Packet, error) {
+	packet := NewPacket(maxOutput)
+	if _, err := io.ReadFull(conn, packet.all); err != nil {
+		return nil, fmt.Errorf("reading nsca packet failed: %s", err.Error())
+	}
+
+	return packet, nil
+}
+
+func (p *Packet) parseSize(maxOutput int) {
+	p.packetVersion = p.all[0:2]
+	// 2 bytes padding
+	p.crc32 = p.all[4:8]
+	p.timestamp = p.all[8:12]
+	p.returnCode = p.all[12:14]
+
+	pos := nscaHeaderLength
+	p.hostName = p.all[pos : pos+NscaMaxHostNameLength]
+	pos += NscaMaxHostNameLength
+	p.service = p.all[pos : pos+NscaMaxServiceLength]
+	pos += NscaMaxServiceLength
+	p.output = p.all[pos : pos+maxOutput]
+}
+
+// copyString copies the string into the fixed size buffer and keeps space for the null byte.
+func copyString(target []byte, val string) {
+	length := len(val)
+	if length >= len(target) {
+		length = len(target) - 1
+	}
+	copy(target, val[:length])
+	target[length] = 0
+}
+
+func readString(data []byte) string {
+	for i, b := range data {
+		if b == 0 {
+			return string(data[:i])
+		}
+	}
+
+	return string(data)
+}
+
+// Version returns nsca pkg version.
+func (p *Packet) Version() uint16 {
+	return binary.BigEndian.Uint16(p.packetVersion)
+}
+
+// ReturnCode returns the state of the result.
+func (p *Packet) ReturnCode() uint16 {
+	return binary.BigEndian.Uint16(p.returnCode)
+}
+
+// Timestamp returns the timestamp of this packet.
+func (p *Packet) Timestamp() uint32 {
+	return binary.BigEndian.Uint32(p.timestamp)
+}
+
+// Data returns the host name, service description and plugin output.
+func (p *Packet) Data() (hostName, service, output string) {
+	return readString(p.hostName), readString(p.service), readString(p.output)
+}
+
+// Bytes returns raw packet.
+func (p *Packet) Bytes() []byte {
+	return p.all
+}
+
+// Encrypt encrypts the packet with given method, iv and password.
+// Since xor is symmetric, calling Encrypt again decrypts the packet.
+func (p *Packet) Encrypt(method int, iv, password []byte) error {
+	switch method {
+	case EncryptionNone:
+		return nil
+	case EncryptionXOR:
+		if len(iv) > 0 {
+			for i := range p.all {
+				p.all[i] ^= iv[i%len(iv)]
+			}
+		}
+		if len(password) > 0 {
+			for i := range p.all {
+				p.all[i] ^= password[i%len(password)]
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported encryption method: %d", method)
+	}
+}
+
+// Write sends the packet content to given connection.
+func (p *Packet) Write(conn io.Writer) error {
+	n, err := conn.Write(p.all)
+	if err != nil {
+		return fmt.Errorf("nsca write packet failed: %s", err.Error())
+	}
+
+	if n != len(p.all) {
+		return fmt.Errorf("nsca: incomplete packet")
+	}
+
+	return nil
+}
+
+// BuildCRC32 returns the crc32 checksum.
+func (p *Packet) BuildCRC32() uint32 {
+	// checksum is build over the hole package but with the crc bytes nulled
+	savedCheckSum := binary.BigEndian.Uint32(p.crc32)
+	binary.BigEndian.PutUint32(p.crc32, 0)
+
+	checkSum := crc32.Checksum(p.all, crc32.IEEETable)
+
+	// restore original value
+	binary.BigEndian.PutUint32(p.crc32, savedCheckSum)
+
+	return checkSum
+}
+
+// Verify checks version and the crc32 checksum.
+func (p *Packet) Verify() error {
+	if p.Version() != NscaPacketVersion {
+		return fmt.Errorf("nsca: packet version mismatch %d != %d", p.Version(), NscaPacketVersion)
+	}
+
+	crc := binary.BigEndian.Uint32(p.crc32)
+	if crc != p.BuildCRC32() {
+		return fmt.Errorf("nsca: packet checksum failed: %v != %v", crc, p.BuildCRC32())
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package nsca
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNSCAPacket(t *testing.T) {
+	packet := BuildPacket(1700000000, 2, "localhost", "disk /", "CRITICAL - disk full|'/'=99%", NscaLegacyMaxOutputLength)
+	assert.Lenf(t, packet.Bytes(), 720, "legacy packet size")
+
+	require.NoErrorf(t, packet.Verify(), "verify ok")
+	assert.Equalf(t, uint16(3), packet.Version(), "packet version")
+	assert.Equalf(t, uint16(2), packet.ReturnCode(), "return code")
+	assert.Equalf(t, uint32(1700000000), packet.Timestamp(), "timestamp")
+
+	host, service, output := packet.Data()
+	assert.Equalf(t, "localhost", host, "host name")
+	assert.Equalf(t, "disk /", service, "service description")
+	assert.Equalf(t, "CRITICAL - disk full|'/'=99%", output, "plugin output")
+
+	packet = BuildPacket(1700000000, 0, "localhost", "", "OK", 0)
+	assert.Lenf(t, packet.Bytes(), 4304, "default packet size")
+}
+
+func TestNSCAPacketTruncate(t *testing.T) {
+	packet := BuildPacket(1, 0, "localhost", "svc", string(bytes.Repeat([]byte("x"), 1000)), NscaLegacyMaxOutputLength)
+	require.NoErrorf(t, packet.Verify(), "verify ok")
+
+	_, _, output := packet.Data()
+	assert.Lenf(t, output, NscaLegacyMaxOutputLength-1, "output got truncated")
+}
+
+func TestNSCAEncryptXOR(t *testing.T) {
+	initPacket := &InitPacket{IV: bytes.Repeat([]byte{0x17, 0x42}, NscaIVLength/2), Timestamp: 1234}
+	buf := new(bytes.Buffer)
+	require.NoErrorf(t, initPacket.Write(buf), "write init packet")
+
+	received, err := ReadInitPacket(buf)
+	require.NoErrorf(t, err, "read init packet")
+	assert.Equalf(t, initPacket.IV, received.IV, "iv")
+	assert.Equalf(t, uint32(1234), received.Timestamp, "timestamp")
+
+	packet := BuildPacket(received.Timestamp, 1, "host", "svc", "WARNING - test", 0)
+	require.NoErrorf(t, packet.Encrypt(EncryptionXOR, received.IV, []byte("secret")), "encrypt")
+	require.Errorf(t, packet.Verify(), "encrypted packet cannot be verified")
+
+	buf.Reset()
+	require.NoErrorf(t, packet.Write(buf), "write packet")
+
+	read, err := ReadPacket(buf, NscaMaxOutputLength)
+	require.NoErrorf(t, err, "read packet")
+	require.NoErrorf(t, read.Encrypt(EncryptionXOR, received.IV, []byte("secret")), "decrypt")
+	require.NoErrorf(t, read.Verify(), "verify ok")
+
+	host, service, output := read.Data()
+	assert.Equalf(t, "host", host, "host name")
+	assert.Equalf(t, "svc", service, "service description")
+	assert.Equalf(t, "WARNING - test", output, "plugin output")
+}
+
+func TestNSCAParseEncryption(t *testing.T) {
+	for name, exp := range map[string]int{"none": EncryptionNone, "": EncryptionNone, "XOR": EncryptionXOR, "1": EncryptionXOR} {
+		method, err := ParseEncryption(name)
+		require.NoErrorf(t, err, "parse %s", name)
+		assert.Equalf(t, exp, method, "parse %s", name)
+	}
+
+	_, err := ParseEncryption("aes")
+	require.Errorf(t, err, "aes is not supported")
+}
@@ -0,0 +1,233 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultScopeURLs contains the check endpoints which are allowed if a scope has no allowed urls set
+	DefaultScopeURLs = "/query/*, /api/v1/queries/*"
+
+	// adminURLPrefix is the prefix of all admin urls, they must be allowed explicitly
+	adminURLPrefix = "/api/v1/admin/"
+)
+
+// AccessScope restricts the urls and commands available to an authenticated client.
+type AccessScope struct {
+	kind             string // type of identity, ex.: api token or client identity
+	name             string
+	allowedURLs      []*regexp.Regexp
+	allowedAdminURLs []*regexp.Regexp // admin urls are only allowed by patterns starting with the admin url prefix
+	allowedCommands  []*regexp.Regexp
+	allowArguments   bool
+	allowedHosts     *AllowedHostConfig
+}
+
+// requestAuth contains the source and authentication result of a request.
+type requestAuth struct {
+	scope      *AccessScope
+	identity   string
+	listener   string
+	remoteAddr string
+}
+
+type requestAuthContextKey struct{}
+
+// NewAccessScope parses the scope options from given config section.
+func NewAccessScope(kind, name string, conf *ConfigSection) (*AccessScope, error) {
+	scope := &AccessScope{
+		kind: kind,
+		name: name,
+	}
+
+	urls, ok := conf.GetString("allowed urls")
+	if !ok {
+		urls = DefaultScopeURLs
+	}
+	adminURLs := []string{}
+	for _, pattern := range strings.Split(urls, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if strings.HasPrefix(pattern, adminURLPrefix) {
+			adminURLs = append(adminURLs, pattern)
+		}
+	}
+	scope.allowedURLs = wildcardPatterns(urls)
+	scope.allowedAdminURLs = wildcardPatterns(strings.Join(adminURLs, ","))
+
+	commands, ok := conf.GetString("allowed commands")
+	if !ok {
+		commands = "*"
+	}
+	scope.allowedCommands = wildcardPatterns(commands)
+
+	allowArgs, ok, err := conf.GetBool("allow arguments")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("allow arguments: %s", err.Error())
+	case ok:
+		scope.allowArguments = allowArgs
+	}
+
+	allowedHosts, err := NewAllowedHostConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	scope.allowedHosts = allowedHosts
+
+	return scope, nil
+}
+
+// String returns the kind and name of the scope.
+func (s *AccessScope) String() string {
+	return s.kind + " " + s.name
+}
+
+// AllowRequest returns true if the scope allows the url from the remote address of given request.
+func (s *AccessScope) AllowRequest(req *http.Request) bool {
+	if !s.allowedHosts.Check(req.RemoteAddr) {
+		log.Warnf("%s: ip %s is not in the allowed hosts", s.String(), req.RemoteAddr)
+
+		return false
+	}
+
+	allowedURLs := s.allowedURLs
+	if strings.HasPrefix(path.Clean(req.URL.Path), strings.TrimSuffix(adminURLPrefix, "/")) {
+		allowedURLs = s.allowedAdminURLs
+	}
+	if !wildcardMatch(allowedURLs, req.URL.Path) {
+		log.Warnf("%s: url %s is not allowed", s.String(), req.URL.Path)
+
+		return false
+	}
+
+	return true
+}
+
+// AllowConnection returns true if the scope allows to run given command with given arguments from the remote address
+// of a tcp connection, ex.: nrpe. Allowed urls do not apply here.
+func (s *AccessScope) AllowConnection(remoteAddr, command string, args []string) bool {
+	if !s.allowedHosts.Check(remoteAddr) {
+		log.Warnf("%s: ip %s is not in the allowed hosts", s.String(), remoteAddr)
+
+		return false
+	}
+
+	return s.AllowCommand(command, args)
+}
+
+// AllowCommand returns true if the scope allows to run given command with given arguments.
+func (s *AccessScope) AllowCommand(command string, args []string) bool {
+	if !wildcardMatch(s.allowedCommands, command) {
+		log.Warnf("%s: command %s is not allowed", s.String(), command)
+
+		return false
+	}
+
+	if !s.allowArguments && len(args) > 0 {
+		log.Warnf("%s: arguments are not allowed", s.String())
+
+		return false
+	}
+
+	return true
+}
+
+// withRequestAuth returns the authentication info of the request and attaches a new one if there is none yet.
+func withRequestAuth(req *http.Request) (*http.Request, *requestAuth) {
+	if auth, ok := req.Context().Value(requestAuthContextKey{}).(*requestAuth); ok {
+		return req, auth
+	}
+
+	auth := &requestAuth{}
+
+	return req.WithContext(context.WithValue(req.Context(), requestAuthContextKey{}, auth)), auth
+}
+
+// requestAccessScope returns the access scope used to authenticate the request or nil.
+func requestAccessScope(req *http.Request) *AccessScope {
+	if auth, ok := req.Context().Value(requestAuthContextKey{}).(*requestAuth); ok {
+		return auth.scope
+	}
+
+	return nil
+}
+
+// WithRequestSource returns a context which contains the source of a request, ex.: for the audit log.
+func WithRequestSource(ctx context.Context, listener, remoteAddr, identity string) context.Context {
+	return context.WithValue(ctx, requestAuthContextKey{}, &requestAuth{
+		listener:   listener,
+		remoteAddr: remoteAddr,
+		identity:   identity,
+	})
+}
+
+// RequestSource returns the listener type, remote address and identity of the request which started given context.
+func RequestSource(ctx context.Context) (listener, remoteAddr, identity string) {
+	if auth, ok := ctx.Value(requestAuthContextKey{}).(*requestAuth); ok {
+		return auth.listener, auth.remoteAddr, auth.identity
+	}
+
+	return "", "", ""
+}
+
+// RequestIdentity returns the name of the client identity or api token of the request which started
+// given context or an empty string.
+func RequestIdentity(ctx context.Context) string {
+	if auth, ok := ctx.Value(requestAuthContextKey{}).(*requestAuth); ok {
+		return auth.identity
+	}
+
+	return ""
+}
+
+// verifyRequestCommand returns true if the request may run given command. Requests without access scope are
+// restricted by the listener configuration only.
+func verifyRequestCommand(req *http.Request, command string, args []string) bool {
+	scope := requestAccessScope(req)
+	if scope == nil {
+		return true
+	}
+
+	return scope.AllowCommand(command, args)
+}
+
+// writePermissionDenied sends a 403 response.
+func writePermissionDenied(res http.ResponseWriter) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusForbidden)
+	LogError(json.NewEncoder(res).Encode(map[string]interface{}{
+		"error": "permission denied",
+	}))
+}
+
+// wildcardPatterns converts a comma separated list of wildcard patterns into regular expressions.
+func wildcardPatterns(list string) []*regexp.Regexp {
+	patterns := []*regexp.Regexp{}
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		patterns = append(patterns, regexp.MustCompile(expr))
+	}
+
+	return patterns
+}
+
+// wildcardMatch returns true if any pattern matches.
+func wildcardMatch(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
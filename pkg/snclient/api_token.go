@@ -0,0 +1,74 @@
+package snclient
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+)
+
+// APITokenSectionPrefix is the config section prefix for named api tokens.
+const APITokenSectionPrefix = "/settings/api tokens/"
+
+// APIToken is a named token which grants scoped access to the web listeners.
+type APIToken struct {
+	*AccessScope
+	token string // clear text or hashed token, ex.: SHA256:...
+}
+
+// NewAPITokens parses all api token sections from the config.
+func NewAPITokens(conf *Config) ([]*APIToken, error) {
+	sections := conf.SectionsByPrefix(APITokenSectionPrefix)
+	names := make([]string, 0, len(sections))
+	for sectionName := range sections {
+		names = append(names, sectionName)
+	}
+	sort.Strings(names)
+
+	tokens := []*APIToken{}
+	for _, sectionName := range names {
+		token, err := NewAPIToken(path.Base(sectionName), sections[sectionName])
+		if err != nil {
+			return nil, fmt.Errorf("api token %s: %s", path.Base(sectionName), err.Error())
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// NewAPIToken creates a token from given config section.
+func NewAPIToken(name string, conf *ConfigSection) (*APIToken, error) {
+	secret, _ := conf.GetString("token")
+	switch secret {
+	case "":
+		return nil, fmt.Errorf("missing token")
+	case DefaultPassword:
+		return nil, fmt.Errorf("token must be changed from default value")
+	}
+
+	scope, err := NewAccessScope("api token", name, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIToken{AccessScope: scope, token: secret}, nil
+}
+
+// verifyRequestToken returns the api token matching the password of given request or nil.
+func (snc *Agent) verifyRequestToken(req *http.Request) *APIToken {
+	password := requestPassword(req)
+	if password == "" {
+		return nil
+	}
+
+	for _, token := range snc.apiTokens {
+		if snc.verifyPassword(token.token, password) {
+			log.Debugf("request authenticated by api token %s", token.name)
+
+			return token
+		}
+	}
+
+	return nil
+}
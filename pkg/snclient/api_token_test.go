@@ -0,0 +1,130 @@
+package snclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pkg/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	hashed, err := utils.Sha256Sum("dashboard-secret")
+	require.NoError(t, err)
+
+	config := `
+[/modules]
+WEBServer = enabled
+
+[/settings/WEB/server]
+port = 0
+use ssl = false
+password = listener-secret
+
+[/settings/api tokens/dashboard]
+token = SHA256:` + hashed + `
+allowed urls = /api/v1/queries/*
+allowed commands = check_dummy, check_uptime
+allow arguments = false
+
+[/settings/api tokens/automation]
+token = automation-secret
+allowed hosts = 192.168.123.0/24
+
+[/settings/api tokens/monitoring]
+token = monitoring-secret
+`
+	snc := StartTestAgent(t, config)
+
+	var baseURL string
+	for _, module := range snc.Listeners.Modules() {
+		if handler, ok := module.(RequestHandler); ok && handler.Listener() != nil {
+			baseURL = "http://" + handler.Listener().listen.Addr().String()
+		}
+	}
+	require.NotEmptyf(t, baseURL, "found listener address")
+
+	for _, check := range []struct {
+		url      string
+		password string
+		bearer   bool
+		status   int
+	}{
+		{"/api/v1/queries/check_dummy/commands/execute", "listener-secret", false, http.StatusOK},
+		{"/api/v1/queries/check_dummy/commands/execute", "wrong", false, http.StatusForbidden},
+		{"/api/v1/queries/check_dummy/commands/execute", "dashboard-secret", false, http.StatusOK},
+		{"/api/v1/queries/check_dummy/commands/execute", "dashboard-secret", true, http.StatusOK},
+		{"/api/v1/queries/check_dummy/commands/execute?0", "dashboard-secret", false, http.StatusForbidden},
+		{"/api/v1/queries/check_dummy/commands/execute?output_format=json", "dashboard-secret", false, http.StatusOK},
+		{"/api/v1/queries/check_dummy/commands/execute?format=json", "dashboard-secret", false, http.StatusForbidden},
+		{"/api/v1/queries/check_memory/commands/execute", "dashboard-secret", false, http.StatusForbidden},
+		{"/query/check_dummy", "dashboard-secret", false, http.StatusForbidden},
+		{"/query/check_dummy", "listener-secret", false, http.StatusOK},
+		{"/query/check_dummy", "automation-secret", false, http.StatusForbidden},
+		{"/query/check_dummy", "monitoring-secret", false, http.StatusOK},
+		{"/query/check_dummy?0", "monitoring-secret", false, http.StatusForbidden},
+		{"/api/v1/inventory", "monitoring-secret", false, http.StatusForbidden},
+	} {
+		req, err := http.NewRequest(http.MethodGet, baseURL+check.url, http.NoBody)
+		require.NoError(t, err)
+		if check.bearer {
+			req.Header.Set("Authorization", "Bearer "+check.password)
+		} else {
+			req.SetBasicAuth("user", check.password)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equalf(t, check.status, res.StatusCode, "status code for %s with password %s", check.url, check.password)
+	}
+
+	StopTestAgent(t, snc)
+}
+
+func TestAPITokenConfig(t *testing.T) {
+	conf := NewConfig(false)
+	conf.Section("/settings/api tokens/default").Set("token", DefaultPassword)
+	_, err := NewAPITokens(conf)
+	require.Errorf(t, err, "default token is not allowed")
+
+	conf = NewConfig(false)
+	section := conf.Section("/settings/api tokens/read")
+	section.Set("token", "secret")
+	section.Set("allowed commands", "check_*")
+	tokens, err := NewAPITokens(conf)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+
+	assert.Truef(t, tokens[0].AllowCommand("check_cpu", nil), "command matches")
+	assert.Falsef(t, tokens[0].AllowCommand("check_cpu", []string{"warn=load > 90"}), "arguments are not allowed by default")
+	assert.Falsef(t, tokens[0].AllowCommand("alias_cpu", nil), "command does not match")
+
+	for _, check := range []struct {
+		urls    string
+		path    string
+		allowed bool
+	}{
+		{"", "/api/v1/queries/check_cpu/commands/execute", true},
+		{"", "/query/check_cpu", true},
+		{"", "/api/v1/inventory", false},
+		{"", "/api/v1/admin/reload", false},
+		{"*", "/api/v1/inventory", true},
+		{"*", "/api/v1/admin/reload", false},
+		{"/api/v1/*", "/api/v1/admin/reload", false},
+		{"*, /api/v1/admin/*", "/api/v1/admin/reload", true},
+		{"/api/v1/admin/reload", "/api/v1/admin/reload", true},
+		{"/api/v1/admin/reload", "/api/v1/admin/certs/replace", false},
+	} {
+		section := NewConfigSection(conf, "/settings/api tokens/scope")
+		if check.urls != "" {
+			section.Set("allowed urls", check.urls)
+		}
+		scope, err := NewAccessScope("api token", "scope", section)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, check.path, http.NoBody)
+		assert.Equalf(t, check.allowed, scope.AllowRequest(req), "allowed urls %q for %s", check.urls, check.path)
+	}
+}
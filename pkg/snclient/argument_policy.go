@@ -0,0 +1,167 @@
+package snclient
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// argumentPolicyExpressionKeys contains the arguments which are parsed as filter and threshold expressions.
+var argumentPolicyExpressionKeys = []string{"filter", "ok", "warn", "warning", "crit", "critical"}
+
+// ArgumentPolicy restricts the arguments of an external script or alias. Values which match an explicit
+// value regex skip the nasty characters check, all other values still have to pass it.
+//
+// Arguments are identified by their key (the part before the =), arguments without key are
+// identified by their position, ex.: arg1, arg2, ...
+type ArgumentPolicy struct {
+	name              string
+	allowedKeys       []*regexp.Regexp
+	values            map[string]*regexp.Regexp // anchored value patterns by argument key
+	maxLength         int64
+	allowExpressions  bool
+	allowedKeysString string
+}
+
+// argumentPolicyHandler is implemented by checks which support an argument policy.
+type argumentPolicyHandler interface {
+	ArgumentPolicy() *ArgumentPolicy
+}
+
+// NewArgumentPolicy parses the argument policy from given config section. The policy is enabled by
+// setting the allowed arguments option.
+func NewArgumentPolicy(name string, conf *ConfigSection) (*ArgumentPolicy, error) {
+	allowed, ok := conf.GetString("allowed arguments")
+	if !ok {
+		return nil, fmt.Errorf("%s: no argument policy configured", name)
+	}
+
+	policy := &ArgumentPolicy{
+		name:              name,
+		allowedKeys:       wildcardPatterns(allowed),
+		values:            make(map[string]*regexp.Regexp),
+		allowExpressions:  true,
+		allowedKeysString: allowed,
+	}
+
+	maxLength, ok, err := conf.GetInt("max argument length")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s: max argument length: %s", name, err.Error())
+	case ok:
+		policy.maxLength = maxLength
+	}
+
+	allowExpressions, ok, err := conf.GetBool("allow filter expressions")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s: allow filter expressions: %s", name, err.Error())
+	case ok:
+		policy.allowExpressions = allowExpressions
+	}
+
+	for key, val := range conf.data {
+		argKey, found := strings.CutPrefix(key, "argument ")
+		if !found {
+			continue
+		}
+		argKey = strings.TrimSpace(argKey)
+		pattern, err := regexp.Compile("^(?:" + val + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: invalid regular expression: %s", name, key, err.Error())
+		}
+		policy.values[argKey] = pattern
+	}
+
+	return policy, nil
+}
+
+// commandArgumentPolicy returns the argument policy of given command or nil if it has none.
+func commandArgumentPolicy(command string) *ArgumentPolicy {
+	check, ok := AvailableChecks[command]
+	if !ok {
+		return nil
+	}
+
+	if handler, ok := check.Handler().(argumentPolicyHandler); ok {
+		return handler.ArgumentPolicy()
+	}
+
+	return nil
+}
+
+// hasArgumentPolicy returns true if given config section contains an argument policy.
+func hasArgumentPolicy(conf *ConfigSection) bool {
+	return conf.HasKey("allowed arguments")
+}
+
+// Verify returns an error describing the first argument which violates the policy.
+func (p *ArgumentPolicy) Verify(args []string) error {
+	for idx, arg := range args {
+		key, value := argumentPolicyKey(idx, arg)
+
+		if p.maxLength > 0 && int64(len(value)) > p.maxLength {
+			return fmt.Errorf("argument %s: value exceeds max argument length of %d characters", key, p.maxLength)
+		}
+
+		if !p.allowExpressions && p.isExpressionKey(key) {
+			return fmt.Errorf("argument %s: filter expressions are not allowed", key)
+		}
+
+		if !wildcardMatch(p.allowedKeys, key) {
+			return fmt.Errorf("argument %s is not allowed, allowed arguments: %s", key, p.allowedKeysString)
+		}
+
+		if pattern, ok := p.values[key]; ok && !pattern.MatchString(value) {
+			return fmt.Errorf("argument %s: value does not match %s", key, pattern.String())
+		}
+	}
+
+	return nil
+}
+
+// UncheckedArgs returns the arguments which have no explicit value regex and therefore still have to pass
+// the nasty characters check. All arguments are returned if there is no policy.
+func (p *ArgumentPolicy) UncheckedArgs(args []string) []string {
+	if p == nil {
+		return args
+	}
+
+	unchecked := []string{}
+	for idx, arg := range args {
+		key, _ := argumentPolicyKey(idx, arg)
+		if _, ok := p.values[key]; !ok {
+			unchecked = append(unchecked, arg)
+		}
+	}
+
+	return unchecked
+}
+
+// Result returns the UNKNOWN result for requests which violate the policy.
+func (p *ArgumentPolicy) Result(err error) *CheckResult {
+	return &CheckResult{
+		State:  CheckExitUnknown,
+		Output: fmt.Sprintf("Exception processing request: Request contained invalid arguments: %s (check the argument policy of %s).", err.Error(), p.name),
+	}
+}
+
+func (p *ArgumentPolicy) isExpressionKey(key string) bool {
+	for _, exprKey := range argumentPolicyExpressionKeys {
+		if strings.EqualFold(key, exprKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// argumentPolicyKey returns the key and value of given argument, arguments without key are named by their position.
+func argumentPolicyKey(idx int, arg string) (key, value string) {
+	key, value, hasKey := strings.Cut(arg, "=")
+	if !hasKey {
+		return fmt.Sprintf("arg%d", idx+1), arg
+	}
+
+	return strings.Trim(key, `"'`), value
+}
@@ -0,0 +1,70 @@
+package snclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgumentPolicy(t *testing.T) {
+	config := `
+[/modules]
+CheckExternalScripts = enabled
+
+[/settings/external scripts/alias/alias_dummy]
+command = check_dummy 0 $ARGS$
+allowed arguments = arg*, path, pattern
+argument path = /var/log/[a-z]+
+argument pattern = [a-z()|^$]+
+max argument length = 30
+allow filter expressions = no
+
+[/settings/external scripts/alias/alias_dummy_filter]
+command = check_dummy 0 $ARGS$
+allowed arguments = filter, warn, crit
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	// regular expressions do not trip over the nasty characters check
+	res := snc.RunCheck("alias_dummy", []string{"path=/var/log/syslog", "pattern=^(error|fail)$"})
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+
+	res = snc.RunCheck("alias_dummy", []string{"positional"})
+	assert.Equalf(t, CheckExitOK, res.State, "positional arguments are allowed by wildcard")
+
+	res = snc.RunCheck("alias_dummy", []string{"$(id)"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Containsf(t, res.Output, "Request contained illegal characters", "values without regex are checked for nasty characters")
+
+	res = snc.RunCheck("alias_dummy", []string{"path=/var/log/x;id"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Containsf(t, res.Output, "argument path: value does not match", "value regex is anchored")
+
+	res = snc.RunCheck("alias_dummy", []string{"timeout=1"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Equalf(t,
+		"Exception processing request: Request contained invalid arguments: argument timeout is not allowed, allowed arguments: arg*, path, pattern (check the argument policy of alias_dummy).",
+		res.Output, "unknown key rejected")
+
+	res = snc.RunCheck("alias_dummy", []string{"path=/etc/shadow"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Containsf(t, res.Output, "argument path: value does not match ^(?:/var/log/[a-z]+)$", "value regex is enforced")
+
+	res = snc.RunCheck("alias_dummy", []string{"path=/var/log/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Containsf(t, res.Output, "exceeds max argument length of 30 characters", "max length is enforced")
+
+	res = snc.RunCheck("alias_dummy", []string{"filter=none"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Containsf(t, res.Output, "argument filter: filter expressions are not allowed", "filter is rejected")
+
+	res = snc.RunCheck("alias_dummy_filter", []string{"filter=none"})
+	assert.Equalf(t, CheckExitOK, res.State, "filter expressions are allowed by default")
+
+	policy := commandArgumentPolicy("alias_dummy")
+	assert.NotNilf(t, policy, "alias has policy")
+	assert.Equalf(t, []string{"positional", "other=$x"}, policy.UncheckedArgs([]string{"positional", "path=/var/log/syslog", "other=$x"}),
+		"values with regex are not checked for nasty characters")
+	assert.Nilf(t, commandArgumentPolicy("check_dummy"), "builtin check has no policy")
+}
@@ -0,0 +1,283 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"pkg/utils"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// AuditSection is the config section of the audit log.
+	AuditSection = "/settings/audit"
+
+	// auditSyslogPriority is facility local0 with severity info
+	auditSyslogPriority = 16*8 + 6
+)
+
+var (
+	// reAuditPasswordArg matches key=value arguments with a password like key
+	reAuditPasswordArg = regexp.MustCompile(`(?i)^(\s*-*(?:password|passwd|pass|pwd|secret|token)\s*=\s*).+$`)
+
+	// reAuditPasswordFlag matches flags which are followed by a password, ex.: -p secret
+	reAuditPasswordFlag = regexp.MustCompile(`(?i)^(?:-p|--?(?:password|passwd|pass|pwd|secret|token))$`)
+)
+
+// AuditLog writes one json line per executed command to a file and/or an udp server.
+type AuditLog struct {
+	noCopy       noCopy
+	lock         deadlock.Mutex
+	fileName     string
+	file         *os.File
+	fileSize     int64
+	maxSize      int64
+	maxFiles     int64
+	outputLength int64
+	maskArgs     bool
+	udpConn      net.Conn
+	udpFormat    string
+	hostName     string
+	closed       bool
+}
+
+// AuditEntry is a single audit log entry.
+type AuditEntry struct {
+	Timestamp     string   `json:"timestamp"`
+	Listener      string   `json:"listener"`
+	RemoteAddress string   `json:"remote_address"`
+	Identity      string   `json:"identity"`
+	Command       string   `json:"command"`
+	Args          []string `json:"args"`
+	Duration      float64  `json:"duration"`
+	State         int64    `json:"state"`
+	Output        string   `json:"output"`
+}
+
+// NewAuditLog creates the audit log from given config section.
+func NewAuditLog(section *ConfigSection) (*AuditLog, error) {
+	audit := &AuditLog{
+		maxFiles:     5,
+		outputLength: 500,
+		maskArgs:     true,
+		udpFormat:    "syslog",
+	}
+	audit.fileName, _ = section.GetString("file name")
+
+	maxSize, _, err := section.GetBytes("max size")
+	if err != nil {
+		return nil, fmt.Errorf("max size: %s", err.Error())
+	}
+	audit.maxSize = int64(maxSize)
+
+	maxFiles, ok, err := section.GetInt("max files")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("max files: %s", err.Error())
+	case ok:
+		audit.maxFiles = maxFiles
+	}
+
+	outputLength, ok, err := section.GetInt("output length")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("output length: %s", err.Error())
+	case ok:
+		audit.outputLength = outputLength
+	}
+
+	maskArgs, ok, err := section.GetBool("mask positional arguments")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("mask positional arguments: %s", err.Error())
+	case ok:
+		audit.maskArgs = maskArgs
+	}
+
+	if format, ok := section.GetString("udp format"); ok && format != "" {
+		switch format {
+		case "syslog", "json":
+			audit.udpFormat = format
+		default:
+			return nil, fmt.Errorf("udp format: unknown format %s, must be syslog or json", format)
+		}
+	}
+
+	if server, ok := section.GetString("udp server"); ok && server != "" {
+		conn, err := net.Dial("udp", server)
+		if err != nil {
+			return nil, fmt.Errorf("udp server: %s", err.Error())
+		}
+		audit.udpConn = conn
+	}
+
+	if audit.fileName == "" && audit.udpConn == nil {
+		return nil, fmt.Errorf("either file name or udp server is required")
+	}
+
+	audit.hostName, err = os.Hostname()
+	if err != nil {
+		audit.hostName = "-"
+	}
+
+	return audit, nil
+}
+
+// auditMaskArgs returns the arguments with passwords replaced. Values of password like key=value arguments and
+// arguments following a password flag are always masked. Positional arguments, ex.: nrpe $ARGn$ values,
+// are masked as well if maskPositional is set, since there is no way to tell whether they contain a password.
+func auditMaskArgs(args []string, maskPositional bool) []string {
+	masked := make([]string, 0, len(args))
+	maskNext := false
+	for _, arg := range args {
+		switch {
+		case maskNext:
+			masked = append(masked, "...")
+		case strings.Contains(arg, "="):
+			masked = append(masked, reAuditPasswordArg.ReplaceAllString(arg, "${1}..."))
+		case strings.HasPrefix(arg, "-"):
+			masked = append(masked, arg)
+		case maskPositional:
+			masked = append(masked, "...")
+		default:
+			masked = append(masked, arg)
+		}
+		maskNext = reAuditPasswordFlag.MatchString(arg)
+	}
+
+	return masked
+}
+
+// Log adds an entry for the executed command, the source of the request is taken from the context.
+func (a *AuditLog) Log(ctx context.Context, command string, args []string, duration time.Duration, state int64, output string) {
+	if a == nil {
+		return
+	}
+
+	entry := &AuditEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Command:   command,
+		Args:      auditMaskArgs(args, a.maskArgs),
+		Duration:  utils.ToPrecision(duration.Seconds(), 3),
+		State:     state,
+		Output:    output,
+	}
+	entry.Listener, entry.RemoteAddress, entry.Identity = RequestSource(ctx)
+	if a.outputLength > 0 && int64(len(entry.Output)) > a.outputLength {
+		entry.Output = entry.Output[:a.outputLength] + "..."
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("audit: failed to serialize entry: %s", err.Error())
+
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.closed {
+		return
+	}
+
+	if a.fileName != "" {
+		if err := a.writeFile(data); err != nil {
+			log.Errorf("audit: %s", err.Error())
+		}
+	}
+
+	if a.udpConn != nil {
+		msg := data
+		if a.udpFormat == "syslog" {
+			msg = []byte(fmt.Sprintf("<%d>1 %s %s snclient - - - %s", auditSyslogPriority, entry.Timestamp, a.hostName, data))
+		}
+		if _, err := a.udpConn.Write(msg); err != nil {
+			log.Debugf("audit: failed to send entry to udp server: %s", err.Error())
+		}
+	}
+}
+
+// Close closes the file and udp connection, further entries will be skipped.
+func (a *AuditLog) Close() {
+	if a == nil {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.closed = true
+	if a.file != nil {
+		LogError(a.file.Close())
+		a.file = nil
+	}
+	if a.udpConn != nil {
+		LogError(a.udpConn.Close())
+		a.udpConn = nil
+	}
+}
+
+// writeFile appends the entry to the audit file and rotates the file if required, must be called with lock held.
+func (a *AuditLog) writeFile(data []byte) error {
+	if a.file == nil {
+		file, err := os.OpenFile(a.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log %s: %s", a.fileName, err.Error())
+		}
+		fileInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+
+			return fmt.Errorf("failed to stat audit log %s: %s", a.fileName, err.Error())
+		}
+		a.file = file
+		a.fileSize = fileInfo.Size()
+	}
+
+	written, err := a.file.Write(append(data, '\n'))
+	a.fileSize += int64(written)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log %s: %s", a.fileName, err.Error())
+	}
+
+	if a.maxSize > 0 && a.fileSize > a.maxSize {
+		a.rotate()
+	}
+
+	return nil
+}
+
+// rotate moves the audit file to file.1 and shifts older files, must be called with lock held.
+func (a *AuditLog) rotate() {
+	LogError(a.file.Close())
+	a.file = nil
+
+	if a.maxFiles <= 0 {
+		LogError(os.Remove(a.fileName))
+
+		return
+	}
+
+	err := os.Remove(fmt.Sprintf("%s.%d", a.fileName, a.maxFiles))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Debugf("audit: %s", err.Error())
+	}
+	for num := a.maxFiles - 1; num >= 1; num-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", a.fileName, num), fmt.Sprintf("%s.%d", a.fileName, num+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Debugf("audit: %s", err.Error())
+		}
+	}
+	if err := os.Rename(a.fileName, a.fileName+".1"); err != nil {
+		log.Errorf("audit: failed to rotate %s: %s", a.fileName, err.Error())
+	}
+}
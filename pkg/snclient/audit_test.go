@@ -0,0 +1,81 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	udpServer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer udpServer.Close()
+
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	config := `
+[/settings/audit]
+enabled = true
+file name = ` + auditFile + `
+max size = 500
+max files = 2
+output length = 10
+mask positional arguments = false
+udp server = ` + udpServer.LocalAddr().String() + `
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	ctx := WithRequestSource(context.Background(), "nrpe", "127.0.0.1:5666", "naemon")
+	res := snc.RunCheckWithContext(ctx, "check_dummy", []string{"1", "this is a warning", "password=secret", "-p", "secret"})
+	assert.Equalf(t, CheckExitWarning, res.State, "check executed")
+
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	entry := AuditEntry{}
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equalf(t, "nrpe", entry.Listener, "listener")
+	assert.Equalf(t, "127.0.0.1:5666", entry.RemoteAddress, "remote address")
+	assert.Equalf(t, "naemon", entry.Identity, "identity")
+	assert.Equalf(t, "check_dummy", entry.Command, "command")
+	assert.Equalf(t, []string{"1", "this is a warning", "password=...", "-p", "..."}, entry.Args, "password is masked")
+	assert.Equalf(t, CheckExitWarning, entry.State, "state")
+	assert.Equalf(t, "this is a ...", entry.Output, "output is truncated")
+
+	require.NoError(t, udpServer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 4096)
+	size, _, err := udpServer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Truef(t, strings.HasPrefix(string(buf[:size]), "<134>1 "), "syslog header")
+	assert.Containsf(t, string(buf[:size]), `"command":"check_dummy"`, "udp message contains entry")
+
+	// files are rotated after reaching max size
+	for i := 0; i < 5; i++ {
+		snc.RunCheckWithContext(ctx, "check_dummy", []string{"0"})
+	}
+	assert.FileExistsf(t, auditFile+".1", "audit log has been rotated")
+	assert.NoFileExistsf(t, auditFile+".3", "only max files are kept")
+}
+
+func TestAuditMaskArgs(t *testing.T) {
+	for _, check := range []struct {
+		args       []string
+		positional bool
+		expect     []string
+	}{
+		{[]string{"password=secret", "--token=abc", "Pass = abc"}, false, []string{"password=...", "--token=...", "Pass = ..."}},
+		{[]string{"filter=name = 'password'", "warn=load > 5"}, false, []string{"filter=name = 'password'", "warn=load > 5"}},
+		{[]string{"-p", "secret", "--password", "secret", "-H", "localhost"}, false, []string{"-p", "...", "--password", "...", "-H", "localhost"}},
+		{[]string{"-H", "localhost", "dbuser", "secret"}, true, []string{"-H", "...", "...", "..."}},
+		{[]string{"warn=load > 5", "--verbose"}, true, []string{"warn=load > 5", "--verbose"}},
+	} {
+		assert.Equalf(t, check.expect, auditMaskArgs(check.args, check.positional), "masked %v", check.args)
+	}
+}
@@ -10,9 +10,11 @@ import (
 
 type CheckAlias struct {
 	noCopy  noCopy
+	name    string
 	command string
 	args    []string // arguments supplied by the alias itself
 	config  *ConfigSection
+	policy  *ArgumentPolicy // replaces the nasty characters check if set
 }
 
 func (a *CheckAlias) Build() *CheckData {
@@ -21,16 +23,27 @@ func (a *CheckAlias) Build() *CheckData {
 	}
 }
 
+// ArgumentPolicy returns the argument policy of this alias or nil.
+func (a *CheckAlias) ArgumentPolicy() *ArgumentPolicy {
+	return a.policy
+}
+
 func (a *CheckAlias) Check(ctx context.Context, snc *Agent, check *CheckData, _ []Argument) (res *CheckResult, err error) {
 	userArgs := check.rawArgs
 	var statusResult *CheckResult
+	var policyErr error
+	if a.policy != nil {
+		policyErr = a.policy.Verify(userArgs)
+	}
 	switch {
-	case !checkAllowArguments(a.config, userArgs):
+	case a.policy == nil && !checkAllowArguments(a.config, userArgs):
 		statusResult = &CheckResult{
 			State:  CheckExitUnknown,
 			Output: "Exception processing request: Request contained arguments (check the allow arguments option).",
 		}
-	case !checkNastyCharacters(a.config, "", userArgs):
+	case policyErr != nil:
+		statusResult = a.policy.Result(policyErr)
+	case !checkNastyCharacters(a.config, "", a.policy.UncheckedArgs(userArgs)):
 		statusResult = &CheckResult{
 			State:  CheckExitUnknown,
 			Output: "Exception processing request: Request contained illegal characters (check the allow nasty characters option).",
@@ -38,10 +51,11 @@ func (a *CheckAlias) Check(ctx context.Context, snc *Agent, check *CheckData, _
 	default:
 		cmdArgs := a.args
 		argStr := strings.Join(a.args, " ")
-		if strings.Contains(argStr, "$ARG") {
+		if strings.Contains(argStr, "$ARG") || strings.Contains(argStr, "$IDENTITY$") {
 			log.Debugf("command before macros expanded: %s %s", a.command, argStr)
 			macros := map[string]string{
-				"ARGS": strings.Join(userArgs, " "),
+				"ARGS":     strings.Join(userArgs, " "),
+				"IDENTITY": RequestIdentity(ctx),
 			}
 			for i := range userArgs {
 				macros[fmt.Sprintf("ARG%d", i+1)] = check.rawArgs[i]
@@ -55,7 +69,12 @@ func (a *CheckAlias) Check(ctx context.Context, snc *Agent, check *CheckData, _
 
 			log.Debugf("command after macros expanded: %s %s", a.command, replacedStr)
 		}
-		statusResult = snc.runCheck(ctx, a.command, cmdArgs)
+		statusResult, err = snc.runCachedCheck(ctx, cacheKey(a.name, append([]string{a.command}, cmdArgs...)), a.config, check.timeout, func(ctx context.Context) *CheckResult {
+			return snc.runCheck(ctx, a.command, cmdArgs)
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	statusResult.ParsePerformanceDataFromOutputCond(a.command, a.config)
@@ -0,0 +1,337 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pkg/convert"
+	"pkg/humanize"
+)
+
+func init() {
+	AvailableChecks["check_cgroup"] = CheckEntry{"check_cgroup", NewCheckCgroup}
+}
+
+// cgroupRootPath is the mount point of the cgroup v2 hierarchy
+var cgroupRootPath = "/sys/fs/cgroup"
+
+type CheckCgroup struct {
+	cgroups []string
+	depth   int64
+}
+
+func NewCheckCgroup() CheckHandler {
+	return &CheckCgroup{
+		depth: 1,
+	}
+}
+
+func (l *CheckCgroup) Build() *CheckData {
+	return &CheckData{
+		name:         "check_cgroup",
+		description:  "Checks the resource usage of linux cgroups (v2 only).",
+		implemented:  Linux,
+		hasInventory: ListInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"cgroup": {value: &l.cgroups, description: "Check this cgroup and its children, path relative to the cgroup root, ex.: /system.slice (default: /)"},
+			"depth":  {value: &l.depth, description: "Number of levels of child cgroups to check, 0 checks the given cgroup only (default: 1)"},
+		},
+		defaultWarning:  "memory_pct > 80 || pids_pct > 80",
+		defaultCritical: "memory_pct > 90 || pids_pct > 90",
+		topSyntax:       "%(status) - %(list)",
+		detailSyntax:    "%(name) %(memory_current_human)",
+		emptyState:      CheckExitUnknown,
+		emptySyntax:     "%(status) - no cgroups found",
+		attributes: []CheckAttribute{
+			{name: "name", description: "path of the cgroup relative to the cgroup root"},
+			{name: "memory_current", description: "current memory usage in bytes"},
+			{name: "memory_current_human", description: "current memory usage (human readable)"},
+			{name: "memory_max", description: "memory limit in bytes, 0 if unlimited"},
+			{name: "memory_pct", description: "memory usage in percent of the limit, 0 if unlimited"},
+			{name: "oom", description: "number of times the memory limit was reached"},
+			{name: "oom_kill", description: "number of processes killed by the oom killer"},
+			{name: "cpu_usage", description: "total cpu time in seconds"},
+			{name: "cpu_periods", description: "number of elapsed cpu quota periods"},
+			{name: "cpu_throttled", description: "number of periods the cgroup has been throttled"},
+			{name: "cpu_throttled_time", description: "total time in seconds the cgroup has been throttled"},
+			{name: "cpu_throttled_pct", description: "percentage of periods the cgroup has been throttled"},
+			{name: "io_read_bytes", description: "total bytes read from all devices"},
+			{name: "io_write_bytes", description: "total bytes written to all devices"},
+			{name: "io_read_ops", description: "total read operations on all devices"},
+			{name: "io_write_ops", description: "total write operations on all devices"},
+			{name: "pids_current", description: "current number of processes"},
+			{name: "pids_max", description: "process limit, 0 if unlimited"},
+			{name: "pids_pct", description: "number of processes in percent of the limit, 0 if unlimited"},
+		},
+		exampleDefault: `
+    check_cgroup
+    OK - /init.scope 11.2 MiB, /system.slice 1.4 GiB, /user.slice 3.2 GiB |...
+
+Check docker containers and alert on throttling and oom kills:
+
+    check_cgroup cgroup=/system.slice filter="name like docker-" warn="cpu_throttled_pct > 10" crit="oom_kill > 0"
+    OK - /system.slice/docker-1a2b3c.scope 312.5 MiB |...
+	`,
+		exampleArgs: `'warn=memory_pct > 80' 'crit=memory_pct > 90'`,
+	}
+}
+
+func (l *CheckCgroup) Check(_ context.Context, _ *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRootPath, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("no cgroup v2 hierarchy found in %s", cgroupRootPath)
+	}
+
+	cgroups := l.cgroups
+	if len(cgroups) == 0 {
+		cgroups = []string{"/"}
+	}
+
+	for _, cgroup := range cgroups {
+		name := filepath.Clean("/" + cgroup)
+		dir := filepath.Join(cgroupRootPath, name)
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("cgroup %s not found: %s", name, err.Error())
+		}
+		if err := l.addCgroup(check, name, l.depth); err != nil {
+			return nil, err
+		}
+	}
+
+	return check.Finalize()
+}
+
+// addCgroup adds the cgroup and its children up to given depth. The root cgroup has no resource files and is skipped.
+func (l *CheckCgroup) addCgroup(check *CheckData, name string, depth int64) error {
+	dir := filepath.Join(cgroupRootPath, name)
+	if name != "/" {
+		entry := l.readCgroup(name, dir)
+		if check.MatchMapCondition(check.filter, entry, true) {
+			check.listData = append(check.listData, entry)
+			l.addMetrics(check, entry)
+		}
+	}
+
+	if depth <= 0 {
+		return nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read cgroup %s: %s", name, err.Error())
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		if err := l.addCgroup(check, filepath.Join(name, file.Name()), depth-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *CheckCgroup) readCgroup(name, dir string) map[string]string {
+	entry := map[string]string{
+		"name": name,
+	}
+
+	memCurrent := readCgroupValue(dir, "memory.current")
+	memMax := readCgroupValue(dir, "memory.max")
+	entry["memory_current"] = fmt.Sprintf("%d", memCurrent)
+	entry["memory_current_human"] = humanize.IBytes(uint64(memCurrent))
+	entry["memory_max"] = fmt.Sprintf("%d", memMax)
+	entry["memory_pct"] = fmt.Sprintf("%f", cgroupPercent(memCurrent, memMax))
+
+	events := readCgroupKeyValues(dir, "memory.events")
+	entry["oom"] = fmt.Sprintf("%d", events["oom"])
+	entry["oom_kill"] = fmt.Sprintf("%d", events["oom_kill"])
+
+	cpuStat := readCgroupKeyValues(dir, "cpu.stat")
+	entry["cpu_usage"] = fmt.Sprintf("%f", float64(cpuStat["usage_usec"])/1e6)
+	entry["cpu_periods"] = fmt.Sprintf("%d", cpuStat["nr_periods"])
+	entry["cpu_throttled"] = fmt.Sprintf("%d", cpuStat["nr_throttled"])
+	entry["cpu_throttled_time"] = fmt.Sprintf("%f", float64(cpuStat["throttled_usec"])/1e6)
+	entry["cpu_throttled_pct"] = fmt.Sprintf("%f", cgroupPercent(cpuStat["nr_throttled"], cpuStat["nr_periods"]))
+
+	ioStat := readCgroupIOStat(dir)
+	entry["io_read_bytes"] = fmt.Sprintf("%d", ioStat["rbytes"])
+	entry["io_write_bytes"] = fmt.Sprintf("%d", ioStat["wbytes"])
+	entry["io_read_ops"] = fmt.Sprintf("%d", ioStat["rios"])
+	entry["io_write_ops"] = fmt.Sprintf("%d", ioStat["wios"])
+
+	pidsCurrent := readCgroupValue(dir, "pids.current")
+	pidsMax := readCgroupValue(dir, "pids.max")
+	entry["pids_current"] = fmt.Sprintf("%d", pidsCurrent)
+	entry["pids_max"] = fmt.Sprintf("%d", pidsMax)
+	entry["pids_pct"] = fmt.Sprintf("%f", cgroupPercent(pidsCurrent, pidsMax))
+
+	return entry
+}
+
+func (l *CheckCgroup) addMetrics(check *CheckData, entry map[string]string) {
+	name := entry["name"]
+	var memMax *float64
+	if limit := convert.Float64(entry["memory_max"]); limit > 0 {
+		memMax = &limit
+	}
+
+	check.result.Metrics = append(check.result.Metrics,
+		&CheckMetric{
+			ThresholdName: "memory_current",
+			Name:          name + " memory",
+			Unit:          "B",
+			Value:         convert.Int64(entry["memory_current"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           memMax,
+		},
+		&CheckMetric{
+			ThresholdName: "memory_pct",
+			Name:          name + " memory_pct",
+			Unit:          "%",
+			Value:         convert.Float64(entry["memory_pct"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &Hundred,
+		},
+		&CheckMetric{
+			ThresholdName: "pids_current",
+			Name:          name + " pids",
+			Value:         convert.Int64(entry["pids_current"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		},
+		&CheckMetric{
+			ThresholdName: "pids_pct",
+			Name:          name + " pids_pct",
+			Unit:          "%",
+			Value:         convert.Float64(entry["pids_pct"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &Hundred,
+		},
+		&CheckMetric{
+			ThresholdName: "cpu_throttled_pct",
+			Name:          name + " cpu_throttled_pct",
+			Unit:          "%",
+			Value:         convert.Float64(entry["cpu_throttled_pct"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &Hundred,
+		},
+		&CheckMetric{
+			ThresholdName: "oom_kill",
+			Name:          name + " oom_kill",
+			Unit:          "c",
+			Value:         convert.Int64(entry["oom_kill"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		},
+		&CheckMetric{
+			ThresholdName: "io_read_bytes",
+			Name:          name + " io_read",
+			Unit:          "c",
+			Value:         convert.Int64(entry["io_read_bytes"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		},
+		&CheckMetric{
+			ThresholdName: "io_write_bytes",
+			Name:          name + " io_write",
+			Unit:          "c",
+			Value:         convert.Int64(entry["io_write_bytes"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		},
+	)
+}
+
+// readCgroupValue returns the number from single value files like memory.max, "max" and missing files return 0.
+func readCgroupValue(dir, file string) int64 {
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return 0
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0
+	}
+
+	return convert.Int64(value)
+}
+
+// readCgroupKeyValues parses flat keyed files like cpu.stat or memory.events.
+func readCgroupKeyValues(dir, file string) map[string]int64 {
+	values := make(map[string]int64)
+	statFile, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return values
+	}
+	defer statFile.Close()
+
+	fileScanner := bufio.NewScanner(statFile)
+	for fileScanner.Scan() {
+		fields := strings.Fields(fileScanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		values[fields[0]] = convert.Int64(fields[1])
+	}
+
+	return values
+}
+
+// readCgroupIOStat sums up the nested keyed io.stat file over all devices:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func readCgroupIOStat(dir string) map[string]int64 {
+	values := make(map[string]int64)
+	statFile, err := os.Open(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		return values
+	}
+	defer statFile.Close()
+
+	fileScanner := bufio.NewScanner(statFile)
+	for fileScanner.Scan() {
+		fields := strings.Fields(fileScanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			values[key] += convert.Int64(val)
+		}
+	}
+
+	return values
+}
+
+// cgroupPercent returns current in percent of limit or 0 if there is no limit.
+func cgroupPercent(current, limit int64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+
+	return float64(current) * 100 / float64(limit)
+}
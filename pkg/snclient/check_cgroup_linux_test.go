@@ -0,0 +1,57 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCgroup(t *testing.T) {
+	fixture := t.TempDir()
+	files := map[string]string{
+		"cgroup.controllers":                      "cpu io memory pids\n",
+		"system.slice/memory.current":             "536870912\n",
+		"system.slice/memory.max":                 "max\n",
+		"system.slice/pids.current":               "120\n",
+		"system.slice/pids.max":                   "max\n",
+		"system.slice/app.service/memory.current": "943718400\n",
+		"system.slice/app.service/memory.max":     "1073741824\n",
+		"system.slice/app.service/memory.events":  "low 0\nhigh 0\nmax 12\noom 3\noom_kill 2\n",
+		"system.slice/app.service/cpu.stat":       "usage_usec 5000000\nuser_usec 4000000\nsystem_usec 1000000\nnr_periods 200\nnr_throttled 50\nthrottled_usec 2500000\n",
+		"system.slice/app.service/io.stat":        "8:0 rbytes=1000 wbytes=2000 rios=10 wios=20 dbytes=0 dios=0\n8:16 rbytes=500 wbytes=500 rios=5 wios=5 dbytes=0 dios=0\n",
+		"system.slice/app.service/pids.current":   "10\n",
+		"system.slice/app.service/pids.max":       "100\n",
+		"user.slice/memory.current":               "1048576\n",
+	}
+	for name, data := range files {
+		file := filepath.Join(fixture, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o700))
+		require.NoError(t, os.WriteFile(file, []byte(data), 0o600))
+	}
+	defer func(path string) { cgroupRootPath = path }(cgroupRootPath)
+	cgroupRootPath = fixture
+
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheck("check_cgroup", []string{})
+	assert.Equalf(t, CheckExitOK, res.State, "state ok")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "OK - /system.slice 512 MiB, /user.slice 1 MiB |", "output matches")
+
+	res = snc.RunCheck("check_cgroup", []string{"cgroup=/system.slice", "depth=1", "filter=name like app"})
+	assert.Equalf(t, CheckExitWarning, res.State, "memory usage is warning")
+	output := string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "WARNING - /system.slice/app.service 900 MiB |", "output matches")
+	assert.Containsf(t, output, "'/system.slice/app.service memory_pct'=87.890625%;80;90;0;100", "memory perfdata")
+	assert.Containsf(t, output, "'/system.slice/app.service oom_kill'=2c;;;0", "oom kill perfdata")
+
+	res = snc.RunCheck("check_cgroup", []string{"cgroup=/system.slice/app.service", "depth=0", "warn=none", "crit=cpu_throttled_pct > 20 || oom_kill > 0", "top-syntax=${list}", "detail-syntax=${cpu_throttled_pct:fmt=%.0f}% ${io_read_bytes} ${io_write_ops} ${pids_pct:fmt=%.0f}%"})
+	assert.Equalf(t, CheckExitCritical, res.State, "throttling is critical")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "25% 1500 25 10%", "attributes match")
+
+	res = snc.RunCheck("check_cgroup", []string{"cgroup=/missing"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "missing cgroup")
+}
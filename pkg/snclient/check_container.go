@@ -0,0 +1,393 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/convert"
+	"pkg/humanize"
+
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	AvailableChecks["check_container"] = CheckEntry{"check_container", NewCheckContainer}
+}
+
+// containerSockets contains the default api sockets, the first existing one will be used
+var containerSockets = []string{
+	"/var/run/docker.sock",
+	"/run/podman/podman.sock",
+}
+
+type CheckContainer struct {
+	socket     string
+	containers []string
+	client     *http.Client
+}
+
+// containerListEntry is a single entry from GET /containers/json
+type containerListEntry struct {
+	ID      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	State   string   `json:"State"`
+	Created int64    `json:"Created"`
+}
+
+// containerInspect contains the used fields from GET /containers/<id>/json
+type containerInspect struct {
+	RestartCount int64 `json:"RestartCount"`
+	State        struct {
+		Status    string `json:"Status"`
+		ExitCode  int64  `json:"ExitCode"`
+		StartedAt string `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+// containerCPUStats contains the cpu usage counters from GET /containers/<id>/stats
+type containerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage float64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage float64 `json:"system_cpu_usage"`
+	OnlineCPUs  float64 `json:"online_cpus"`
+}
+
+// containerStats contains the used fields from GET /containers/<id>/stats
+type containerStats struct {
+	CPUStats    containerCPUStats `json:"cpu_stats"`
+	PreCPUStats containerCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage float64            `json:"usage"`
+		Limit float64            `json:"limit"`
+		Stats map[string]float64 `json:"stats"`
+	} `json:"memory_stats"`
+}
+
+// nameAndID returns the container name without leading slash and the short id
+func (c *containerListEntry) nameAndID() (name, shortID string) {
+	name = c.ID
+	if len(c.Names) > 0 {
+		name = strings.TrimPrefix(c.Names[0], "/")
+	}
+	shortID = c.ID
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+
+	return name, shortID
+}
+
+func NewCheckContainer() CheckHandler {
+	return &CheckContainer{}
+}
+
+func (l *CheckContainer) Build() *CheckData {
+	return &CheckData{
+		name: "check_container",
+		description: `Checks the state and resource usage of containers.
+
+Uses the docker compatible api socket, so it works with docker and podman. The agent needs read access to the socket.`,
+		implemented:  Linux | FreeBSD | Darwin,
+		hasInventory: ListInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"container": {value: &l.containers, isFilter: true, description: "Show this container only, name or id"},
+			"socket":    {value: &l.socket, description: "Path to the api socket (default: " + strings.Join(containerSockets, " or ") + ")"},
+		},
+		defaultWarning:  "state in ('restarting', 'paused') || health == 'starting'",
+		defaultCritical: "state == 'dead' || exit_code != 0 || health == 'unhealthy'",
+		topSyntax:       "%(status) - %(list)",
+		detailSyntax:    "%(name) %(state)%(health_txt)",
+		okSyntax:        "%(status) - All %(count) container(s) are ok",
+		emptyState:      CheckExitUnknown,
+		emptySyntax:     "%(status) - no containers found",
+		attributes: []CheckAttribute{
+			{name: "id", description: "short id of the container"},
+			{name: "name", description: "name of the container"},
+			{name: "image", description: "image of the container"},
+			{name: "state", description: "state of the container, ex.: created, running, paused, restarting, exited or dead"},
+			{name: "health", description: "health status of the container, ex.: starting, healthy or unhealthy, empty if there is no health check"},
+			{name: "health_txt", description: "health status in human readable form"},
+			{name: "restarts", description: "number of restarts"},
+			{name: "exit_code", description: "exit code of the last run"},
+			{name: "created", description: "date when the container was created (unix timestamp)"},
+			{name: "started", description: "date when the container was started (unix timestamp)"},
+			{name: "uptime", description: "seconds since the container was started, 0 if not running"},
+			{name: "cpu", description: "cpu usage in percent of a single cpu"},
+			{name: "mem_used", description: "memory usage in bytes"},
+			{name: "mem_used_human", description: "memory usage (human readable)"},
+			{name: "mem_limit", description: "memory limit in bytes, the total memory if no limit is set"},
+			{name: "mem_limit_human", description: "memory limit (human readable)"},
+			{name: "mem_pct", description: "memory usage in percent of the limit"},
+		},
+		exampleDefault: `
+    check_container
+    OK - All 3 container(s) are ok |'web cpu'=1.2%;;;0 'web mem'=52428800B;;;0;1073741824 'web restarts'=0;;;0 ...
+
+Check a single container and alert on memory usage and restarts:
+
+    check_container container=web warn="mem_pct > 80 || restarts > 0" crit="mem_pct > 90 || state != 'running'"
+    OK - web running (healthy) |...
+	`,
+		exampleArgs: `'warn=mem_pct > 80' 'crit=mem_pct > 90'`,
+	}
+}
+
+func (l *CheckContainer) Check(ctx context.Context, _ *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	socket, err := l.getSocket()
+	if err != nil {
+		return nil, err
+	}
+	l.client = &http.Client{
+		Timeout: DefaultCmdTimeout * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	defer l.client.CloseIdleConnections()
+
+	list := []containerListEntry{}
+	if err = l.apiGet(ctx, "/containers/json?all=1", &list); err != nil {
+		return nil, err
+	}
+
+	entries := []map[string]string{}
+	ids := []string{}
+	for i := range list {
+		name, shortID := list[i].nameAndID()
+		if len(l.containers) > 0 && !slices.Contains(l.containers, name) && !slices.Contains(l.containers, shortID) {
+			continue
+		}
+
+		entry, err := l.fetchContainer(ctx, &list[i])
+		if err != nil {
+			return nil, err
+		}
+
+		// inventory lists running containers only
+		if check.output == "inventory_json" && entry["state"] != "running" {
+			continue
+		}
+
+		entries = append(entries, entry)
+		ids = append(ids, list[i].ID)
+	}
+
+	// fetching stats takes a second per container, so do it in parallel
+	if check.output != "inventory_json" {
+		l.fetchAllStats(ctx, entries, ids)
+	}
+
+	for _, entry := range entries {
+		if !check.MatchMapCondition(check.filter, entry, true) {
+			continue
+		}
+
+		check.listData = append(check.listData, entry)
+		l.addMetrics(check, entry)
+	}
+
+	return check.Finalize()
+}
+
+// getSocket returns the configured api socket or the first existing default socket
+func (l *CheckContainer) getSocket() (string, error) {
+	if l.socket != "" {
+		return l.socket, nil
+	}
+
+	for _, socket := range containerSockets {
+		if _, err := os.Stat(socket); err == nil {
+			return socket, nil
+		}
+	}
+
+	return "", fmt.Errorf("no container api socket found, tried: %s", strings.Join(containerSockets, ", "))
+}
+
+// apiGet fetches the given api path and decodes the json result into target
+func (l *CheckContainer) apiGet(ctx context.Context, path string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost"+path, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("new request: %s", err.Error())
+	}
+
+	log.Tracef("container api GET %s", path)
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("container api request failed %s: %s", path, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("container api request failed %s: %s", path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("container api response %s: %s", path, err.Error())
+	}
+
+	return nil
+}
+
+// fetchContainer inspects a container and returns its attributes
+func (l *CheckContainer) fetchContainer(ctx context.Context, container *containerListEntry) (map[string]string, error) {
+	name, shortID := container.nameAndID()
+
+	entry := map[string]string{
+		"id":              shortID,
+		"name":            name,
+		"image":           container.Image,
+		"state":           container.State,
+		"health":          "",
+		"health_txt":      "",
+		"restarts":        "0",
+		"exit_code":       "0",
+		"created":         fmt.Sprintf("%d", container.Created),
+		"started":         "0",
+		"uptime":          "0",
+		"cpu":             "0",
+		"mem_used":        "0",
+		"mem_used_human":  "0 B",
+		"mem_limit":       "0",
+		"mem_limit_human": "0 B",
+		"mem_pct":         "0",
+	}
+
+	inspect := containerInspect{}
+	if err := l.apiGet(ctx, "/containers/"+url.PathEscape(container.ID)+"/json", &inspect); err != nil {
+		return nil, err
+	}
+
+	if inspect.State.Status != "" {
+		entry["state"] = inspect.State.Status
+	}
+	entry["restarts"] = fmt.Sprintf("%d", inspect.RestartCount)
+	entry["exit_code"] = fmt.Sprintf("%d", inspect.State.ExitCode)
+	if inspect.State.Health != nil && inspect.State.Health.Status != "" {
+		entry["health"] = inspect.State.Health.Status
+		entry["health_txt"] = " (" + inspect.State.Health.Status + ")"
+	}
+
+	started, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if err == nil && started.Unix() > 0 {
+		entry["started"] = fmt.Sprintf("%d", started.Unix())
+		if entry["state"] == "running" {
+			entry["uptime"] = fmt.Sprintf("%d", int64(time.Since(started).Seconds()))
+		}
+	}
+
+	return entry, nil
+}
+
+// fetchAllStats adds the cpu and memory usage to all running containers, ids contains the full container id for each entry
+func (l *CheckContainer) fetchAllStats(ctx context.Context, entries []map[string]string, ids []string) {
+	stats := make([]*containerStats, len(entries))
+	waitGroup := sync.WaitGroup{}
+	for i, entry := range entries {
+		if entry["state"] != "running" {
+			continue
+		}
+		waitGroup.Add(1)
+		go func(i int, id string) {
+			defer waitGroup.Done()
+			res := &containerStats{}
+			if err := l.apiGet(ctx, "/containers/"+url.PathEscape(id)+"/stats?stream=false", res); err != nil {
+				log.Debugf("check_container: %s", err.Error())
+
+				return
+			}
+			stats[i] = res
+		}(i, ids[i])
+	}
+	waitGroup.Wait()
+
+	for i, entry := range entries {
+		if stats[i] != nil {
+			l.setStats(entry, stats[i])
+		}
+	}
+}
+
+// setStats calculates cpu and memory usage the same way docker stats does
+func (l *CheckContainer) setStats(entry map[string]string, stats *containerStats) {
+	cpuDelta := stats.CPUStats.CPUUsage.TotalUsage - stats.PreCPUStats.CPUUsage.TotalUsage
+	systemDelta := stats.CPUStats.SystemUsage - stats.PreCPUStats.SystemUsage
+	if cpuDelta > 0 && systemDelta > 0 {
+		numCPU := stats.CPUStats.OnlineCPUs
+		if numCPU == 0 {
+			numCPU = 1
+		}
+		entry["cpu"] = fmt.Sprintf("%.1f", cpuDelta/systemDelta*numCPU*100)
+	}
+
+	// page cache is not counted as used memory, it is named inactive_file on cgroup v2 and cache on cgroup v1
+	used := stats.MemoryStats.Usage
+	if cache, ok := stats.MemoryStats.Stats["inactive_file"]; ok && cache < used {
+		used -= cache
+	} else if cache, ok := stats.MemoryStats.Stats["cache"]; ok && cache < used {
+		used -= cache
+	}
+	limit := stats.MemoryStats.Limit
+	entry["mem_used"] = fmt.Sprintf("%.0f", used)
+	entry["mem_used_human"] = humanize.IBytes(uint64(used))
+	entry["mem_limit"] = fmt.Sprintf("%.0f", limit)
+	entry["mem_limit_human"] = humanize.IBytes(uint64(limit))
+	if limit > 0 {
+		entry["mem_pct"] = fmt.Sprintf("%.1f", used*100/limit)
+	}
+}
+
+func (l *CheckContainer) addMetrics(check *CheckData, entry map[string]string) {
+	name := entry["name"]
+	if entry["state"] == "running" {
+		limit := convert.Float64(entry["mem_limit"])
+		check.result.Metrics = append(check.result.Metrics,
+			&CheckMetric{
+				ThresholdName: "cpu",
+				Name:          name + " cpu",
+				Unit:          "%",
+				Value:         convert.Float64(entry["cpu"]),
+				Warning:       check.warnThreshold,
+				Critical:      check.critThreshold,
+				Min:           &Zero,
+			},
+			&CheckMetric{
+				ThresholdName: "mem_used",
+				Name:          name + " mem",
+				Unit:          "B",
+				Value:         convert.Int64(entry["mem_used"]),
+				Warning:       check.warnThreshold,
+				Critical:      check.critThreshold,
+				Min:           &Zero,
+				Max:           &limit,
+			},
+		)
+	}
+
+	check.result.Metrics = append(check.result.Metrics, &CheckMetric{
+		ThresholdName: "restarts",
+		Name:          name + " restarts",
+		Value:         convert.Int64(entry["restarts"]),
+		Warning:       check.warnThreshold,
+		Critical:      check.critThreshold,
+		Min:           &Zero,
+	})
+}
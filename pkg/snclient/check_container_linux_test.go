@@ -0,0 +1,105 @@
+package snclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startFakeContainerAPI starts a minimal docker compatible api on a unix socket
+func startFakeContainerAPI(t *testing.T) string {
+	t.Helper()
+
+	responses := map[string]string{
+		"/containers/json": `[
+			{"Id": "aaaaaaaaaaaa1111", "Names": ["/web"], "Image": "nginx:latest", "State": "running", "Created": 1700000000},
+			{"Id": "bbbbbbbbbbbb2222", "Names": ["/worker"], "Image": "worker:1.2", "State": "running", "Created": 1700000000},
+			{"Id": "cccccccccccc3333", "Names": ["/job"], "Image": "busybox", "State": "exited", "Created": 1700000000}
+		]`,
+		"/containers/aaaaaaaaaaaa1111/json": `{"RestartCount": 0, "State": {"Status": "running", "ExitCode": 0, "StartedAt": "2024-03-01T10:00:00.123456789Z", "Health": {"Status": "healthy"}}}`,
+		"/containers/bbbbbbbbbbbb2222/json": `{"RestartCount": 2, "State": {"Status": "running", "ExitCode": 0, "StartedAt": "2024-03-01T10:00:00Z"}}`,
+		"/containers/cccccccccccc3333/json": `{"RestartCount": 0, "State": {"Status": "exited", "ExitCode": 1, "StartedAt": "2024-03-01T10:00:00Z"}}`,
+		"/containers/aaaaaaaaaaaa1111/stats": `{
+			"cpu_stats": {"cpu_usage": {"total_usage": 120000000}, "system_cpu_usage": 1400000000, "online_cpus": 4},
+			"precpu_stats": {"cpu_usage": {"total_usage": 100000000}, "system_cpu_usage": 1000000000},
+			"memory_stats": {"usage": 62914560, "limit": 1073741824, "stats": {"inactive_file": 10485760}}
+		}`,
+		"/containers/bbbbbbbbbbbb2222/stats": `{
+			"cpu_stats": {"cpu_usage": {"total_usage": 100000000}, "system_cpu_usage": 1400000000, "online_cpus": 4},
+			"precpu_stats": {"cpu_usage": {"total_usage": 100000000}, "system_cpu_usage": 1000000000},
+			"memory_stats": {"usage": 1048576, "limit": 2097152, "stats": {}}
+		}`,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(res http.ResponseWriter, req *http.Request) {
+		body, ok := responses[req.URL.Path]
+		if !ok {
+			http.NotFound(res, req)
+
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte(body))
+	})
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: DefaultSocketTimeout * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return socket
+}
+
+func TestCheckContainer(t *testing.T) {
+	socket := startFakeContainerAPI(t)
+
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheck("check_container", []string{"socket=" + socket})
+	assert.Equalf(t, CheckExitCritical, res.State, "exited container is critical")
+	output := string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "CRITICAL - web running (healthy), worker running, job exited |", "output matches")
+	assert.Containsf(t, output, "'web cpu'=20%;;;0 'web mem'=52428800B;;;0;1073741824 'web restarts'=0;;;0", "web perfdata")
+	assert.Containsf(t, output, "'worker restarts'=2;;;0 'job restarts'=0;;;0", "restarts perfdata")
+
+	res = snc.RunCheck("check_container", []string{
+		"socket=" + socket, "container=web", "top-syntax=${list}",
+		"detail-syntax=${id} ${image} ${health} ${restarts} ${exit_code} ${started} ${cpu} ${mem_used_human}/${mem_limit_human} ${mem_pct}",
+	})
+	assert.Equalf(t, CheckExitOK, res.State, "healthy container is ok")
+	assert.Equalf(t, "aaaaaaaaaaaa nginx:latest healthy 0 0 1709287200 20.0 50 MiB/1 GiB 4.9", res.Output, "attributes match")
+
+	res = snc.RunCheck("check_container", []string{"socket=" + socket, "filter=state == running", "warn=mem_pct > 40", "crit=mem_pct > 60"})
+	assert.Equalf(t, CheckExitWarning, res.State, "worker memory is warning")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "WARNING - web running (healthy), worker running |", "output matches")
+
+	res = snc.RunCheck("check_container", []string{"socket=" + socket, "container=job", "crit=restarts > 0"})
+	assert.Equalf(t, CheckExitOK, res.State, "thresholds can be overridden")
+
+	defaultSockets := containerSockets
+	containerSockets = []string{socket}
+	defer func() { containerSockets = defaultSockets }()
+
+	inventory := snc.BuildInventory(context.TODO(), []string{"container"})
+	list, ok := inventory["inventory"].(map[string]interface{})["container"].([]map[string]string)
+	require.Truef(t, ok, "inventory contains containers")
+	names := []string{}
+	for _, entry := range list {
+		names = append(names, entry["name"])
+	}
+	assert.Equalf(t, []string{"web", "worker"}, names, "inventory contains running containers only")
+}
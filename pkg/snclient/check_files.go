@@ -70,6 +70,7 @@ func (l *CheckFiles) Build() *CheckData {
 			{name: "filename", description: "Name of the file"},
 			{name: "name", description: "Name of the file"},
 			{name: "fullname", description: "Full name of the file including path"},
+			{name: "directory", description: "Directory of the file"},
 			{name: "size", description: "File size in bytes"},
 			{name: "type", description: "Type of item (file or directory)"},
 			{name: "written", description: "Date when file was last written to"},
@@ -115,10 +116,11 @@ func (l *CheckFiles) Check(_ context.Context, _ *Agent, check *CheckData, _ []Ar
 			if dir != nil {
 				filename = dir.Name()
 				fileEntry = map[string]string{
-					"path":     path,
-					"file":     filename,
-					"filename": filename,
-					"name":     filename,
+					"path":      path,
+					"file":      filename,
+					"filename":  filename,
+					"name":      filename,
+					"directory": filepath.Dir(path),
 				}
 				if dir.IsDir() {
 					fileEntry["fullname"] = path
@@ -70,3 +70,27 @@ func TestCheckFilesNoPermission(t *testing.T) {
 
 	StopTestAgent(t, snc)
 }
+
+func TestCheckFilesGroupBy(t *testing.T) {
+	snc := StartTestAgent(t, "")
+
+	tmpPath := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		err := os.Mkdir(filepath.Join(tmpPath, dir), 0o700)
+		require.NoError(t, err)
+	}
+	for file, size := range map[string]int{"a/1.txt": 1000, "a/2.txt": 3000, "b/1.txt": 500} {
+		err := os.WriteFile(filepath.Join(tmpPath, file), []byte(strings.Repeat("x", size)), 0o600)
+		require.NoError(t, err)
+	}
+
+	res := snc.RunCheck("check_files", []string{"path=" + tmpPath, "group-by=directory", "warn=size_sum > 2KB", "detail-syntax=%(directory): %(count) files"})
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	output := string(res.BuildPluginOutput())
+	assert.Contains(t, output, "warning("+filepath.Join(tmpPath, "a")+": 2 files)")
+	assert.Contains(t, output, "'"+filepath.Join(tmpPath, "a")+" count'=2 ")
+	assert.Contains(t, output, "'"+filepath.Join(tmpPath, "a")+" size_sum'=4000B;2000")
+	assert.Contains(t, output, "'"+filepath.Join(tmpPath, "b")+" size_sum'=500B;2000")
+
+	StopTestAgent(t, snc)
+}
@@ -0,0 +1,279 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"time"
+
+	"pkg/convert"
+	"pkg/utils"
+)
+
+func init() {
+	AvailableChecks["check_journald"] = CheckEntry{"check_journald", NewCheckJournald}
+}
+
+const (
+	journalctlCmd = "journalctl"
+
+	// journaldStatePrefix is the prefix of the state store entries containing the journal cursors
+	journaldStatePrefix = "journald"
+)
+
+// journaldLevels maps syslog priorities to level names.
+var journaldLevels = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+type CheckJournald struct {
+	units       []string
+	identifiers []string
+	priority    string
+	scanRange   string
+	showLast    int64
+}
+
+func NewCheckJournald() CheckHandler {
+	return &CheckJournald{
+		scanRange: "-24h",
+		showLast:  10,
+	}
+}
+
+func (l *CheckJournald) Build() *CheckData {
+	return &CheckData{
+		name: "check_journald",
+		description: `Checks systemd journal entries.
+
+Entries are read with journalctl. The journal cursor is saved between check runs, so only
+new entries are checked. The scan-range is used if there is no saved cursor yet.
+Cursors are stored per unit, identifier and priority, so changing filters or thresholds does not reset them.
+All journal fields are available as lowercase attributes without leading underscores, ex.: _SYSTEMD_UNIT becomes systemd_unit.`,
+		implemented:  Linux,
+		hasInventory: NoCallInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"unit":       {value: &l.units, description: "Only read entries of this systemd unit (can be specified multiple times)"},
+			"identifier": {value: &l.identifiers, description: "Only read entries with this syslog identifier (can be specified multiple times)"},
+			"priority":   {value: &l.priority, description: "Only read entries with this priority or range of priorities, ex.: err or 0..4"},
+			"scan-range": {value: &l.scanRange, description: "Sets time range to scan for entries if there is no saved cursor (default is 24h)"},
+			"show-last":  {value: &l.showLast, description: "Number of last entries shown in the detail list (default 10, 0 shows all)"},
+		},
+		defaultFilter:   "priority <= 4",
+		defaultWarning:  "priority <= 4",
+		defaultCritical: "priority <= 3",
+		detailSyntax:    "%(identifier): %(message)",
+		okSyntax:        "%(status) - %(count) new journal entries",
+		topSyntax:       "%(status) - %(count) new journal entries %(problem_list)",
+		emptySyntax:     "%(status) - No new journal entries",
+		emptyState:      CheckExitOK,
+		attributes: []CheckAttribute{
+			{name: "message", description: "The message of the entry"},
+			{name: "priority", description: "Syslog priority (0 - emerg ... 7 - debug)"},
+			{name: "level", description: "Syslog priority as name: emerg, alert, crit, err, warning, notice, info or debug"},
+			{name: "unit", description: "Systemd unit of the entry"},
+			{name: "identifier", description: "Syslog identifier"},
+			{name: "pid", description: "Process id"},
+			{name: "hostname", description: "Hostname"},
+			{name: "timestamp", description: "Unix timestamp of the entry"},
+			{name: "time", description: "Date of the entry"},
+			{name: "age", description: "Seconds since the entry has been written"},
+		},
+		exampleDefault: `
+    check_journald unit=nginx.service
+    CRITICAL - 2 new journal entries critical(nginx: connect() failed, nginx: upstream timed out) |'count'=2;;;0
+	`,
+		exampleArgs: `'unit=sshd.service' 'filter=message like "Failed password"' 'warn=count > 5' 'crit=count > 20'`,
+	}
+}
+
+func (l *CheckJournald) Check(ctx context.Context, snc *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	check.listLimit = l.showLast
+
+	cursor := ""
+	stateName := l.stateName()
+	if check.stateStore != nil {
+		unlock := check.stateStore.LockEntry(stateName)
+		defer unlock()
+
+		if entry := check.stateStore.Get(stateName); entry != nil {
+			cursor = entry.Entries["cursor"]["cursor"]
+		}
+	}
+
+	args, err := l.buildArgs(cursor)
+	if err != nil {
+		return nil, err
+	}
+	output, stderr, exitCode, err := l.journalctl(ctx, snc, args, check.timeout)
+	if err == nil && exitCode != 0 && cursor != "" {
+		// cursor might be gone after journal rotation
+		log.Debugf("journalctl failed with saved cursor, retrying without: %s", stderr)
+		args, _ = l.buildArgs("")
+		output, stderr, exitCode, err = l.journalctl(ctx, snc, args, check.timeout)
+	}
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("journalctl failed: %s", err.Error())
+	case exitCode != 0:
+		return nil, fmt.Errorf("journalctl failed: %s", stderr)
+	}
+
+	lastCursor, err := l.addEntries(check, output)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastCursor != "" && check.stateStore != nil {
+		err = check.stateStore.Set(stateName, &StateStoreEntry{
+			Key:     "cursor",
+			Entries: map[string]map[string]string{"cursor": {"cursor": lastCursor}},
+		})
+		if err != nil {
+			log.Warnf("%s", err.Error())
+		}
+	}
+
+	check.result.Metrics = append(check.result.Metrics, &CheckMetric{
+		Name:     "count",
+		Value:    len(check.listData),
+		Warning:  check.warnThreshold,
+		Critical: check.critThreshold,
+		Min:      &Zero,
+	})
+
+	return check.Finalize()
+}
+
+// stateName returns the name of the state store entry for the saved cursor. It only depends on the
+// journalctl selection, so changing filters or thresholds keeps the cursor.
+func (l *CheckJournald) stateName() string {
+	return fmt.Sprintf("%s unit=%s identifier=%s priority=%s", journaldStatePrefix,
+		strings.Join(l.units, ","), strings.Join(l.identifiers, ","), l.priority)
+}
+
+// buildArgs returns the journalctl arguments.
+func (l *CheckJournald) buildArgs(cursor string) ([]string, error) {
+	args := []string{"--output=json", "--no-pager", "--quiet"}
+	if cursor != "" {
+		args = append(args, "--after-cursor="+cursor)
+	} else {
+		lookBack, err := utils.ExpandDuration(l.scanRange)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse scan-range: %s", err.Error())
+		}
+		if lookBack < 0 {
+			lookBack *= -1
+		}
+		args = append(args, fmt.Sprintf("--since=@%d", time.Now().Add(-time.Second*time.Duration(lookBack)).Unix()))
+	}
+	for _, unit := range l.units {
+		args = append(args, "--unit="+unit)
+	}
+	for _, identifier := range l.identifiers {
+		args = append(args, "--identifier="+identifier)
+	}
+	if l.priority != "" {
+		args = append(args, "--priority="+l.priority)
+	}
+
+	return args, nil
+}
+
+func (l *CheckJournald) journalctl(ctx context.Context, snc *Agent, args []string, timeout float64) (stdout, stderr string, exitCode int64, err error) {
+	cmd := exec.CommandContext(ctx, journalctlCmd, args...)
+	stdout, stderr, exitCode, _, err = snc.runExternalCommand(ctx, cmd, int64(math.Ceil(timeout)))
+
+	return stdout, stderr, exitCode, err
+}
+
+// addEntries parses journalctl json output, adds matching entries to the list data and returns the last cursor.
+func (l *CheckJournald) addEntries(check *CheckData, output string) (cursor string, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		entry, err := parseJournalEntry(line)
+		if err != nil {
+			return "", err
+		}
+		cursor = entry["cursor"]
+		if !check.MatchMapCondition(check.filter, entry, true) {
+			continue
+		}
+		check.listData = append(check.listData, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read journalctl output: %s", err.Error())
+	}
+
+	return cursor, nil
+}
+
+// parseJournalEntry converts a single json journal entry into attributes.
+func parseJournalEntry(line string) (map[string]string, error) {
+	fields := make(map[string]interface{})
+	err := json.Unmarshal([]byte(line), &fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse journal entry: %s", err.Error())
+	}
+
+	entry := make(map[string]string)
+	for key, raw := range fields {
+		name := strings.ToLower(strings.TrimLeft(key, "_"))
+		// trusted fields (with leading underscore) take precedence
+		if _, ok := entry[name]; ok && !strings.HasPrefix(key, "_") {
+			continue
+		}
+		entry[name] = journalFieldValue(raw)
+	}
+
+	entry["unit"] = entry["systemd_unit"]
+	entry["identifier"] = entry["syslog_identifier"]
+	if entry["identifier"] == "" {
+		entry["identifier"] = entry["comm"]
+	}
+	if prio, err := convert.Int64E(entry["priority"]); err == nil && prio >= 0 && prio < int64(len(journaldLevels)) {
+		entry["level"] = journaldLevels[prio]
+	}
+	if usec, err := convert.Int64E(entry["realtime_timestamp"]); err == nil {
+		written := time.UnixMicro(usec)
+		entry["timestamp"] = fmt.Sprintf("%d", written.Unix())
+		entry["time"] = written.Format("2006-01-02 15:04:05 MST")
+		entry["age"] = fmt.Sprintf("%d", int64(time.Since(written).Seconds()))
+	}
+
+	return entry, nil
+}
+
+// journalFieldValue returns the string value of a journal field, binary fields are sent as list of bytes.
+func journalFieldValue(raw interface{}) string {
+	switch val := raw.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	case []interface{}:
+		data := make([]byte, 0, len(val))
+		for _, b := range val {
+			num, ok := b.(float64)
+			if !ok {
+				// fields with multiple values
+				return fmt.Sprintf("%v", val)
+			}
+			data = append(data, byte(num))
+		}
+
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
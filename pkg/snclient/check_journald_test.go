@@ -0,0 +1,88 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckJournaldParse(t *testing.T) {
+	entry, err := parseJournalEntry(`{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1700000000000000","PRIORITY":"3",` +
+		`"_SYSTEMD_UNIT":"nginx.service","SYSLOG_IDENTIFIER":"nginx","_PID":"123","MESSAGE":[104,105]}`)
+	require.NoError(t, err)
+
+	assert.Equalf(t, "s=1;i=2", entry["cursor"], "cursor")
+	assert.Equalf(t, "hi", entry["message"], "binary message")
+	assert.Equalf(t, "err", entry["level"], "level")
+	assert.Equalf(t, "nginx.service", entry["unit"], "unit")
+	assert.Equalf(t, "nginx", entry["identifier"], "identifier")
+	assert.Equalf(t, "123", entry["pid"], "pid")
+	assert.Equalf(t, "1700000000", entry["timestamp"], "timestamp")
+}
+
+func TestCheckJournald(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("journald is only available on linux")
+	}
+
+	snc := StartTestAgent(t, "")
+	snc.stateStore = NewStateStore(filepath.Join(t.TempDir(), "snclient.state"))
+
+	// fake journalctl which returns entries after the cursor only
+	binPath := t.TempDir()
+	argsFile := filepath.Join(binPath, "args")
+	script := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+case "$*" in
+  *--after-cursor=c2*)
+    echo '{"__CURSOR":"c3","PRIORITY":"4","SYSLOG_IDENTIFIER":"sshd","MESSAGE":"third"}'
+    ;;
+  *)
+    echo '{"__CURSOR":"c1","PRIORITY":"3","SYSLOG_IDENTIFIER":"sshd","MESSAGE":"first"}'
+    echo '{"__CURSOR":"c2","PRIORITY":"6","SYSLOG_IDENTIFIER":"sshd","MESSAGE":"second"}'
+    ;;
+esac
+`
+	err := os.WriteFile(filepath.Join(binPath, journalctlCmd), []byte(script), 0o700) //nolint:gosec // test script must be executable
+	require.NoError(t, err)
+	t.Setenv("PATH", binPath+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	res := snc.RunCheck("check_journald", []string{"unit=sshd.service", "priority=0..6"})
+	assert.Equalf(t, CheckExitCritical, res.State, "state Critical")
+	assert.Equalf(t, "CRITICAL - 1 new journal entries sshd: first |'count'=1;;;0",
+		string(res.BuildPluginOutput()), "output matches")
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "--since=@")
+	assert.Contains(t, string(args), "--unit=sshd.service --priority=0..6")
+
+	res = snc.RunCheck("check_journald", []string{"unit=sshd.service", "priority=0..6"})
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	assert.Equalf(t, "WARNING - 1 new journal entries sshd: third |'count'=1;;;0",
+		string(res.BuildPluginOutput()), "output matches")
+
+	args, err = os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Truef(t, strings.Contains(string(args), "--after-cursor=c2"), "cursor is used")
+
+	// other thresholds keep the cursor
+	res = snc.RunCheck("check_journald", []string{"unit=sshd.service", "priority=0..6", "warn=none", "crit=none"})
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	args, err = os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Truef(t, strings.Contains(string(args), "--after-cursor=c"), "cursor is kept with other thresholds")
+
+	// other units use their own cursor
+	snc.RunCheck("check_journald", []string{"unit=cron.service", "priority=0..6"})
+	args, err = os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Truef(t, strings.Contains(string(args), "--since=@"), "other unit starts with scan range")
+
+	StopTestAgent(t, snc)
+}
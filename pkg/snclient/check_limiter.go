@@ -0,0 +1,272 @@
+package snclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// CheckLimitSection is the config section of the check execution limits.
+const CheckLimitSection = "/settings/limits"
+
+// CheckLimiter limits the number of concurrently running checks, queues checks exceeding the limit
+// and coalesces identical requests which are running already.
+type CheckLimiter struct {
+	noCopy   noCopy
+	lock     deadlock.Mutex
+	conf     *CheckLimitConfig
+	running  int64
+	commands map[string]int64 // number of running checks by command
+	queued   int64
+	released chan struct{} // closed and replaced whenever a check finishes
+	inflight map[string]*inflightCheck
+}
+
+// CheckLimitConfig contains the check execution limits.
+type CheckLimitConfig struct {
+	maxConcurrent int64         // maximum number of concurrently running checks, 0 is unlimited
+	maxPerCommand int64         // maximum number of concurrently running checks with the same command, 0 is unlimited
+	maxQueue      int64         // maximum number of checks waiting for a free slot
+	queueTimeout  time.Duration // maximum time a check waits in the queue
+	coalesce      bool          // share the result of identical running checks
+}
+
+type inflightCheck struct {
+	done    chan struct{}
+	result  *CheckResult
+	waiting int64 // number of requests waiting for the result
+}
+
+// NewCheckLimiter returns a new limiter without limits.
+func NewCheckLimiter() *CheckLimiter {
+	return &CheckLimiter{
+		conf:     &CheckLimitConfig{},
+		commands: make(map[string]int64),
+		released: make(chan struct{}),
+		inflight: make(map[string]*inflightCheck),
+	}
+}
+
+// NewCheckLimitConfig reads the limits from given config section.
+func NewCheckLimitConfig(conf *ConfigSection) (*CheckLimitConfig, error) {
+	limitConf := &CheckLimitConfig{
+		maxQueue:     100,
+		queueTimeout: 30 * time.Second,
+		coalesce:     true,
+	}
+
+	for key, target := range map[string]*int64{
+		"max concurrent checks":      &limitConf.maxConcurrent,
+		"max concurrent per command": &limitConf.maxPerCommand,
+		"max queue length":           &limitConf.maxQueue,
+	} {
+		num, ok, err := conf.GetInt(key)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("%s: %s", key, err.Error())
+		case ok:
+			*target = num
+		}
+	}
+
+	timeout, ok, err := conf.GetDuration("queue timeout")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("queue timeout: %s", err.Error())
+	case ok:
+		limitConf.queueTimeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	coalesce, ok, err := conf.GetBool("coalesce requests")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("coalesce requests: %s", err.Error())
+	case ok:
+		limitConf.coalesce = coalesce
+	}
+
+	return limitConf, nil
+}
+
+// SetConfig replaces the limits, running checks are not affected. A nil config removes all limits.
+func (cl *CheckLimiter) SetConfig(conf *CheckLimitConfig) {
+	if conf == nil {
+		conf = &CheckLimitConfig{}
+	}
+	cl.lock.Lock()
+	cl.conf = conf
+	cl.lock.Unlock()
+}
+
+// Run runs the check once a slot is available. Identical checks which are running already will share the result.
+func (cl *CheckLimiter) Run(ctx context.Context, name string, args []string, run func(context.Context) *CheckResult) *CheckResult {
+	if cl == nil {
+		return run(ctx)
+	}
+
+	cl.lock.Lock()
+	coalesce := cl.conf.coalesce
+	key := RequestIdentity(ctx) + "\x00" + name + "\x00" + strings.Join(args, "\x00")
+	if coalesce {
+		if running, ok := cl.inflight[key]; ok {
+			running.waiting++
+			log.Debugf("waiting for result of identical running check %s (%d waiting)", name, running.waiting)
+			cl.lock.Unlock()
+			promCheckCoalescedTotal.Inc()
+
+			return running.wait(ctx)
+		}
+	}
+
+	if err := cl.acquire(ctx, name); err != nil {
+		cl.lock.Unlock()
+
+		return &CheckResult{
+			State:  CheckExitUnknown,
+			Output: fmt.Sprintf("${status} - %s", err.Error()),
+		}
+	}
+
+	var running *inflightCheck
+	if coalesce {
+		running = &inflightCheck{done: make(chan struct{})}
+		cl.inflight[key] = running
+	}
+	cl.lock.Unlock()
+
+	defer func() {
+		cl.lock.Lock()
+		cl.release(name)
+		if running != nil {
+			delete(cl.inflight, key)
+		}
+		cl.lock.Unlock()
+		if running != nil {
+			close(running.done)
+		}
+	}()
+
+	res := run(ctx)
+	if running != nil && res != nil {
+		// store a copy, the caller may still modify its result while the waiters read theirs
+		running.result = copyCheckResult(res)
+	}
+
+	return res
+}
+
+// acquire waits for a free slot, must be called with lock held.
+func (cl *CheckLimiter) acquire(ctx context.Context, name string) error {
+	conf := cl.conf
+	if cl.fits(name) {
+		cl.start(name)
+
+		return nil
+	}
+
+	if cl.queued >= conf.maxQueue {
+		promCheckRejectedTotal.WithLabelValues("queue_full").Inc()
+		log.Warnf("rejected check %s: %d checks running and queue is full", name, cl.running)
+
+		return fmt.Errorf("too many concurrent checks, queue is full (check the max queue length option)")
+	}
+
+	cl.queued++
+	promCheckQueueLength.Set(float64(cl.queued))
+	defer func() {
+		cl.queued--
+		promCheckQueueLength.Set(float64(cl.queued))
+	}()
+
+	timer := time.NewTimer(conf.queueTimeout)
+	defer timer.Stop()
+	for {
+		released := cl.released
+		cl.lock.Unlock()
+		select {
+		case <-released:
+		case <-timer.C:
+			cl.lock.Lock()
+			promCheckRejectedTotal.WithLabelValues("timeout").Inc()
+			log.Warnf("rejected check %s: no free slot within %s", name, conf.queueTimeout.String())
+
+			return fmt.Errorf("too many concurrent checks, timeout while waiting in queue (check the queue timeout option)")
+		case <-ctx.Done():
+			cl.lock.Lock()
+			promCheckRejectedTotal.WithLabelValues("canceled").Inc()
+
+			return fmt.Errorf("request canceled while waiting in queue: %s", ctx.Err().Error())
+		}
+		cl.lock.Lock()
+		if cl.fits(name) {
+			cl.start(name)
+
+			return nil
+		}
+	}
+}
+
+// fits returns true if the check can be started without exceeding the limits, must be called with lock held.
+func (cl *CheckLimiter) fits(name string) bool {
+	if cl.conf.maxConcurrent > 0 && cl.running >= cl.conf.maxConcurrent {
+		return false
+	}
+
+	if cl.conf.maxPerCommand > 0 && cl.commands[name] >= cl.conf.maxPerCommand {
+		return false
+	}
+
+	return true
+}
+
+// start marks the check as running, must be called with lock held.
+func (cl *CheckLimiter) start(name string) {
+	cl.running++
+	cl.commands[name]++
+	promCheckRunning.Set(float64(cl.running))
+}
+
+// release frees the slot and wakes up queued checks, must be called with lock held.
+func (cl *CheckLimiter) release(name string) {
+	cl.running--
+	cl.commands[name]--
+	if cl.commands[name] <= 0 {
+		delete(cl.commands, name)
+	}
+	promCheckRunning.Set(float64(cl.running))
+
+	close(cl.released)
+	cl.released = make(chan struct{})
+}
+
+// wait returns a copy of the result once the check has finished.
+func (ic *inflightCheck) wait(ctx context.Context) *CheckResult {
+	select {
+	case <-ic.done:
+	case <-ctx.Done():
+		return &CheckResult{
+			State:  CheckExitUnknown,
+			Output: fmt.Sprintf("${status} - request canceled while waiting for result: %s", ctx.Err().Error()),
+		}
+	}
+
+	if ic.result == nil {
+		return &CheckResult{
+			State:  CheckExitUnknown,
+			Output: "${status} - coalesced check did not return a result",
+		}
+	}
+
+	return copyCheckResult(ic.result)
+}
+
+// copyCheckResult returns a shallow copy of given result with its own list of metrics.
+func copyCheckResult(res *CheckResult) *CheckResult {
+	clone := *res
+	clone.Metrics = append([]*CheckMetric{}, res.Metrics...)
+
+	return &clone
+}
@@ -0,0 +1,113 @@
+package snclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLimiter(t *testing.T) {
+	conf := NewConfig(true)
+	section := conf.Section(CheckLimitSection)
+	section.Set("max concurrent checks", "1")
+	section.Set("max queue length", "1")
+	section.Set("queue timeout", "100ms")
+	section.Set("coalesce requests", "false")
+	limitConf, err := NewCheckLimitConfig(section)
+	require.NoError(t, err)
+
+	limiter := NewCheckLimiter()
+	limiter.SetConfig(limitConf)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	blocking := func(_ context.Context) *CheckResult {
+		close(started)
+		<-block
+
+		return &CheckResult{State: CheckExitOK, Output: "ok"}
+	}
+
+	done := make(chan *CheckResult)
+	go func() {
+		done <- limiter.Run(context.Background(), "check_dummy", []string{"0"}, blocking)
+	}()
+	<-started
+
+	// second check waits in the queue and times out
+	res := limiter.Run(context.Background(), "check_dummy", []string{"1"}, func(_ context.Context) *CheckResult {
+		t.Errorf("check must not run")
+
+		return nil
+	})
+	assert.Equalf(t, CheckExitUnknown, res.State, "queued check timed out")
+	assert.Containsf(t, res.Output, "timeout while waiting in queue", "timeout output")
+
+	// fill the queue, the next check is rejected immediately
+	limiter.SetConfig(&CheckLimitConfig{maxConcurrent: 1, maxQueue: 1, queueTimeout: 5 * time.Second})
+	queued := make(chan *CheckResult)
+	go func() {
+		queued <- limiter.Run(context.Background(), "check_dummy", []string{"2"}, func(_ context.Context) *CheckResult {
+			return &CheckResult{State: CheckExitWarning}
+		})
+	}()
+	require.Eventuallyf(t, func() bool {
+		limiter.lock.Lock()
+		defer limiter.lock.Unlock()
+
+		return limiter.queued == 1
+	}, 5*time.Second, 5*time.Millisecond, "check is queued")
+
+	res = limiter.Run(context.Background(), "check_dummy", []string{"3"}, blocking)
+	assert.Equalf(t, CheckExitUnknown, res.State, "check rejected")
+	assert.Containsf(t, res.Output, "queue is full", "queue full output")
+
+	close(block)
+	assert.Equalf(t, CheckExitOK, (<-done).State, "first check finished")
+	assert.Equalf(t, CheckExitWarning, (<-queued).State, "queued check runs once a slot is free")
+}
+
+func TestCheckLimiterCoalesce(t *testing.T) {
+	limiter := NewCheckLimiter()
+	limiter.SetConfig(&CheckLimitConfig{coalesce: true})
+
+	var runs atomic.Int64
+	block := make(chan struct{})
+	run := func(_ context.Context) *CheckResult {
+		runs.Add(1)
+		<-block
+
+		return &CheckResult{State: CheckExitCritical, Output: "${status} - shared"}
+	}
+
+	results := make([]*CheckResult, 5)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = limiter.Run(context.Background(), "check_dummy", []string{"2"}, run)
+		}(i)
+	}
+	require.Eventuallyf(t, func() bool {
+		limiter.lock.Lock()
+		defer limiter.lock.Unlock()
+		for _, running := range limiter.inflight {
+			return running.waiting == int64(len(results)-1)
+		}
+
+		return false
+	}, 5*time.Second, 5*time.Millisecond, "identical checks are waiting")
+	close(block)
+	wg.Wait()
+
+	assert.Equalf(t, int64(1), runs.Load(), "identical checks ran once")
+	for _, res := range results {
+		assert.Equalf(t, CheckExitCritical, res.State, "result is shared")
+	}
+}
@@ -0,0 +1,268 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pkg/convert"
+)
+
+func init() {
+	AvailableChecks["check_logfile"] = CheckEntry{"check_logfile", NewCheckLogFile}
+}
+
+// logFileStatePrefix is the prefix of the state store entries which contain the read positions.
+const logFileStatePrefix = "logfile"
+
+type CheckLogFile struct {
+	files     []string
+	fileList  CommaStringList
+	showLast  int64
+	fromStart bool
+}
+
+// logFileOffset is the saved read position of a single file.
+type logFileOffset struct {
+	inode  uint64
+	offset int64
+}
+
+func NewCheckLogFile() CheckHandler {
+	return &CheckLogFile{
+		fileList: CommaStringList{},
+		showLast: 10,
+	}
+}
+
+func (l *CheckLogFile) Build() *CheckData {
+	return &CheckData{
+		name: "check_logfile",
+		description: `Checks text log files for new lines.
+
+The read position of each file is saved between check runs, so only lines added since the last run are checked.
+Rotated files are detected by inode, or by file index on Windows (the rest of the rotated file is read if it can be
+found next to the file) and truncated files are read from the start.
+The read positions are stored per file in the state file, so changing filters or thresholds does
+not reset them. Checks reading the same file share its read position.`,
+		implemented: ALL,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		hasInventory: NoCallInventory,
+		args: map[string]CheckArgument{
+			"file":       {value: &l.files, description: "File or file pattern to read (can be specified multiple times)"},
+			"files":      {value: &l.fileList, description: "A comma separated list of files or file patterns"},
+			"show-last":  {value: &l.showLast, description: "Number of last matching lines shown in the detail list (default 10, 0 shows all)"},
+			"from-start": {value: &l.fromStart, description: "Read files from the start if there is no saved read position yet, otherwise start at the end (default false)"},
+		},
+		defaultWarning: "count > 0",
+		detailSyntax:   "%(line)",
+		okSyntax:       "%(status) - No new matching lines",
+		topSyntax:      "%(status) - %(count) new matching line(s): %(list)",
+		emptySyntax:    "%(status) - No new matching lines",
+		emptyState:     CheckExitOK,
+		attributes: []CheckAttribute{
+			{name: "file", description: "Path of the log file"},
+			{name: "filename", description: "Name of the log file"},
+			{name: "line", description: "The line without trailing newline"},
+		},
+		exampleDefault: `
+    check_logfile file=/var/log/syslog "filter=line like 'error'" "crit=count > 10"
+    WARNING - 2 new matching line(s): ... error ..., ... error ... |'count'=2;0;10;0
+	`,
+		exampleArgs: `'file=/var/log/*.log' 'filter=line ~ /(error|fatal)/i' 'warn=count > 0' 'crit=count > 10'`,
+	}
+}
+
+func (l *CheckLogFile) Check(_ context.Context, _ *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	l.files = append(l.files, l.fileList...)
+	if len(l.files) == 0 {
+		return nil, fmt.Errorf("no file specified")
+	}
+	check.listLimit = l.showLast
+
+	files := []string{}
+	for _, pattern := range l.files {
+		pattern = strings.TrimSpace(pattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %s: %s", pattern, err.Error())
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("%s: no such file", pattern)
+		}
+		files = append(files, matches...)
+	}
+
+	for _, file := range files {
+		err := l.checkFile(check, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	check.result.Metrics = append(check.result.Metrics, &CheckMetric{
+		Name:     "count",
+		Value:    len(check.listData),
+		Warning:  check.warnThreshold,
+		Critical: check.critThreshold,
+		Min:      &Zero,
+	})
+
+	return check.Finalize()
+}
+
+// checkFile reads the new lines of given file and updates its read position.
+// Read positions are stored per file, so changing filters or thresholds does not reset them.
+func (l *CheckLogFile) checkFile(check *CheckData, file string) error {
+	if check.stateStore == nil {
+		_, err := l.readFile(check, file, nil)
+
+		return err
+	}
+
+	stateName := logFileStatePrefix + " " + file
+	unlock := check.stateStore.LockEntry(stateName)
+	defer unlock()
+
+	var prev *logFileOffset
+	if entry := check.stateStore.Get(stateName); entry != nil {
+		if saved, ok := entry.Entries[file]; ok {
+			inode, _ := strconv.ParseUint(saved["inode"], 10, 64)
+			prev = &logFileOffset{
+				inode:  inode,
+				offset: convert.Int64(saved["offset"]),
+			}
+		}
+	}
+
+	pos, err := l.readFile(check, file, prev)
+	if err != nil {
+		return err
+	}
+
+	err = check.stateStore.Set(stateName, &StateStoreEntry{
+		Key: "file",
+		Entries: map[string]map[string]string{
+			file: {
+				"inode":  fmt.Sprintf("%d", pos.inode),
+				"offset": fmt.Sprintf("%d", pos.offset),
+			},
+		},
+	})
+	if err != nil {
+		log.Warnf("%s", err.Error())
+	}
+
+	return nil
+}
+
+// readFile reads all new lines of given file and returns the new read position.
+func (l *CheckLogFile) readFile(check *CheckData, file string, prev *logFileOffset) (*logFileOffset, error) {
+	fileInfo, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	if fileInfo.IsDir() {
+		return nil, fmt.Errorf("%s: is a directory", file)
+	}
+
+	pos := &logFileOffset{inode: logFileInode(file, fileInfo)}
+	switch {
+	case prev == nil:
+		if !l.fromStart {
+			pos.offset = fileInfo.Size()
+
+			return pos, nil
+		}
+	case prev.inode != pos.inode:
+		// file has been rotated, read remaining lines from the rotated file
+		if rotated := findRotatedLogFile(file, prev.inode); rotated != "" {
+			log.Debugf("%s has been rotated to %s", file, rotated)
+			if _, err := l.readLines(check, file, rotated, prev.offset); err != nil {
+				log.Debugf("failed to read rotated file %s: %s", rotated, err.Error())
+			}
+		}
+	case fileInfo.Size() < prev.offset:
+		log.Debugf("%s has been truncated", file)
+	default:
+		pos.offset = prev.offset
+	}
+
+	pos.offset, err = l.readLines(check, file, file, pos.offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return pos, nil
+}
+
+// readLines adds all complete lines starting at offset to the list data and returns the offset after the last complete line.
+func (l *CheckLogFile) readLines(check *CheckData, name, file string, offset int64) (int64, error) {
+	handle, err := os.Open(file)
+	if err != nil {
+		return offset, fmt.Errorf("%s: %s", file, err.Error())
+	}
+	defer handle.Close()
+
+	_, err = handle.Seek(offset, io.SeekStart)
+	if err != nil {
+		return offset, fmt.Errorf("%s: seek failed: %s", file, err.Error())
+	}
+
+	reader := bufio.NewReader(handle)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// incomplete lines will be read in the next run
+				return offset, nil
+			}
+
+			return offset, fmt.Errorf("%s: read failed: %s", file, err.Error())
+		}
+		offset += int64(len(line))
+
+		entry := map[string]string{
+			"file":     name,
+			"filename": filepath.Base(name),
+			"line":     strings.TrimRight(line, "\r\n"),
+		}
+		if !check.MatchMapCondition(check.filter, entry, true) {
+			continue
+		}
+		check.listData = append(check.listData, entry)
+	}
+}
+
+// findRotatedLogFile returns the rotated file with given inode, ex.: file.1, file.old or file-20240101.
+func findRotatedLogFile(file string, inode uint64) string {
+	if inode == 0 {
+		return ""
+	}
+
+	// check the name used by our own logrotate task first
+	candidates := []string{rotatedLogFileName(file)}
+	for _, pattern := range []string{file + ".*", file + "-*"} {
+		matches, _ := filepath.Glob(pattern)
+		candidates = append(candidates, matches...)
+	}
+	for _, candidate := range candidates {
+		fileInfo, err := os.Stat(candidate)
+		if err != nil || fileInfo.IsDir() {
+			continue
+		}
+		if logFileInode(candidate, fileInfo) == inode {
+			return candidate
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package snclient
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// logFileInode returns the inode of given file to detect rotations.
+func logFileInode(_ string, fileInfo fs.FileInfo) uint64 {
+	fileInfoSys, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return uint64(fileInfoSys.Ino) //nolint:unconvert // variable is platform specific
+}
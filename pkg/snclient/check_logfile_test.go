@@ -0,0 +1,99 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pkg/convert"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLogFile(t *testing.T) {
+	snc := StartTestAgent(t, "")
+	snc.stateStore = NewStateStore(filepath.Join(t.TempDir(), "snclient.state"))
+
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	appendLines := func(lines string) {
+		t.Helper()
+		handle, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		require.NoError(t, err)
+		_, err = handle.WriteString(lines)
+		require.NoError(t, err)
+		require.NoError(t, handle.Close())
+	}
+	appendLines("old error\n")
+
+	res := snc.RunCheck("check_logfile", []string{})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Contains(t, string(res.BuildPluginOutput()), "UNKNOWN - no file specified")
+
+	res = snc.RunCheck("check_logfile", []string{"file=" + logFile + ".missing"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Contains(t, string(res.BuildPluginOutput()), "no such file")
+
+	args := []string{"file=" + logFile, "filter=line like 'error'", "crit=count > 2", "show-last=2"}
+
+	// first run starts at the end of the file
+	res = snc.RunCheck("check_logfile", args)
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	assert.Equalf(t, "OK - No new matching lines |'count'=0;0;2;0", string(res.BuildPluginOutput()), "output matches")
+
+	appendLines("first error\nsome info\nsecond error\nincomplete error")
+	res = snc.RunCheck("check_logfile", args)
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	assert.Equalf(t, "WARNING - 2 new matching line(s): first error, second error |'count'=2;0;2;0",
+		string(res.BuildPluginOutput()), "output matches")
+
+	appendLines(" line\nthird error\nfourth error\n")
+	res = snc.RunCheck("check_logfile", args)
+	assert.Equalf(t, CheckExitCritical, res.State, "state Critical")
+	assert.Equalf(t, "CRITICAL - 3 new matching line(s): third error, fourth error |'count'=3;0;2;0",
+		string(res.BuildPluginOutput()), "only last lines are shown")
+
+	// rotated file is read to the end
+	appendLines("error before rotation\n")
+	require.NoError(t, os.Rename(logFile, logFile+".1"))
+	appendLines("error after rotation\n")
+	res = snc.RunCheck("check_logfile", args)
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	assert.Equalf(t, "WARNING - 2 new matching line(s): error before rotation, error after rotation |'count'=2;0;2;0",
+		string(res.BuildPluginOutput()), "output matches")
+
+	// truncated file is read from the start
+	require.NoError(t, os.Truncate(logFile, 0))
+	appendLines("truncated error\n")
+	res = snc.RunCheck("check_logfile", args)
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	assert.Equalf(t, "WARNING - 1 new matching line(s): truncated error |'count'=1;0;2;0",
+		string(res.BuildPluginOutput()), "output matches")
+
+	res = snc.RunCheck("check_logfile", args)
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+
+	// read position does not depend on thresholds or filters
+	appendLines("error with other thresholds\n")
+	res = snc.RunCheck("check_logfile", []string{"file=" + logFile, "warn=count > 5", "diff-key=file"})
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "|'count'=1;5;;0", "new line is found")
+
+	// concurrent runs report each line once
+	appendLines("first concurrent error\nsecond concurrent error\n")
+	runs := 5
+	counts := make(chan int32, runs)
+	for i := 0; i < runs; i++ {
+		go func() {
+			res := snc.RunCheck("check_logfile", args)
+			counts <- convert.Int(res.Metrics[0].Value)
+		}()
+	}
+	total := int32(0)
+	for i := 0; i < runs; i++ {
+		total += <-counts
+	}
+	assert.Equalf(t, int32(2), total, "lines are not reported twice")
+
+	StopTestAgent(t, snc)
+}
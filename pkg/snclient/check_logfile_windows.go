@@ -0,0 +1,24 @@
+package snclient
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// logFileInode returns the file index of given file to detect rotations, it stays the same if the file gets renamed.
+func logFileInode(file string, _ fs.FileInfo) uint64 {
+	handle, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer handle.Close()
+
+	var info syscall.ByHandleFileInformation
+	err = syscall.GetFileInformationByHandle(syscall.Handle(handle.Fd()), &info)
+	if err != nil {
+		return 0
+	}
+
+	return uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)
+}
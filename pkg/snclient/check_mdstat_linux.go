@@ -0,0 +1,276 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"pkg/convert"
+	"pkg/humanize"
+
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	AvailableChecks["check_mdstat"] = CheckEntry{"check_mdstat", NewCheckMdstat}
+}
+
+// procMdstatPath contains the state of the linux software raid arrays
+var procMdstatPath = "/proc/mdstat"
+
+var (
+	// matches the device status, ex.: [2/1] [U_]
+	reMdstatStatus = regexp.MustCompile(`\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
+
+	// matches the sync progress, ex.: recovery = 12.6% (132096/1046528) finish=0.9min speed=16512K/sec
+	reMdstatSync = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*([\d.]+)%.*?(?:finish=(\S+))?(?:\s+speed=(\S+))?$`)
+
+	// matches delayed or pending syncs, ex.: resync=DELAYED
+	reMdstatSyncPending = regexp.MustCompile(`(resync|recovery|reshape|check|repair)\s*=\s*(DELAYED|PENDING)`)
+)
+
+type CheckMdstat struct {
+	devices []string
+}
+
+func NewCheckMdstat() CheckHandler {
+	return &CheckMdstat{}
+}
+
+func (l *CheckMdstat) Build() *CheckData {
+	return &CheckData{
+		name:         "check_mdstat",
+		description:  "Checks the state of linux software raid arrays from /proc/mdstat.",
+		implemented:  Linux,
+		hasInventory: ListInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"device": {value: &l.devices, isFilter: true, description: "Show this array only, ex.: md0"},
+		},
+		defaultWarning:  "sync_action in ('resync', 'recovery', 'reshape')",
+		defaultCritical: "state != 'active' || degraded > 0 || failed_devices > 0",
+		topSyntax:       "%(status) - %(list)",
+		detailSyntax:    "%(device) %(level) [%(status_flags)]%(sync)",
+		okSyntax:        "%(status) - All %(count) array(s) are ok",
+		emptyState:      CheckExitOK,
+		emptySyntax:     "%(status) - no software raid arrays found",
+		attributes: []CheckAttribute{
+			{name: "device", description: "name of the array, ex.: md0"},
+			{name: "state", description: "state of the array, ex.: active or inactive"},
+			{name: "readonly", description: "1 if the array is read-only"},
+			{name: "level", description: "raid level, ex.: raid1"},
+			{name: "size", description: "size of the array in bytes"},
+			{name: "size_human", description: "size of the array (human readable)"},
+			{name: "devices", description: "number of devices the array should have"},
+			{name: "active_devices", description: "number of active devices"},
+			{name: "degraded", description: "number of missing devices"},
+			{name: "failed_devices", description: "number of failed devices"},
+			{name: "spare_devices", description: "number of spare devices"},
+			{name: "status_flags", description: "device status flags, ex.: UU_"},
+			{name: "sync_action", description: "running sync action, ex.: resync, recovery, reshape or check"},
+			{name: "resync_pct", description: "progress of the sync action in percent, 100 if no sync is running"},
+			{name: "resync_finish", description: "estimated time until the sync action finishes, ex.: 0.9min"},
+			{name: "resync_speed", description: "speed of the sync action, ex.: 16512K/sec"},
+			{name: "sync", description: "sync action and progress in human readable form"},
+		},
+		exampleDefault: `
+    check_mdstat
+    OK - All 2 array(s) are ok |'md0 degraded'=0;;;0 'md0 failed'=0;;;0 'md0 resync'=100%;;;0;100 ...
+
+Show details of a degraded array:
+
+    check_mdstat device=md1
+    CRITICAL - md1 raid5 [UU_] recovery 12.6% |'md1 degraded'=1;;;0 'md1 failed'=1;;;0 'md1 resync'=12.6%;;;0;100
+	`,
+		exampleArgs: `'crit=degraded > 0'`,
+	}
+}
+
+func (l *CheckMdstat) Check(_ context.Context, _ *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	mdstatFile, err := os.Open(procMdstatPath)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %s (is the md kernel module loaded?)", procMdstatPath, err.Error())
+	}
+	defer mdstatFile.Close()
+
+	arrays, err := l.parseMdstat(mdstatFile)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %s", procMdstatPath, err.Error())
+	}
+
+	for _, entry := range arrays {
+		if len(l.devices) > 0 && !slices.Contains(l.devices, entry["device"]) {
+			continue
+		}
+
+		if !check.MatchMapCondition(check.filter, entry, true) {
+			continue
+		}
+
+		check.listData = append(check.listData, entry)
+		l.addMetrics(check, entry)
+	}
+
+	return check.Finalize()
+}
+
+// parseMdstat returns one entry per array. The format is:
+//
+//	md1 : active raid5 sdc1[3] sdb2[1] sda2[0] sdd1[4](F)
+//	      2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+//	      [==>..................]  recovery = 12.6% (132096/1046528) finish=0.9min speed=16512K/sec
+func (l *CheckMdstat) parseMdstat(reader io.Reader) ([]map[string]string, error) {
+	arrays := []map[string]string{}
+	var entry map[string]string
+
+	fileScanner := bufio.NewScanner(reader)
+	for fileScanner.Scan() {
+		line := fileScanner.Text()
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case strings.HasPrefix(line, "Personalities"), strings.HasPrefix(line, "unused devices"):
+			continue
+		case len(fields) >= 3 && fields[1] == ":":
+			entry = l.parseArrayLine(fields)
+			arrays = append(arrays, entry)
+		case entry == nil:
+			continue
+		case strings.Contains(line, " blocks"):
+			l.parseBlocksLine(entry, line, fields)
+		default:
+			l.parseSyncLine(entry, line)
+		}
+	}
+	if err := fileScanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan failed: %s", err.Error())
+	}
+
+	return arrays, nil
+}
+
+// parseArrayLine parses the first line of an array, ex.: md0 : active (auto-read-only) raid1 sdb1[1] sda1[0]
+func (l *CheckMdstat) parseArrayLine(fields []string) map[string]string {
+	entry := map[string]string{
+		"device":         fields[0],
+		"state":          fields[2],
+		"readonly":       "0",
+		"level":          "",
+		"size":           "0",
+		"size_human":     "0 B",
+		"devices":        "0",
+		"active_devices": "0",
+		"degraded":       "0",
+		"failed_devices": "0",
+		"spare_devices":  "0",
+		"status_flags":   "",
+		"sync_action":    "",
+		"resync_pct":     "100",
+		"resync_finish":  "",
+		"resync_speed":   "",
+		"sync":           "",
+	}
+
+	members := 0
+	for _, field := range fields[3:] {
+		switch {
+		case strings.HasPrefix(field, "("):
+			if strings.Contains(field, "read-only") {
+				entry["readonly"] = "1"
+			}
+		case strings.HasPrefix(field, "raid"), field == "linear", field == "multipath", field == "faulty":
+			entry["level"] = field
+		case strings.Contains(field, "["):
+			members++
+			switch {
+			case strings.HasSuffix(field, "(F)"):
+				entry["failed_devices"] = fmt.Sprintf("%d", convert.Int64(entry["failed_devices"])+1)
+			case strings.HasSuffix(field, "(S)"):
+				entry["spare_devices"] = fmt.Sprintf("%d", convert.Int64(entry["spare_devices"])+1)
+			}
+		}
+	}
+	entry["devices"] = fmt.Sprintf("%d", members)
+	entry["active_devices"] = fmt.Sprintf("%d", members-int(convert.Int64(entry["failed_devices"]))-int(convert.Int64(entry["spare_devices"])))
+
+	return entry
+}
+
+// parseBlocksLine parses the size and device status, ex.: 1046528 blocks super 1.2 [2/1] [U_]
+func (l *CheckMdstat) parseBlocksLine(entry map[string]string, line string, fields []string) {
+	// size is given in 1k blocks
+	size := convert.Int64(fields[0]) * 1024
+	entry["size"] = fmt.Sprintf("%d", size)
+	entry["size_human"] = humanize.IBytes(uint64(size))
+
+	matches := reMdstatStatus.FindStringSubmatch(line)
+	if len(matches) < 4 {
+		return
+	}
+
+	total := convert.Int64(matches[1])
+	active := convert.Int64(matches[2])
+	entry["devices"] = matches[1]
+	entry["active_devices"] = matches[2]
+	entry["degraded"] = fmt.Sprintf("%d", total-active)
+	entry["status_flags"] = matches[3]
+}
+
+// parseSyncLine parses the sync progress, ex.: [==>......]  recovery = 12.6% (132096/1046528) finish=0.9min speed=16512K/sec
+func (l *CheckMdstat) parseSyncLine(entry map[string]string, line string) {
+	line = strings.TrimSpace(line)
+	if matches := reMdstatSync.FindStringSubmatch(line); len(matches) == 5 {
+		entry["sync_action"] = matches[1]
+		entry["resync_pct"] = matches[2]
+		entry["resync_finish"] = matches[3]
+		entry["resync_speed"] = matches[4]
+		entry["sync"] = fmt.Sprintf(" %s %s%%", matches[1], matches[2])
+
+		return
+	}
+
+	if matches := reMdstatSyncPending.FindStringSubmatch(line); len(matches) == 3 {
+		entry["sync_action"] = matches[1]
+		entry["resync_pct"] = "0"
+		entry["sync"] = fmt.Sprintf(" %s %s", matches[1], strings.ToLower(matches[2]))
+	}
+}
+
+func (l *CheckMdstat) addMetrics(check *CheckData, entry map[string]string) {
+	device := entry["device"]
+	check.result.Metrics = append(check.result.Metrics,
+		&CheckMetric{
+			ThresholdName: "degraded",
+			Name:          device + " degraded",
+			Value:         convert.Int64(entry["degraded"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		},
+		&CheckMetric{
+			ThresholdName: "failed_devices",
+			Name:          device + " failed",
+			Value:         convert.Int64(entry["failed_devices"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		},
+		&CheckMetric{
+			ThresholdName: "resync_pct",
+			Name:          device + " resync",
+			Unit:          "%",
+			Value:         convert.Float64(entry["resync_pct"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &Hundred,
+		},
+	)
+}
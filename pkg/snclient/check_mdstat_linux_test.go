@@ -0,0 +1,47 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMdstat(t *testing.T) {
+	mdstat := `Personalities : [raid1] [raid6] [raid5] [raid4]
+md1 : active raid5 sdc1[3] sdb2[1] sda2[0] sdd1[4](F)
+      2093056 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+      [==>..................]  recovery = 12.6% (132096/1046528) finish=0.9min speed=16512K/sec
+
+md0 : active raid1 sdb1[1] sda1[0] sde1[2](S)
+      1046528 blocks super 1.2 [2/2] [UU]
+
+unused devices: <none>
+`
+	fixture := filepath.Join(t.TempDir(), "mdstat")
+	require.NoError(t, os.WriteFile(fixture, []byte(mdstat), 0o600))
+	defer func(path string) { procMdstatPath = path }(procMdstatPath)
+	procMdstatPath = fixture
+
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheck("check_mdstat", []string{})
+	assert.Equalf(t, CheckExitCritical, res.State, "degraded array is critical")
+	output := string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "CRITICAL - md1 raid5 [UU_] recovery 12.6%, md0 raid1 [UU] |", "output matches")
+	assert.Containsf(t, output, "'md1 degraded'=1;;0;0", "degraded perfdata")
+	assert.Containsf(t, output, "'md1 resync'=12.6%;;;0;100", "resync perfdata")
+
+	res = snc.RunCheck("check_mdstat", []string{"device=md0"})
+	assert.Equalf(t, CheckExitOK, res.State, "healthy array is ok")
+	assert.Equalf(t, "OK - All 1 array(s) are ok |'md0 degraded'=0;;0;0 'md0 failed'=0;;0;0 'md0 resync'=100%;;;0;100", string(res.BuildPluginOutput()), "output matches")
+
+	res = snc.RunCheck("check_mdstat", []string{"device=md1", "top-syntax=${list}", "detail-syntax=${failed_devices} ${spare_devices} ${active_devices}/${devices} ${size_human} ${resync_finish}"})
+	assert.Equalf(t, "1 0 2/3 2044 MiB 0.9min", res.Output, "attributes match")
+
+	res = snc.RunCheck("check_mdstat", []string{"device=md0", "top-syntax=${list}", "detail-syntax=${spare_devices} ${active_devices}/${devices}"})
+	assert.Equalf(t, "1 2/2", res.Output, "spare devices are counted")
+}
@@ -0,0 +1,15 @@
+package snclient
+
+import "pkg/check_nrpe"
+
+func init() {
+	AvailableChecks["check_nrpe"] = CheckEntry{"check_nrpe", NewCheckNRPE}
+}
+
+func NewCheckNRPE() CheckHandler {
+	return &CheckBuiltin{
+		name:        "check_nrpe",
+		description: "Runs check_nrpe to query remote nrpe agents.",
+		check:       check_nrpe.Check,
+	}
+}
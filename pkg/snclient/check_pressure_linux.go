@@ -0,0 +1,163 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pkg/convert"
+
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	AvailableChecks["check_pressure"] = CheckEntry{"check_pressure", NewCheckPressure}
+}
+
+// procPressurePath contains the pressure stall information files
+var procPressurePath = "/proc/pressure"
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+type CheckPressure struct {
+	resources []string
+}
+
+func NewCheckPressure() CheckHandler {
+	return &CheckPressure{}
+}
+
+func (l *CheckPressure) Build() *CheckData {
+	return &CheckData{
+		name:         "check_pressure",
+		description:  "Checks the linux pressure stall information (PSI) of cpu, memory and io.",
+		implemented:  Linux,
+		hasInventory: ListInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"resource": {value: &l.resources, isFilter: true, description: "Show this resource only, can be: cpu, memory or io"},
+		},
+		defaultWarning:  "some_avg60 > 30",
+		defaultCritical: "some_avg60 > 60",
+		topSyntax:       "%(status) - %(list)",
+		detailSyntax:    "%(resource) %(some_avg60:fmt=%.1f)%",
+		emptyState:      CheckExitUnknown,
+		emptySyntax:     "%(status) - no pressure stall information found, kernel must be built with CONFIG_PSI",
+		attributes: []CheckAttribute{
+			{name: "resource", description: "name of the resource, can be: cpu, memory or io"},
+			{name: "some_avg10", description: "percentage of time at least some tasks were stalled over the last 10 seconds"},
+			{name: "some_avg60", description: "percentage of time at least some tasks were stalled over the last 60 seconds"},
+			{name: "some_avg300", description: "percentage of time at least some tasks were stalled over the last 300 seconds"},
+			{name: "some_total", description: "total time in microseconds at least some tasks were stalled"},
+			{name: "full_avg10", description: "percentage of time all non-idle tasks were stalled over the last 10 seconds"},
+			{name: "full_avg60", description: "percentage of time all non-idle tasks were stalled over the last 60 seconds"},
+			{name: "full_avg300", description: "percentage of time all non-idle tasks were stalled over the last 300 seconds"},
+			{name: "full_total", description: "total time in microseconds all non-idle tasks were stalled"},
+		},
+		exampleDefault: `
+    check_pressure
+    OK - cpu 2.1%, memory 0.0%, io 0.3% |'cpu_some_avg10'=1.5%;;;0;100 'cpu_some_avg60'=2.1%;30;60;0;100 ...
+
+Alert if all tasks were stalled on memory for more than 5% of the last minute:
+
+    check_pressure resource=memory warn="full_avg60 > 5" crit="full_avg60 > 10"
+    OK - memory 0.0% |...
+	`,
+		exampleArgs: `'warn=some_avg60 > 30' 'crit=some_avg60 > 60'`,
+	}
+}
+
+func (l *CheckPressure) Check(_ context.Context, _ *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	for _, res := range l.resources {
+		if !slices.Contains(pressureResources, res) {
+			return nil, fmt.Errorf("unknown resource %s, must be one of: %s", res, strings.Join(pressureResources, ", "))
+		}
+	}
+
+	for _, res := range pressureResources {
+		if len(l.resources) > 0 && !slices.Contains(l.resources, res) {
+			continue
+		}
+
+		entry, err := l.readPressure(res)
+		if err != nil {
+			log.Debugf("check_pressure: %s", err.Error())
+
+			continue
+		}
+
+		if !check.MatchMapCondition(check.filter, entry, true) {
+			continue
+		}
+
+		check.listData = append(check.listData, entry)
+		l.addMetrics(check, entry)
+	}
+
+	return check.Finalize()
+}
+
+// readPressure parses a pressure file like:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func (l *CheckPressure) readPressure(resource string) (map[string]string, error) {
+	file := filepath.Join(procPressurePath, resource)
+	pressureFile, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %s", file, err.Error())
+	}
+	defer pressureFile.Close()
+
+	entry := map[string]string{
+		"resource": resource,
+	}
+	for _, kind := range []string{"some", "full"} {
+		for _, key := range []string{"avg10", "avg60", "avg300", "total"} {
+			entry[kind+"_"+key] = "0"
+		}
+	}
+
+	fileScanner := bufio.NewScanner(pressureFile)
+	for fileScanner.Scan() {
+		fields := strings.Fields(fileScanner.Text())
+		if len(fields) < 2 || (fields[0] != "some" && fields[0] != "full") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			entry[fields[0]+"_"+key] = val
+		}
+	}
+	if err := fileScanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %s", file, err.Error())
+	}
+
+	return entry, nil
+}
+
+func (l *CheckPressure) addMetrics(check *CheckData, entry map[string]string) {
+	for _, kind := range []string{"some", "full"} {
+		for _, key := range []string{"avg10", "avg60", "avg300"} {
+			name := kind + "_" + key
+			check.result.Metrics = append(check.result.Metrics, &CheckMetric{
+				ThresholdName: name,
+				Name:          entry["resource"] + "_" + name,
+				Unit:          "%",
+				Value:         convert.Float64(entry[name]),
+				Warning:       check.warnThreshold,
+				Critical:      check.critThreshold,
+				Min:           &Zero,
+				Max:           &Hundred,
+			})
+		}
+	}
+}
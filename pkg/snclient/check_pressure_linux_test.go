@@ -0,0 +1,42 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPressure(t *testing.T) {
+	fixture := t.TempDir()
+	for name, data := range map[string]string{
+		"cpu":    "some avg10=1.50 avg60=2.10 avg300=1.00 total=12345\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory": "some avg10=0.00 avg60=0.00 avg300=0.00 total=100\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=50\n",
+		"io":     "some avg10=45.00 avg60=42.50 avg300=20.00 total=987654\nfull avg10=30.00 avg60=25.00 avg300=10.00 total=123456\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(fixture, name), []byte(data), 0o600))
+	}
+	defer func(path string) { procPressurePath = path }(procPressurePath)
+	procPressurePath = fixture
+
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheck("check_pressure", []string{})
+	assert.Equalf(t, CheckExitWarning, res.State, "io pressure exceeds warning")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "WARNING - cpu 2.1%, memory 0.0%, io 42.5% |", "output matches")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "'io_some_avg60'=42.5%;30;60;0;100", "perfdata matches")
+
+	res = snc.RunCheck("check_pressure", []string{"resource=io", "warn=full_avg60 > 20", "crit=full_avg60 > 50"})
+	assert.Equalf(t, CheckExitWarning, res.State, "full threshold applied")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "'io_full_avg60'=25%;20;50;0;100", "perfdata matches")
+
+	res = snc.RunCheck("check_pressure", []string{"resource=cpu"})
+	assert.Equalf(t, CheckExitOK, res.State, "cpu is ok")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "OK - cpu 2.1% |", "output matches")
+
+	res = snc.RunCheck("check_pressure", []string{"resource=disk"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "unknown resource")
+}
@@ -17,6 +17,7 @@ type CheckWrap struct {
 	commandString string
 	config        *ConfigSection
 	wrapped       bool
+	policy        *ArgumentPolicy // restricts the arguments if set
 }
 
 func (l *CheckWrap) Build() *CheckData {
@@ -34,11 +35,31 @@ func (l *CheckWrap) Build() *CheckData {
 	}
 }
 
+// ArgumentPolicy returns the argument policy of this script or nil.
+func (l *CheckWrap) ArgumentPolicy() *ArgumentPolicy {
+	return l.policy
+}
+
 // CheckWrap wraps existing scripts created by the ExternalScriptsHandler
 func (l *CheckWrap) Check(ctx context.Context, snc *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
 	l.snc = snc
 
-	macros := map[string]string{}
+	if l.policy != nil {
+		if err := l.policy.Verify(check.rawArgs); err != nil {
+			return l.policy.Result(err), nil
+		}
+		// values without explicit regex still have to pass the nasty characters check
+		if !checkNastyCharacters(l.config, "", l.policy.UncheckedArgs(check.rawArgs)) {
+			return &CheckResult{
+				State:  CheckExitUnknown,
+				Output: "Exception processing request: Request contained illegal characters (check the allow nasty characters option).",
+			}, nil
+		}
+	}
+
+	macros := map[string]string{
+		"IDENTITY": RequestIdentity(ctx),
+	}
 	for i := range check.rawArgs {
 		macros[fmt.Sprintf("ARG%d", i+1)] = check.rawArgs[i]
 	}
@@ -72,7 +93,12 @@ func (l *CheckWrap) Check(ctx context.Context, snc *Agent, check *CheckData, _ [
 		command = ReplaceRuntimeMacros(l.commandString, macros)
 	}
 
-	timeoutSeconds := check.timeout
+	return snc.runCachedCheck(ctx, cacheKey(l.name, []string{command}), l.config, check.timeout, func(ctx context.Context) *CheckResult {
+		return l.runCommand(ctx, command, check.timeout)
+	})
+}
+
+func (l *CheckWrap) runCommand(ctx context.Context, command string, timeoutSeconds float64) *CheckResult {
 	deadline, ok := ctx.Deadline()
 	if ok {
 		deadlineTimeoutSeconds := time.Until(deadline).Seconds()
@@ -93,5 +119,5 @@ func (l *CheckWrap) Check(ctx context.Context, snc *Agent, check *CheckData, _ [
 	return &CheckResult{
 		State:  exitCode,
 		Output: stdout,
-	}, nil
+	}
 }
@@ -0,0 +1,504 @@
+package snclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	AvailableChecks["check_x509"] = CheckEntry{"check_x509", NewCheckX509}
+}
+
+// x509CertExtensions contains the file extensions read from certificate directories.
+var x509CertExtensions = []string{".crt", ".pem", ".cer", ".der"}
+
+// x509StartTLSStep is a single request/response of a starttls exchange.
+type x509StartTLSStep struct {
+	send   string   // command sent to the server, empty to read the greeting
+	expect string   // prefix of the expected response line
+	fail   []string // prefixes of error responses
+}
+
+// x509StartTLS contains the supported starttls protocols.
+var x509StartTLS = map[string]struct {
+	port  string
+	steps []x509StartTLSStep
+}{
+	"smtp": {
+		port: "25",
+		steps: []x509StartTLSStep{
+			{expect: "220 ", fail: []string{"4", "5"}},
+			{send: "EHLO snclient\r\n", expect: "250 ", fail: []string{"4", "5"}},
+			{send: "STARTTLS\r\n", expect: "220", fail: []string{"4", "5"}},
+		},
+	},
+	"imap": {
+		port: "143",
+		steps: []x509StartTLSStep{
+			{expect: "* OK", fail: []string{"* BYE"}},
+			{send: "a1 STARTTLS\r\n", expect: "a1 OK", fail: []string{"a1 NO", "a1 BAD"}},
+		},
+	},
+	"pop3": {
+		port: "110",
+		steps: []x509StartTLSStep{
+			{expect: "+OK", fail: []string{"-ERR"}},
+			{send: "STLS\r\n", expect: "+OK", fail: []string{"-ERR"}},
+		},
+	},
+}
+
+type CheckX509 struct {
+	snc        *Agent
+	files      []string
+	fileList   CommaStringList
+	hosts      []string
+	starttls   string
+	serverName string
+	caFile     string
+}
+
+func NewCheckX509() CheckHandler {
+	return &CheckX509{
+		fileList: CommaStringList{},
+	}
+}
+
+func (l *CheckX509) Build() *CheckData {
+	return &CheckData{
+		name: "check_x509",
+		description: `Checks x509 certificates from files or remote tls endpoints.
+
+Files can be PEM or DER encoded, directories and globs are expanded. Remote endpoints
+are checked by a tls handshake, optionally after a STARTTLS exchange for smtp, imap or pop3.
+If neither file nor host is set, the certificates of the agents own ssl listeners are checked.`,
+		implemented:  ALL,
+		hasInventory: ListInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"file":       {value: &l.files, description: "Certificate file, directory or glob (can be specified multiple times)"},
+			"files":      {value: &l.fileList, description: "A comma separated list of certificate files, directories or globs"},
+			"host":       {value: &l.hosts, description: "Remote endpoint as host:port (can be specified multiple times)"},
+			"starttls":   {value: &l.starttls, description: "Use STARTTLS for remote endpoints, one of: smtp, imap or pop3"},
+			"servername": {value: &l.serverName, description: "Server name used for SNI and hostname verification (default is the host)"},
+			"ca":         {value: &l.caFile, description: "Additional CA certificates file used to verify the chain"},
+		},
+		defaultWarning:  "days_left < 30",
+		defaultCritical: "days_left < 14",
+		detailSyntax:    "%(source) expires in %(days_left) days",
+		topSyntax:       "%(status) - %(problem_list)",
+		okSyntax:        "%(status) - All %(count) certificate(s) are ok",
+		emptySyntax:     "%(status) - No certificates found",
+		emptyState:      CheckExitUnknown,
+		attributes: []CheckAttribute{
+			{name: "source", description: "File name or host:port of the certificate"},
+			{name: "subject", description: "Subject of the certificate"},
+			{name: "common_name", description: "Common name of the subject"},
+			{name: "issuer", description: "Issuer of the certificate"},
+			{name: "sans", description: "Comma separated list of subject alternative names"},
+			{name: "serial", description: "Serial number in hex"},
+			{name: "not_before", description: "Start of the validity period (unix timestamp)"},
+			{name: "not_after", description: "End of the validity period (unix timestamp)"},
+			{name: "days_left", description: "Number of days until the certificate expires"},
+			{name: "key_type", description: "Public key algorithm, ex.: RSA, ECDSA or Ed25519"},
+			{name: "key_size", description: "Public key size in bits"},
+			{name: "signature_algorithm", description: "Signature algorithm, ex.: SHA256-RSA"},
+			{name: "is_ca", description: "Certificate is a CA: 0 / 1"},
+			{name: "self_signed", description: "Certificate is self signed: 0 / 1"},
+			{name: "chain_length", description: "Number of certificates in the chain"},
+			{name: "chain_valid", description: "Certificate chain (and hostname for remote endpoints) could be verified: 0 / 1"},
+			{name: "chain_error", description: "Error message of the chain verification"},
+		},
+		exampleDefault: `
+    check_x509
+    OK - All 1 certificate(s) are ok |'/etc/snclient/server.crt'=3587d;30:;14:
+
+Check remote mail server with starttls and require a valid chain:
+
+    check_x509 host=mail.example.com:25 starttls=smtp 'crit=days_left < 14 or chain_valid = 0'
+    OK - All 1 certificate(s) are ok |'mail.example.com:25'=63d;30:;14:
+	`,
+		exampleArgs: `'file=/etc/ssl/certs/*.pem' 'warn=days_left < 30' 'crit=days_left < 7'`,
+	}
+}
+
+func (l *CheckX509) Check(ctx context.Context, snc *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	l.snc = snc
+	l.files = append(l.files, l.fileList...)
+	if l.starttls != "" {
+		l.starttls = strings.ToLower(l.starttls)
+		if _, ok := x509StartTLS[l.starttls]; !ok {
+			return nil, fmt.Errorf("unsupported starttls protocol %s, supported are: smtp, imap and pop3", l.starttls)
+		}
+	}
+
+	roots, err := l.rootPool()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(l.files) == 0 && len(l.hosts) == 0 {
+		l.files = l.listenerCertificates()
+	}
+
+	for _, pattern := range l.files {
+		err := l.addFiles(check, strings.TrimSpace(pattern), roots)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, host := range l.hosts {
+		entry := l.checkHost(ctx, check, strings.TrimSpace(host), roots)
+		check.listData = append(check.listData, entry)
+	}
+
+	for _, entry := range check.listData {
+		if entry["_error"] != "" {
+			continue
+		}
+		check.result.Metrics = append(check.result.Metrics, &CheckMetric{
+			Name:          entry["source"],
+			ThresholdName: "days_left",
+			Unit:          "d",
+			Value:         entry["days_left"],
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+		})
+	}
+
+	return check.Finalize()
+}
+
+// rootPool returns the system cert pool extended by the ca file.
+func (l *CheckX509) rootPool() (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		log.Debugf("failed to load system cert pool: %s", err.Error())
+		roots = x509.NewCertPool()
+	}
+	if l.caFile == "" {
+		return roots, nil
+	}
+
+	certs, err := readX509File(l.caFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		roots.AddCert(cert)
+	}
+
+	return roots, nil
+}
+
+// listenerCertificates returns the certificate files of all ssl enabled listeners.
+func (l *CheckX509) listenerCertificates() []string {
+	files := []string{}
+	if l.snc == nil || l.snc.Listeners == nil {
+		return files
+	}
+	for _, module := range l.snc.Listeners.Modules() {
+		handler, ok := module.(RequestHandler)
+		if !ok {
+			continue
+		}
+		listener := handler.Listener()
+		if listener == nil || listener.certFile == "" || slices.Contains(files, listener.certFile) {
+			continue
+		}
+		files = append(files, listener.certFile)
+	}
+	slices.Sort(files)
+
+	return files
+}
+
+// addFiles adds the leaf certificate of all files matching given pattern.
+func (l *CheckX509) addFiles(check *CheckData, pattern string, roots *x509.CertPool) error {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid file pattern %s: %s", pattern, err.Error())
+	}
+	if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return fmt.Errorf("%s: no such file", pattern)
+	}
+
+	for _, match := range matches {
+		files := []string{match}
+		explicit := match == pattern
+		if fileInfo, err := os.Stat(match); err == nil && fileInfo.IsDir() {
+			files, err = readX509Directory(match)
+			if err != nil {
+				return err
+			}
+			explicit = false
+		}
+
+		for _, file := range files {
+			certs, err := readX509File(file)
+			switch {
+			case err != nil && explicit:
+				return err
+			case err != nil:
+				log.Debugf("skipping %s: %s", file, err.Error())
+
+				continue
+			}
+			check.listData = append(check.listData, x509Entry(file, certs, roots, ""))
+		}
+	}
+
+	return nil
+}
+
+// checkHost does a tls handshake with given endpoint and returns the peer certificate as entry.
+func (l *CheckX509) checkHost(ctx context.Context, check *CheckData, address string, roots *x509.CertPool) map[string]string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+		port = "443"
+		if l.starttls != "" {
+			port = x509StartTLS[l.starttls].port
+		}
+		address = net.JoinHostPort(host, port)
+	}
+	serverName := l.serverName
+	if serverName == "" {
+		serverName = host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(check.timeout*float64(time.Second)))
+	defer cancel()
+
+	certs, err := l.handshake(ctx, address, serverName)
+	if err != nil {
+		return map[string]string{
+			"source": address,
+			"_error": fmt.Sprintf("%s: %s", address, err.Error()),
+		}
+	}
+
+	return x509Entry(address, certs, roots, serverName)
+}
+
+// handshake connects to address and returns the peer certificates.
+func (l *CheckX509) handshake(ctx context.Context, address, serverName string) ([]*x509.Certificate, error) {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("connect failed: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		LogDebug(conn.SetDeadline(deadline))
+	}
+
+	if l.starttls != "" {
+		err = x509StartTLSExchange(conn, x509StartTLS[l.starttls].steps)
+		if err != nil {
+			return nil, fmt.Errorf("starttls failed: %s", err.Error())
+		}
+	}
+
+	// certificate is verified later, so the details of invalid certificates are available as well
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true, //nolint:gosec // chain is verified separately
+	})
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("tls handshake failed: %s", err.Error())
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no peer certificate")
+	}
+
+	return certs, nil
+}
+
+// x509StartTLSExchange runs the starttls steps on given connection.
+func x509StartTLSExchange(conn net.Conn, steps []x509StartTLSStep) error {
+	reader := bufio.NewReader(conn)
+	for _, step := range steps {
+		if step.send != "" {
+			if _, err := conn.Write([]byte(step.send)); err != nil {
+				return fmt.Errorf("write failed: %s", err.Error())
+			}
+		}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("read failed: %s", err.Error())
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, step.expect) {
+				break
+			}
+			for _, fail := range step.fail {
+				if strings.HasPrefix(line, fail) {
+					return fmt.Errorf("unexpected response: %s", line)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// readX509Directory returns all certificate files in given directory.
+func readX509Directory(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", dir, err.Error())
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !slices.Contains(x509CertExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	return files, nil
+}
+
+// readX509File returns all certificates from a PEM or DER encoded file.
+func readX509File(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err.Error())
+	}
+
+	certs := []*x509.Certificate{}
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	// no pem data found, try der
+	if len(certs) == 0 && !strings.Contains(string(data), "-----BEGIN") {
+		certs, err = x509.ParseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no certificate found", file)
+	}
+
+	return certs, nil
+}
+
+// x509Entry returns the attributes of the first certificate, the remaining certificates are used as intermediates.
+func x509Entry(source string, certs []*x509.Certificate, roots *x509.CertPool, dnsName string) map[string]string {
+	cert := certs[0]
+	daysLeft := math.Floor(time.Until(cert.NotAfter).Hours() / 24)
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	chainValid := "1"
+	chainError := ""
+	_, err := cert.Verify(x509.VerifyOptions{
+		DNSName:       dnsName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		chainValid = "0"
+		chainError = err.Error()
+	}
+
+	keyType, keySize := x509KeyInfo(cert)
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	// CheckSignatureFrom would require the ca flag, but self signed leaf certificates usually do not have it
+	selfSigned := "0"
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil {
+		selfSigned = "1"
+	}
+	isCA := "0"
+	if cert.IsCA {
+		isCA = "1"
+	}
+
+	return map[string]string{
+		"source":              source,
+		"subject":             cert.Subject.String(),
+		"common_name":         cert.Subject.CommonName,
+		"issuer":              cert.Issuer.String(),
+		"sans":                strings.Join(sans, ", "),
+		"serial":              fmt.Sprintf("%x", cert.SerialNumber),
+		"not_before":          fmt.Sprintf("%d", cert.NotBefore.Unix()),
+		"not_after":           fmt.Sprintf("%d", cert.NotAfter.Unix()),
+		"days_left":           fmt.Sprintf("%d", int64(daysLeft)),
+		"key_type":            keyType,
+		"key_size":            fmt.Sprintf("%d", keySize),
+		"signature_algorithm": cert.SignatureAlgorithm.String(),
+		"is_ca":               isCA,
+		"self_signed":         selfSigned,
+		"chain_length":        fmt.Sprintf("%d", len(certs)),
+		"chain_valid":         chainValid,
+		"chain_error":         chainError,
+	}
+}
+
+// x509KeyInfo returns public key algorithm and size in bits.
+func x509KeyInfo(cert *x509.Certificate) (keyType string, keySize int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", len(key) * 8
+	default:
+		return cert.PublicKeyAlgorithm.String(), 0
+	}
+}
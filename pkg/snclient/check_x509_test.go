@@ -0,0 +1,191 @@
+package snclient
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate creates a self signed certificate and key in given folder and returns the file names.
+func writeTestCertificate(t *testing.T, dir string, validFor time.Duration) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(4711),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "server.der"), der, 0o600))
+
+	return certFile, keyFile
+}
+
+func TestCheckX509Files(t *testing.T) {
+	snc := StartTestAgent(t, "")
+
+	tmpDir := t.TempDir()
+	certFile, _ := writeTestCertificate(t, tmpDir, 20*24*time.Hour+time.Hour)
+
+	res := snc.RunCheck("check_x509", []string{"file=" + certFile})
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	assert.Equalf(t, "WARNING - "+certFile+" expires in 20 days |'"+certFile+"'=20d;30:;14:",
+		string(res.BuildPluginOutput()), "output matches")
+
+	res = snc.RunCheck("check_x509", []string{
+		"file=" + tmpDir, "ok-syntax=%(list)",
+		"detail-syntax=%(common_name) %(key_type) %(key_size) %(signature_algorithm) %(sans) ca:%(is_ca) self:%(self_signed) valid:%(chain_valid)",
+		"warn=days_left < 10", "crit=days_left < 5",
+	})
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	assert.Contains(t, string(res.BuildPluginOutput()),
+		"localhost ECDSA 256 ECDSA-SHA256 localhost, 127.0.0.1 ca:1 self:1 valid:0, localhost ECDSA 256",
+		"pem and der file are read from directory")
+
+	res = snc.RunCheck("check_x509", []string{"file=" + certFile, "ca=" + certFile, "crit=chain_valid = 0"})
+	assert.Equalf(t, CheckExitWarning, res.State, "chain is valid with ca file")
+
+	res = snc.RunCheck("check_x509", []string{"file=" + filepath.Join(tmpDir, "server.key")})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Contains(t, string(res.BuildPluginOutput()), "no certificate found")
+
+	StopTestAgent(t, snc)
+}
+
+func TestCheckX509SelfSignedLeaf(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// self signed server certificate without ca flag
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(4712),
+		Subject:      pkix.Name{CommonName: "leaf.localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	entry := x509Entry("leaf", []*x509.Certificate{cert}, nil, "")
+	assert.Equalf(t, "0", entry["is_ca"], "certificate is no ca")
+	assert.Equalf(t, "1", entry["self_signed"], "leaf certificate is self signed")
+
+	// certificate signed by another key with same subject and issuer
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, otherKey)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	entry = x509Entry("leaf", []*x509.Certificate{cert}, nil, "")
+	assert.Equalf(t, "0", entry["self_signed"], "signature does not match own key")
+}
+
+func TestCheckX509Listener(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir(), 100*24*time.Hour+time.Hour)
+	config := `
+[/modules]
+WEBServer = enabled
+
+[/settings/WEB/server]
+port = 0
+use ssl = true
+certificate = ` + certFile + `
+certificate key = ` + keyFile + `
+`
+	snc := StartTestAgent(t, config)
+
+	res := snc.RunCheck("check_x509", []string{})
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	assert.Equalf(t, "OK - All 1 certificate(s) are ok |'"+certFile+"'=100d;30:;14:",
+		string(res.BuildPluginOutput()), "listener certificate is checked by default")
+
+	StopTestAgent(t, snc)
+}
+
+func TestCheckX509Host(t *testing.T) {
+	snc := StartTestAgent(t, "")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "https://")
+
+	res := snc.RunCheck("check_x509", []string{"host=" + address, "ok-syntax=%(list)", "detail-syntax=%(source) %(subject) %(chain_valid)"})
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	assert.Contains(t, string(res.BuildPluginOutput()), address+" O=Acme Co 0")
+
+	// starttls
+	certFile, keyFile := writeTestCertificate(t, t.TempDir(), 10*24*time.Hour+time.Hour)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte("220-mail ESMTP\r\n220 ready\r\n"))
+		_, _ = reader.ReadString('\n')
+		_, _ = conn.Write([]byte("250-mail\r\n250 STARTTLS\r\n"))
+		_, _ = reader.ReadString('\n')
+		_, _ = conn.Write([]byte("220 go ahead\r\n"))
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+		_ = tlsConn.Handshake()
+	}()
+
+	res = snc.RunCheck("check_x509", []string{"host=" + listener.Addr().String(), "starttls=smtp", "servername=localhost", "ca=" + certFile, "crit=days_left < 14 or chain_valid = 0"})
+	assert.Equalf(t, CheckExitCritical, res.State, "state Critical")
+	assert.Equalf(t, "CRITICAL - "+listener.Addr().String()+" expires in 10 days |'"+listener.Addr().String()+"'=10d;30:;14:",
+		string(res.BuildPluginOutput()), "output matches")
+
+	res = snc.RunCheck("check_x509", []string{"host=localhost:1", "starttls=ftp"})
+	assert.Equalf(t, CheckExitUnknown, res.State, "state Unknown")
+	assert.Contains(t, string(res.BuildPluginOutput()), "unsupported starttls protocol")
+
+	StopTestAgent(t, snc)
+}
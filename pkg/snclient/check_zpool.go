@@ -0,0 +1,308 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"pkg/convert"
+	"pkg/humanize"
+
+	"golang.org/x/exp/slices"
+)
+
+func init() {
+	AvailableChecks["check_zpool"] = CheckEntry{"check_zpool", NewCheckZpool}
+}
+
+var (
+	// matches the progress of running scrubs and resilvers, ex.: 300G resilvered, 29.30% done, 01:30:00 to go
+	reZpoolScanDone = regexp.MustCompile(`([\d.]+)% done`)
+
+	// matches the number of data errors, ex.: errors: 5 data errors, use '-v' for a list
+	reZpoolDataErrors = regexp.MustCompile(`^errors:\s+(\d+) data errors`)
+)
+
+type CheckZpool struct {
+	snc   *Agent
+	pools []string
+}
+
+func NewCheckZpool() CheckHandler {
+	return &CheckZpool{}
+}
+
+func (l *CheckZpool) Build() *CheckData {
+	return &CheckData{
+		name:         "check_zpool",
+		description:  "Checks the health, errors and capacity of zfs pools.",
+		implemented:  Linux | FreeBSD | Darwin,
+		hasInventory: ListInventory,
+		result: &CheckResult{
+			State: CheckExitOK,
+		},
+		args: map[string]CheckArgument{
+			"pool": {value: &l.pools, isFilter: true, description: "Show this pool only"},
+		},
+		defaultWarning:  "health != 'ONLINE' || capacity > 80 || read_errors > 0 || write_errors > 0 || cksum_errors > 0",
+		defaultCritical: "health in ('FAULTED', 'UNAVAIL', 'SUSPENDED') || capacity > 90 || data_errors > 0",
+		topSyntax:       "%(status) - %(list)",
+		detailSyntax:    "%(pool) %(health) %(alloc_human)/%(size_human) (%(capacity)%)%(scan_progress)",
+		okSyntax:        "%(status) - All %(count) pool(s) are ok",
+		emptyState:      CheckExitUnknown,
+		emptySyntax:     "%(status) - no zfs pools found",
+		attributes: []CheckAttribute{
+			{name: "pool", description: "name of the pool"},
+			{name: "health", description: "health of the pool, ex.: ONLINE, DEGRADED, FAULTED"},
+			{name: "size", description: "size of the pool in bytes"},
+			{name: "size_human", description: "size of the pool (human readable)"},
+			{name: "alloc", description: "allocated space in bytes"},
+			{name: "alloc_human", description: "allocated space (human readable)"},
+			{name: "free", description: "free space in bytes"},
+			{name: "free_human", description: "free space (human readable)"},
+			{name: "fragmentation", description: "fragmentation of the free space in percent"},
+			{name: "capacity", description: "used space in percent"},
+			{name: "read_errors", description: "sum of read errors of all leaf devices"},
+			{name: "write_errors", description: "sum of write errors of all leaf devices"},
+			{name: "cksum_errors", description: "sum of checksum errors of all leaf devices"},
+			{name: "data_errors", description: "number of known data errors"},
+			{name: "degraded_devices", description: "number of leaf devices which are not online"},
+			{name: "scan", description: "running scan, can be: scrub, resilver or none"},
+			{name: "scan_pct", description: "progress of the running scan in percent"},
+			{name: "scan_progress", description: "running scan and progress in human readable form"},
+		},
+		exampleDefault: `
+    check_zpool
+    OK - All 2 pool(s) are ok |'tank used'=1019317870592B;;;0;1992864825344 'tank capacity'=51%;80;90;0;100 ...
+
+Check a single pool and alert on fragmentation:
+
+    check_zpool pool=tank warn="fragmentation > 50" crit="fragmentation > 70"
+    WARNING - tank ONLINE 949 GiB/1856 GiB (51%) |...
+	`,
+		exampleArgs: `'warn=capacity > 80' 'crit=capacity > 90'`,
+	}
+}
+
+func (l *CheckZpool) Check(ctx context.Context, snc *Agent, check *CheckData, _ []Argument) (*CheckResult, error) {
+	l.snc = snc
+
+	output, stderr, rc, err := l.snc.execCommand(ctx, "zpool list -Hp -o name,size,alloc,free,frag,cap,health", DefaultCmdTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("zpool list failed: %s\n%s", err.Error(), stderr)
+	}
+	if rc != 0 {
+		return nil, fmt.Errorf("zpool list failed: %s\n%s", output, stderr)
+	}
+	pools := l.parseList(output)
+
+	output, stderr, rc, err = l.snc.execCommand(ctx, "zpool status -p", DefaultCmdTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("zpool status failed: %s\n%s", err.Error(), stderr)
+	}
+	if rc != 0 {
+		return nil, fmt.Errorf("zpool status failed: %s\n%s", output, stderr)
+	}
+	l.parseStatus(output, pools)
+
+	for _, entry := range pools {
+		if len(l.pools) > 0 && !slices.Contains(l.pools, entry["pool"]) {
+			continue
+		}
+
+		if !check.MatchMapCondition(check.filter, entry, true) {
+			continue
+		}
+
+		check.listData = append(check.listData, entry)
+		l.addMetrics(check, entry)
+	}
+
+	return check.Finalize()
+}
+
+// parseList parses the tab separated output of zpool list -Hp -o name,size,alloc,free,frag,cap,health
+func (l *CheckZpool) parseList(output string) []map[string]string {
+	pools := []map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) < 7 {
+			continue
+		}
+
+		entry := map[string]string{
+			"pool":             fields[0],
+			"health":           fields[6],
+			"size":             fmt.Sprintf("%d", convert.Int64(fields[1])),
+			"alloc":            fmt.Sprintf("%d", convert.Int64(fields[2])),
+			"free":             fmt.Sprintf("%d", convert.Int64(fields[3])),
+			"fragmentation":    fmt.Sprintf("%d", convert.Int64(strings.TrimSuffix(fields[4], "%"))),
+			"capacity":         fmt.Sprintf("%d", convert.Int64(strings.TrimSuffix(fields[5], "%"))),
+			"read_errors":      "0",
+			"write_errors":     "0",
+			"cksum_errors":     "0",
+			"data_errors":      "0",
+			"degraded_devices": "0",
+			"scan":             "none",
+			"scan_pct":         "0",
+			"scan_progress":    "",
+		}
+		entry["size_human"] = humanize.IBytes(uint64(convert.Int64(entry["size"])))
+		entry["alloc_human"] = humanize.IBytes(uint64(convert.Int64(entry["alloc"])))
+		entry["free_human"] = humanize.IBytes(uint64(convert.Int64(entry["free"])))
+		pools = append(pools, entry)
+	}
+
+	return pools
+}
+
+// zpoolDevice is a row of the config section of zpool status.
+type zpoolDevice struct {
+	indent int
+	fields []string
+}
+
+// parseStatus adds the device errors and scan progress from zpool status -p to the pool entries
+func (l *CheckZpool) parseStatus(output string, pools []map[string]string) {
+	var entry map[string]string
+	var section string
+	var devices []zpoolDevice
+	inConfig := false
+
+	fileScanner := bufio.NewScanner(strings.NewReader(output))
+	for fileScanner.Scan() {
+		rawLine := fileScanner.Text()
+		line := strings.TrimSpace(rawLine)
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// header lines look like "pool: tank", continued lines are indented
+		if strings.HasSuffix(fields[0], ":") {
+			if inConfig {
+				l.parseDevices(entry, devices)
+				devices = nil
+			}
+			section = strings.TrimSuffix(fields[0], ":")
+			inConfig = false
+		}
+
+		switch {
+		case section == "pool" && len(fields) >= 2:
+			entry = nil
+			for _, pool := range pools {
+				if pool["pool"] == fields[1] {
+					entry = pool
+				}
+			}
+		case entry == nil:
+			continue
+		case section == "scan":
+			l.parseScan(entry, line)
+		case section == "errors":
+			if matches := reZpoolDataErrors.FindStringSubmatch(line); len(matches) == 2 {
+				entry["data_errors"] = matches[1]
+			}
+		case section == "config" && fields[0] == "NAME":
+			inConfig = true
+		case inConfig:
+			devices = append(devices, zpoolDevice{indent: len(rawLine) - len(strings.TrimLeft(rawLine, " \t")), fields: fields})
+		}
+	}
+
+	if inConfig && entry != nil {
+		l.parseDevices(entry, devices)
+	}
+}
+
+// parseDevices adds the errors of all leaf devices from the config section. Rows followed by a deeper
+// indented row are vdevs like mirror-0 or raidz1-0, they summarize the errors of their devices and are skipped.
+func (l *CheckZpool) parseDevices(entry map[string]string, devices []zpoolDevice) {
+	for i, device := range devices {
+		if i+1 < len(devices) && devices[i+1].indent > device.indent {
+			continue
+		}
+		if len(device.fields) >= 5 {
+			l.parseDevice(entry, device.fields)
+		}
+	}
+}
+
+// parseScan parses the scan lines, ex.: scan: resilver in progress since Sun Mar  3 10:00:00 2024
+func (l *CheckZpool) parseScan(entry map[string]string, line string) {
+	switch {
+	case strings.Contains(line, "resilver in progress"):
+		entry["scan"] = "resilver"
+	case strings.Contains(line, "scrub in progress"):
+		entry["scan"] = "scrub"
+	}
+
+	if matches := reZpoolScanDone.FindStringSubmatch(line); len(matches) == 2 && entry["scan"] != "none" {
+		entry["scan_pct"] = matches[1]
+		entry["scan_progress"] = fmt.Sprintf(" %s %s%%", entry["scan"], matches[1])
+	}
+}
+
+// parseDevice adds the errors of a leaf device row, ex.: sdb UNAVAIL 3 120 0
+func (l *CheckZpool) parseDevice(entry map[string]string, fields []string) {
+	for i, key := range []string{"read_errors", "write_errors", "cksum_errors"} {
+		entry[key] = fmt.Sprintf("%d", convert.Int64(entry[key])+convert.Int64(fields[2+i]))
+	}
+
+	switch fields[1] {
+	case "ONLINE", "AVAIL", "INUSE":
+	default:
+		entry["degraded_devices"] = fmt.Sprintf("%d", convert.Int64(entry["degraded_devices"])+1)
+	}
+}
+
+func (l *CheckZpool) addMetrics(check *CheckData, entry map[string]string) {
+	pool := entry["pool"]
+	size := convert.Float64(entry["size"])
+	check.result.Metrics = append(check.result.Metrics,
+		&CheckMetric{
+			ThresholdName: "alloc",
+			Name:          pool + " used",
+			Unit:          "B",
+			Value:         convert.Int64(entry["alloc"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &size,
+		},
+		&CheckMetric{
+			ThresholdName: "capacity",
+			Name:          pool + " capacity",
+			Unit:          "%",
+			Value:         convert.Int64(entry["capacity"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &Hundred,
+		},
+		&CheckMetric{
+			ThresholdName: "fragmentation",
+			Name:          pool + " fragmentation",
+			Unit:          "%",
+			Value:         convert.Int64(entry["fragmentation"]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+			Max:           &Hundred,
+		},
+	)
+
+	for _, key := range []string{"read_errors", "write_errors", "cksum_errors"} {
+		check.result.Metrics = append(check.result.Metrics, &CheckMetric{
+			ThresholdName: key,
+			Name:          pool + " " + key,
+			Value:         convert.Int64(entry[key]),
+			Warning:       check.warnThreshold,
+			Critical:      check.critThreshold,
+			Min:           &Zero,
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckZpool(t *testing.T) {
+	zpoolList := "tank\t1992864825344\t1019317870592\t973546954752\t12\t51\tDEGRADED\n" +
+		"backup\t1000000000000\t100000000000\t900000000000\t3\t10\tONLINE\n"
+	zpoolStatus := `  pool: backup
+ state: ONLINE
+  scan: scrub repaired 0B in 00:10:00 with 0 errors on Sun Mar  3 00:34:01 2024
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	backup      ONLINE       0     0     0
+	  sdd       ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: tank
+ state: DEGRADED
+status: One or more devices could not be used because the label is missing or
+	invalid.  Sufficient replicas exist for the pool to continue
+	functioning in a degraded state.
+action: Replace the device using 'zpool replace'.
+  scan: resilver in progress since Sun Mar  3 10:00:00 2024
+	1.23T scanned at 500M/s, 600G issued at 250M/s, 2.00T total
+	300G resilvered, 29.30% done, 01:30:00 to go
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        DEGRADED     0     0     0
+	  mirror-0  DEGRADED     0     0     0
+	    sda     ONLINE       0     0     1
+	    sdb     UNAVAIL      3   120     0
+	cache
+	  sdc       ONLINE       0     0     0
+	spares
+	  sde       AVAIL
+
+errors: No known data errors
+`
+	scriptsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(scriptsDir, "zpool.list"), []byte(zpoolList), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(scriptsDir, "zpool.status"), []byte(zpoolStatus), 0o600))
+	script := "#!/bin/sh\ncat \"$(dirname \"$0\")/zpool.$1\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(scriptsDir, "zpool"), []byte(script), 0o700)) //nolint:gosec // test script must be executable
+
+	snc := StartTestAgent(t, "[/paths]\nscripts = "+scriptsDir+"\n")
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheck("check_zpool", []string{})
+	assert.Equalf(t, CheckExitWarning, res.State, "degraded pool is warning")
+	output := string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "WARNING - tank DEGRADED 949 GiB/1856 GiB (51%) resilver 29.30%, backup ONLINE 93 GiB/931 GiB (10%) |", "output matches")
+	assert.Containsf(t, output, "'tank capacity'=51%;80;90;0;100", "capacity perfdata")
+	assert.Containsf(t, output, "'tank write_errors'=120;0;;0", "error perfdata")
+
+	res = snc.RunCheck("check_zpool", []string{"pool=tank", "top-syntax=${list}", "detail-syntax=${read_errors} ${write_errors} ${cksum_errors} ${degraded_devices} ${fragmentation} ${scan} ${scan_pct}"})
+	assert.Equalf(t, "3 120 1 1 12 resilver 29.30", res.Output, "only leaf devices are counted")
+
+	res = snc.RunCheck("check_zpool", []string{"pool=backup"})
+	assert.Equalf(t, CheckExitOK, res.State, "healthy pool is ok")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "OK - All 1 pool(s) are ok |", "output matches")
+}
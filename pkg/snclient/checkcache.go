@@ -0,0 +1,182 @@
+package snclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// CheckCache stores check results for commands with a configured cache ttl.
+type CheckCache struct {
+	noCopy  noCopy
+	lock    deadlock.RWMutex
+	entries map[string]*checkCacheEntry
+}
+
+type checkCacheEntry struct {
+	result     *CheckResult
+	created    time.Time
+	refreshing bool
+}
+
+// CheckCacheConfig contains the cache settings of a single command.
+type CheckCacheConfig struct {
+	ttl   time.Duration // results are returned from the cache until they are older than ttl
+	stale time.Duration // afterwards they are still returned for this duration but refreshed in the background
+}
+
+func NewCheckCache() *CheckCache {
+	return &CheckCache{
+		entries: make(map[string]*checkCacheEntry),
+	}
+}
+
+// NewCheckCacheConfig reads the cache settings from given config section.
+func NewCheckCacheConfig(conf *ConfigSection) (*CheckCacheConfig, error) {
+	cacheConf := &CheckCacheConfig{}
+
+	ttl, ok, err := conf.GetDuration("cache ttl")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("cache ttl: %s", err.Error())
+	case ok:
+		cacheConf.ttl = time.Duration(ttl * float64(time.Second))
+	}
+
+	stale, ok, err := conf.GetDuration("cache stale")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("cache stale: %s", err.Error())
+	case ok:
+		cacheConf.stale = time.Duration(stale * float64(time.Second))
+	}
+
+	return cacheConf, nil
+}
+
+// Flush removes all cached results.
+func (cc *CheckCache) Flush() {
+	cc.lock.Lock()
+	cc.entries = make(map[string]*checkCacheEntry)
+	cc.lock.Unlock()
+}
+
+// Get returns the cached result for given key or nil along with the age of the entry
+// and a flag which indicates if the caller should refresh the entry in the background.
+func (cc *CheckCache) Get(key string, cacheConf *CheckCacheConfig) (res *CheckResult, created time.Time, refresh bool) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	entry, ok := cc.entries[key]
+	if !ok {
+		return nil, created, false
+	}
+
+	age := time.Since(entry.created)
+	switch {
+	case age < cacheConf.ttl:
+		return entry.result, entry.created, false
+	case age < cacheConf.ttl+cacheConf.stale:
+		// only the first caller triggers the refresh
+		refresh = !entry.refreshing
+		entry.refreshing = true
+
+		return entry.result, entry.created, refresh
+	default:
+		delete(cc.entries, key)
+
+		return nil, created, false
+	}
+}
+
+// Set stores the result for given key.
+func (cc *CheckCache) Set(key string, res *CheckResult, created time.Time) {
+	cc.lock.Lock()
+	cc.entries[key] = &checkCacheEntry{
+		result:  res,
+		created: created,
+	}
+	cc.lock.Unlock()
+}
+
+// refreshDone marks the background refresh of given key as finished.
+func (cc *CheckCache) refreshDone(key string) {
+	cc.lock.Lock()
+	if entry, ok := cc.entries[key]; ok {
+		entry.refreshing = false
+	}
+	cc.lock.Unlock()
+}
+
+// runCachedCheck returns the result of run() which is cached according to the cache config.
+// Cached results contain the macros %(cache_age) and %(cache_time).
+// Background refreshes are limited by timeout (in seconds) and canceled when the agent stops.
+func (snc *Agent) runCachedCheck(ctx context.Context, key string, conf *ConfigSection, timeout float64, run func(context.Context) *CheckResult) (*CheckResult, error) {
+	cacheConf, err := NewCheckCacheConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheConf.ttl <= 0 {
+		return run(ctx).withCacheMacros(time.Now()), nil
+	}
+
+	res, created, refresh := snc.checkCache.Get(key, cacheConf)
+	if res != nil {
+		if refresh {
+			log.Debugf("cached result of %s is stale, refreshing in background", key)
+			go func() {
+				defer snc.logPanicRecover()
+				defer snc.checkCache.refreshDone(key)
+
+				refreshCtx, cancel := context.WithTimeout(snc.ctx, time.Duration(timeout*float64(time.Second)))
+				defer cancel()
+
+				refreshed := time.Now()
+				res := run(refreshCtx)
+				if refreshCtx.Err() == nil {
+					snc.checkCache.Set(key, res, refreshed)
+				}
+			}()
+		}
+		log.Tracef("returning cached result of %s (created: %s)", key, created.String())
+
+		return res.withCacheMacros(created), nil
+	}
+
+	created = time.Now()
+	res = run(ctx)
+	if ctx.Err() == nil {
+		snc.checkCache.Set(key, res, created)
+	}
+
+	return res.withCacheMacros(created), nil
+}
+
+// withCacheMacros returns a copy of the result with replaced cache macros.
+func (cr *CheckResult) withCacheMacros(created time.Time) *CheckResult {
+	res := *cr
+	res.Metrics = append([]*CheckMetric{}, cr.Metrics...)
+
+	if !strings.Contains(res.Output, "cache_") && !strings.Contains(res.Details, "cache_") {
+		return &res
+	}
+
+	macros := map[string]string{
+		"cache_age":  fmt.Sprintf("%d", int64(time.Since(created).Seconds())),
+		"cache_time": fmt.Sprintf("%d", created.Unix()),
+	}
+	res.Output = ReplaceMacros(res.Output, macros)
+	res.Details = ReplaceMacros(res.Details, macros)
+
+	return &res
+}
+
+// cacheKey returns the key used to cache results of given check name and its fully expanded command line.
+// Using the expanded command makes sure runtime macros like $IDENTITY$ never share a result.
+func cacheKey(name string, command []string) string {
+	return name + "\x00" + strings.Join(command, "\x00")
+}
@@ -0,0 +1,205 @@
+package snclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCacheGet(t *testing.T) {
+	cache := NewCheckCache()
+	cacheConf := &CheckCacheConfig{ttl: time.Minute, stale: time.Minute}
+
+	res, _, refresh := cache.Get("test", cacheConf)
+	assert.Nilf(t, res, "empty cache")
+	assert.Falsef(t, refresh, "no refresh for empty cache")
+
+	cache.Set("test", &CheckResult{Output: "fresh"}, time.Now())
+	res, _, refresh = cache.Get("test", cacheConf)
+	require.NotNilf(t, res, "cached result")
+	assert.Equalf(t, "fresh", res.Output, "cached result")
+	assert.Falsef(t, refresh, "no refresh within ttl")
+
+	// stale results trigger a single refresh
+	cache.Set("test", &CheckResult{Output: "stale"}, time.Now().Add(-90*time.Second))
+	res, _, refresh = cache.Get("test", cacheConf)
+	require.NotNilf(t, res, "cached result")
+	assert.Equalf(t, "stale", res.Output, "stale result")
+	assert.Truef(t, refresh, "refresh stale result")
+
+	_, _, refresh = cache.Get("test", cacheConf)
+	assert.Falsef(t, refresh, "refresh is only triggered once")
+
+	// expired results are removed
+	cache.Set("test", &CheckResult{Output: "expired"}, time.Now().Add(-3*time.Minute))
+	res, _, _ = cache.Get("test", cacheConf)
+	assert.Nilf(t, res, "expired result")
+
+	cache.Set("test", &CheckResult{Output: "fresh"}, time.Now())
+	cache.Flush()
+	res, _, _ = cache.Get("test", cacheConf)
+	assert.Nilf(t, res, "flushed cache")
+}
+
+func TestCheckCacheRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	snc := &Agent{checkCache: NewCheckCache(), ctx: ctx, cancel: cancel}
+	conf := NewConfig(true).Section("test")
+	conf.Set("cache ttl", "1m")
+	conf.Set("cache stale", "1m")
+
+	waitRefreshed := func() bool {
+		for i := 0; i < 100; i++ {
+			snc.checkCache.lock.Lock()
+			refreshing := snc.checkCache.entries["test"].refreshing
+			snc.checkCache.lock.Unlock()
+			if !refreshing {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return false
+	}
+
+	// panics during refresh keep the stale result and allow another refresh
+	snc.checkCache.Set("test", &CheckResult{Output: "stale"}, time.Now().Add(-90*time.Second))
+	res, err := snc.runCachedCheck(context.TODO(), "test", conf, 10, func(_ context.Context) *CheckResult {
+		panic("test panic")
+	})
+	require.NoError(t, err)
+	assert.Equalf(t, "stale", res.Output, "stale result")
+	assert.Truef(t, waitRefreshed(), "refresh is finished after panic")
+
+	// refreshes run into the timeout
+	deadline := make(chan bool, 1)
+	_, err = snc.runCachedCheck(context.TODO(), "test", conf, 0.1, func(ctx context.Context) *CheckResult {
+		<-ctx.Done()
+		deadline <- errors.Is(ctx.Err(), context.DeadlineExceeded)
+
+		return &CheckResult{Output: "timeout"}
+	})
+	require.NoError(t, err)
+	assert.Truef(t, <-deadline, "refresh is limited by the timeout")
+	assert.Truef(t, waitRefreshed(), "refresh is finished after timeout")
+	snc.checkCache.lock.Lock()
+	assert.Equalf(t, "stale", snc.checkCache.entries["test"].result.Output, "timed out refresh is not cached")
+	snc.checkCache.lock.Unlock()
+
+	// stopping the agent cancels refreshes
+	canceled := make(chan bool, 1)
+	_, err = snc.runCachedCheck(context.TODO(), "test", conf, 60, func(ctx context.Context) *CheckResult {
+		<-ctx.Done()
+		canceled <- errors.Is(ctx.Err(), context.Canceled)
+
+		return &CheckResult{Output: "canceled"}
+	})
+	require.NoError(t, err)
+	cancel()
+	assert.Truef(t, <-canceled, "refresh is canceled on shutdown")
+	assert.Truef(t, waitRefreshed(), "refresh is finished after shutdown")
+}
+
+func TestCheckCacheAlias(t *testing.T) {
+	config := `
+[/modules]
+CheckExternalScripts = enabled
+
+[/settings/external scripts/alias/alias_cached]
+command = check_uptime warn=none crit=none ok-syntax="cache age: %(cache_age)"
+cache ttl = 1h
+cache stale = 2h
+
+[/settings/external scripts/alias/alias_cached_short]
+command = check_uptime warn=none crit=none ok-syntax="cache age: %(cache_age)"
+cache ttl = 5s
+
+[/settings/external scripts/alias/alias_uncached]
+command = check_uptime warn=none crit=none ok-syntax="cache age: %(cache_age)"
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheck("alias_uncached", []string{})
+	assert.Equalf(t, "cache age: 0", res.Output, "uncached output")
+
+	res = snc.RunCheck("alias_cached", []string{})
+	assert.Equalf(t, "cache age: 0", res.Output, "fresh output")
+
+	snc.checkCache.lock.Lock()
+	require.Lenf(t, snc.checkCache.entries, 1, "result has been cached")
+	var entry *checkCacheEntry
+	for key, e := range snc.checkCache.entries {
+		assert.Truef(t, strings.HasPrefix(key, "alias_cached\x00check_uptime\x00"), "result is cached by alias name")
+		entry = e
+	}
+	entry.created = time.Now().Add(-10 * time.Second)
+	snc.checkCache.lock.Unlock()
+
+	res = snc.RunCheck("alias_cached", []string{})
+	assert.Equalf(t, "cache age: 10", res.Output, "cached output")
+
+	// aliases wrapping the same command use their own cache entry
+	res = snc.RunCheck("alias_cached_short", []string{})
+	assert.Equalf(t, "cache age: 0", res.Output, "other alias is not cached yet")
+	snc.checkCache.lock.Lock()
+	assert.Lenf(t, snc.checkCache.entries, 2, "each alias has its own entry")
+	snc.checkCache.lock.Unlock()
+
+	// stale result is returned and refreshed in the background
+	snc.checkCache.lock.Lock()
+	entry.created = time.Now().Add(-90 * time.Minute)
+	snc.checkCache.lock.Unlock()
+
+	res = snc.RunCheck("alias_cached", []string{})
+	assert.Equalf(t, "cache age: 5400", res.Output, "stale output")
+
+	for i := 0; i < 100; i++ {
+		res = snc.RunCheck("alias_cached", []string{})
+		if res.Output == "cache age: 0" {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equalf(t, "cache age: 0", res.Output, "refreshed output")
+}
+
+func TestCheckCacheIdentity(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+
+	scriptsDir, err := filepath.Abs("t/scripts")
+	require.NoErrorf(t, err, "scripts dir")
+
+	config := fmt.Sprintf(`
+[/modules]
+CheckExternalScripts = enabled
+
+[/paths]
+scripts = %s
+
+[/settings/external scripts/scripts/check_identity]
+command = ${scripts}/check_dummy.sh 0 "$IDENTITY$"
+cache ttl = 1h
+`, scriptsDir)
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	res := snc.RunCheckWithContext(WithRequestSource(context.TODO(), "test", "", "monitoring"), "check_identity", []string{})
+	assert.Equalf(t, "OK: monitoring", res.Output, "output for first identity")
+
+	res = snc.RunCheckWithContext(WithRequestSource(context.TODO(), "test", "", "dashboard"), "check_identity", []string{})
+	assert.Equalf(t, "OK: dashboard", res.Output, "cached result of other identity is not used")
+
+	res = snc.RunCheckWithContext(WithRequestSource(context.TODO(), "test", "", "monitoring"), "check_identity", []string{})
+	assert.Equalf(t, "OK: monitoring", res.Output, "cached output for first identity")
+}
@@ -114,6 +114,13 @@ type CheckData struct {
 	attributes             []CheckAttribute
 	exampleDefault         string
 	exampleArgs            string
+	groupBy                string // aggregate list entries by this attribute
+	diffKey                string // compare list entries with the previous run by this attribute
+	diffAttributes         []string
+	diffMacros             map[string]string
+	stateStore             *StateStore
+	stateName              string // key in the state store, command name including arguments
+	listLimit              int64  // only show the last n entries in the list macros
 }
 
 func (cd *CheckData) Finalize() (*CheckResult, error) {
@@ -140,6 +147,14 @@ func (cd *CheckData) Finalize() (*CheckResult, error) {
 		return cd.result, nil
 	}
 
+	if cd.groupBy != "" {
+		cd.listData = cd.groupListData()
+	}
+
+	if cd.diffKey != "" {
+		cd.diffListData()
+	}
+
 	return cd.finalizeOutput()
 }
 
@@ -179,6 +194,9 @@ func (cd *CheckData) finalizeOutput() (*CheckResult, error) {
 	} else {
 		finalMacros = cd.buildListMacros()
 	}
+	for key, val := range cd.diffMacros {
+		finalMacros[key] = val
+	}
 	err := cd.result.ApplyPerfConfig(cd.perfConfig)
 	if err != nil {
 		return nil, fmt.Errorf("%s", err.Error())
@@ -235,7 +253,7 @@ func (cd *CheckData) buildListMacros() map[string]string {
 	}
 	result := map[string]string{
 		"count":         fmt.Sprintf("%d", len(list)),
-		"list":          strings.Join(list, cd.listCombine),
+		"list":          strings.Join(lastEntries(list, cd.listLimit), cd.listCombine),
 		"ok_count":      fmt.Sprintf("%d", len(okList)),
 		"ok_list":       "",
 		"warn_count":    fmt.Sprintf("%d", len(warnList)),
@@ -246,6 +264,11 @@ func (cd *CheckData) buildListMacros() map[string]string {
 		"problem_list":  "",
 		"detail_list":   "",
 	}
+	count := len(list)
+	problemCount := len(warnList) + len(critList)
+	okList = lastEntries(okList, cd.listLimit)
+	warnList = lastEntries(warnList, cd.listLimit)
+	critList = lastEntries(critList, cd.listLimit)
 
 	problemList := []string{}
 	detailList := []string{}
@@ -273,7 +296,7 @@ func (cd *CheckData) buildListMacros() map[string]string {
 		cd.result.Metrics = append(cd.result.Metrics,
 			&CheckMetric{
 				Name:     "count",
-				Value:    len(list),
+				Value:    count,
 				Warning:  cd.warnThreshold,
 				Critical: cd.critThreshold,
 				Min:      &Zero,
@@ -284,7 +307,7 @@ func (cd *CheckData) buildListMacros() map[string]string {
 		cd.result.Metrics = append(cd.result.Metrics,
 			&CheckMetric{
 				Name:     "failed",
-				Value:    len(critList) + len(warnList),
+				Value:    problemCount,
 				Warning:  cd.warnThreshold,
 				Critical: cd.critThreshold,
 				Min:      &Zero,
@@ -295,6 +318,15 @@ func (cd *CheckData) buildListMacros() map[string]string {
 	return result
 }
 
+// lastEntries returns the last limit entries of given list, all entries if limit is not positive
+func lastEntries(list []string, limit int64) []string {
+	if limit <= 0 || int64(len(list)) <= limit {
+		return list
+	}
+
+	return list[int64(len(list))-limit:]
+}
+
 func (cd *CheckData) buildListMacrosFromSingleEntry() map[string]string {
 	entry := cd.listData[0]
 	expanded := ReplaceMacros(cd.detailSyntax, entry)
@@ -487,6 +519,7 @@ func (cd *CheckData) ParseArgs(args []string) (argList []Argument, defaultWarnin
 	cd.expandArgDefinitions()
 	topSupplied := false
 	okSupplied := false
+	detailSupplied := false
 	numArgs := len(args)
 	for idx := 0; idx < numArgs; idx++ {
 		argExpr := cd.removeQuotes(args[idx])
@@ -550,6 +583,15 @@ func (cd *CheckData) ParseArgs(args []string) (argList []Argument, defaultWarnin
 			}
 		case "detail-syntax":
 			cd.detailSyntax = argValue
+			detailSupplied = true
+		case "group-by":
+			cd.groupBy = argValue
+		case "diff-key":
+			cd.diffKey = argValue
+		case "diff-attributes":
+			for _, attr := range strings.Split(argValue, ",") {
+				cd.diffAttributes = append(cd.diffAttributes, strings.TrimSpace(attr))
+			}
 		case "top-syntax":
 			cd.topSyntax = argValue
 			topSupplied = true
@@ -612,6 +654,10 @@ func (cd *CheckData) ParseArgs(args []string) (argList []Argument, defaultWarnin
 		cd.okSyntax = cd.topSyntax
 	}
 
+	if cd.groupBy != "" && !detailSupplied {
+		cd.detailSyntax = "${" + cd.groupBy + "}: ${count}"
+	}
+
 	err = cd.setFallbacks(applyDefaultFilter)
 	if err != nil {
 		return nil, "", "", err
@@ -855,7 +901,7 @@ func (cd *CheckData) ExpandThresholdUnit(exponents []string, targetUnit string,
 			return true
 		}
 		unit := strings.ToLower(cond.unit)
-		if slices.Contains(names, cond.keyword) && slices.Contains(exponents, unit) {
+		if cond.usesKeyword(names) && slices.Contains(exponents, unit) {
 			val, err := humanize.ParseBytes(fmt.Sprintf("%f%s%s", convert.Float64(cond.value), cond.unit, targetUnit))
 			if err == nil {
 				cond.unit = targetUnit
@@ -1119,16 +1165,21 @@ func (cd *CheckData) helpHeaderMarkdown(format ShowHelp) string {
 }
 
 func (cd *CheckData) isImplemented(platform string) bool {
+	return cd.implemented.supports(platform)
+}
+
+// supports returns true if given platform is part of the implemented platforms
+func (impl Implemented) supports(platform string) bool {
 	switch {
-	case cd.implemented == ALL:
+	case impl == ALL:
 		return true
-	case platform == "windows" && cd.implemented&Windows > 0:
+	case platform == "windows" && impl&Windows > 0:
 		return true
-	case platform == "linux" && cd.implemented&Linux > 0:
+	case platform == "linux" && impl&Linux > 0:
 		return true
-	case platform == "darwin" && cd.implemented&Darwin > 0:
+	case platform == "darwin" && impl&Darwin > 0:
 		return true
-	case platform == "freebsd" && cd.implemented&FreeBSD > 0:
+	case platform == "freebsd" && impl&FreeBSD > 0:
 		return true
 	}
 
@@ -1309,3 +1360,245 @@ func (cd *CheckData) helpAttributes(format ShowHelp) string {
 
 	return out
 }
+
+// groupListData aggregates list entries by the group-by attribute. Each group contains
+// the count and sum/avg/min/max of all numeric attributes, ex.: rss_sum.
+// Performance data of the single entries is replaced by the performance data of the groups.
+func (cd *CheckData) groupListData() []map[string]string {
+	groups := make(map[string][]map[string]string)
+	groupNames := []string{}
+	grouped := make([]map[string]string, 0)
+	for _, entry := range cd.listData {
+		switch {
+		case entry["_skip"] == "1":
+			continue
+		case entry["_error"] != "", entry["_exit"] != "":
+			// keep errors, they are handled in finalizeOutput
+			grouped = append(grouped, entry)
+
+			continue
+		}
+		name := entry[cd.groupBy]
+		if _, ok := groups[name]; !ok {
+			groupNames = append(groupNames, name)
+		}
+		groups[name] = append(groups[name], entry)
+	}
+
+	cd.result.Metrics = make([]*CheckMetric, 0)
+	for _, name := range groupNames {
+		group := aggregateListData(groups[name])
+		group[cd.groupBy] = name
+		group["group"] = name
+		grouped = append(grouped, group)
+		cd.addGroupMetrics(name, group)
+	}
+
+	return grouped
+}
+
+// aggregateListData returns the count and sum, avg, min and max of all numeric attributes of given entries
+func aggregateListData(entries []map[string]string) map[string]string {
+	values := make(map[string][]float64)
+	keys := []string{}
+	invalid := make(map[string]bool)
+	for _, entry := range entries {
+		for key, val := range entry {
+			if strings.HasPrefix(key, "_") || invalid[key] {
+				continue
+			}
+			num, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				invalid[key] = true
+
+				continue
+			}
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+			}
+			values[key] = append(values[key], num)
+		}
+	}
+
+	group := map[string]string{
+		"count": fmt.Sprintf("%d", len(entries)),
+	}
+	for _, key := range keys {
+		if invalid[key] {
+			continue
+		}
+		sum := float64(0)
+		for _, num := range values[key] {
+			sum += num
+		}
+		group[key+"_sum"] = convert.Num2String(sum)
+		group[key+"_avg"] = convert.Num2String(sum / float64(len(values[key])))
+		group[key+"_min"] = convert.Num2String(slices.Min(values[key]))
+		group[key+"_max"] = convert.Num2String(slices.Max(values[key]))
+	}
+
+	return group
+}
+
+// addGroupMetrics adds the count and all aggregates used in thresholds as performance data
+func (cd *CheckData) addGroupMetrics(name string, group map[string]string) {
+	keywords := []string{"count"}
+	units := map[string]string{}
+	collect := func(cond *Condition) bool {
+		names := []string{cond.keyword}
+		if cond.keywordExpr != nil {
+			names = cond.keywordExpr.Attributes()
+		}
+		for _, keyword := range names {
+			if _, ok := group[keyword]; !ok || slices.Contains(keywords, keyword) {
+				continue
+			}
+			keywords = append(keywords, keyword)
+			units[keyword] = cond.unit
+		}
+
+		return true
+	}
+	cd.VisitAll(cd.warnThreshold, collect)
+	cd.VisitAll(cd.critThreshold, collect)
+
+	for _, keyword := range keywords {
+		metricName := name + " " + keyword
+		cd.result.Metrics = append(cd.result.Metrics, &CheckMetric{
+			Name:          metricName,
+			ThresholdName: keyword,
+			Unit:          units[keyword],
+			Value:         convert.Float64(group[keyword]),
+			Warning:       cd.warnThreshold,
+			Critical:      cd.critThreshold,
+		})
+	}
+}
+
+// diffListData compares the list entries with the entries of the previous run by the diff-key attribute.
+// It sets the added, removed and changed macros and adds the diff attributes to each entry.
+func (cd *CheckData) diffListData() {
+	current := &StateStoreEntry{
+		Key:     cd.diffKey,
+		Entries: make(map[string]map[string]string),
+	}
+	keys := []string{}
+	for _, entry := range cd.listData {
+		if entry["_skip"] == "1" || entry["_error"] != "" || entry["_exit"] != "" {
+			continue
+		}
+		key := entry[cd.diffKey]
+		if _, ok := current.Entries[key]; ok {
+			continue
+		}
+		keys = append(keys, key)
+		current.Entries[key] = cd.diffAttributeValues(entry)
+	}
+
+	previous := (*StateStoreEntry)(nil)
+	if cd.stateStore != nil {
+		var err error
+		previous, err = cd.stateStore.Swap(cd.stateName, current)
+		if err != nil {
+			log.Warnf("%s", err.Error())
+		}
+	}
+	if previous != nil && previous.Key != cd.diffKey {
+		previous = nil
+	}
+
+	added := []string{}
+	changed := []string{}
+	removed := []string{}
+	for _, entry := range cd.listData {
+		key, ok := entry[cd.diffKey]
+		if !ok {
+			continue
+		}
+		entry["diff"] = "unchanged"
+		entry["diff_attributes"] = ""
+		if previous == nil {
+			continue
+		}
+		prev, ok := previous.Entries[key]
+		if !ok {
+			entry["diff"] = "added"
+			added = append(added, key)
+
+			continue
+		}
+		changedAttributes := diffAttributes(prev, current.Entries[key])
+		if len(changedAttributes) > 0 {
+			entry["diff"] = "changed"
+			entry["diff_attributes"] = strings.Join(changedAttributes, ", ")
+			changed = append(changed, key)
+		}
+	}
+	if previous != nil {
+		for key := range previous.Entries {
+			if _, ok := current.Entries[key]; !ok {
+				removed = append(removed, key)
+			}
+		}
+		sort.Strings(removed)
+	}
+
+	cd.diffMacros = map[string]string{
+		"added":         strings.Join(added, ", "),
+		"added_count":   fmt.Sprintf("%d", len(added)),
+		"removed":       strings.Join(removed, ", "),
+		"removed_count": fmt.Sprintf("%d", len(removed)),
+		"changed":       strings.Join(changed, ", "),
+		"changed_count": fmt.Sprintf("%d", len(changed)),
+	}
+
+	for _, name := range []string{"added", "removed", "changed"} {
+		cd.result.Metrics = append(cd.result.Metrics, &CheckMetric{
+			Name:          name,
+			ThresholdName: name + "_count",
+			Value:         convert.Int64(cd.diffMacros[name+"_count"]),
+			Warning:       cd.warnThreshold,
+			Critical:      cd.critThreshold,
+			Min:           &Zero,
+		})
+	}
+}
+
+// diffAttributeValues returns the attributes of given entry which are compared between runs
+func (cd *CheckData) diffAttributeValues(entry map[string]string) map[string]string {
+	values := make(map[string]string)
+	if len(cd.diffAttributes) > 0 {
+		for _, attr := range cd.diffAttributes {
+			values[attr] = entry[attr]
+		}
+
+		return values
+	}
+
+	for key, val := range entry {
+		if strings.HasPrefix(key, "_") || key == "diff" || key == "diff_attributes" {
+			continue
+		}
+		values[key] = val
+	}
+
+	return values
+}
+
+// diffAttributes returns the sorted list of attributes which differ
+func diffAttributes(previous, current map[string]string) []string {
+	changed := []string{}
+	for key, val := range current {
+		if prev, ok := previous[key]; !ok || prev != val {
+			changed = append(changed, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+
+	return changed
+}
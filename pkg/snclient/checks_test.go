@@ -17,3 +17,19 @@ func TestCheckUnknown(t *testing.T) {
 		"output matches",
 	)
 }
+
+func TestCheckAggregateListData(t *testing.T) {
+	group := aggregateListData([]map[string]string{
+		{"name": "a", "rss": "10", "cpu": "1.5", "_internal": "1"},
+		{"name": "b", "rss": "30", "cpu": "2.5"},
+		{"name": "c", "rss": "20", "cpu": "n/a"},
+	})
+	expect := map[string]string{
+		"count":   "3",
+		"rss_sum": "60",
+		"rss_avg": "20",
+		"rss_min": "10",
+		"rss_max": "30",
+	}
+	assert.Equalf(t, expect, group, "aggregated numeric attributes only")
+}
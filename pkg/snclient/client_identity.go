@@ -0,0 +1,141 @@
+package snclient
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+)
+
+// ClientIdentitySectionPrefix is the config section prefix for client certificate identities.
+const ClientIdentitySectionPrefix = "/settings/client identities/"
+
+// ClientIdentity maps verified client certificates to a named identity with its own access scope.
+type ClientIdentity struct {
+	*AccessScope
+	commonNames []*regexp.Regexp
+	altNames    []*regexp.Regexp
+	units       []*regexp.Regexp
+}
+
+// NewClientIdentities parses all client identity sections from the config.
+func NewClientIdentities(conf *Config) ([]*ClientIdentity, error) {
+	sections := conf.SectionsByPrefix(ClientIdentitySectionPrefix)
+	names := make([]string, 0, len(sections))
+	for sectionName := range sections {
+		names = append(names, sectionName)
+	}
+	sort.Strings(names)
+
+	identities := []*ClientIdentity{}
+	for _, sectionName := range names {
+		identity, err := NewClientIdentity(path.Base(sectionName), sections[sectionName])
+		if err != nil {
+			return nil, fmt.Errorf("client identity %s: %s", path.Base(sectionName), err.Error())
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
+
+// NewClientIdentity creates a client identity from given config section.
+func NewClientIdentity(name string, conf *ConfigSection) (*ClientIdentity, error) {
+	scope, err := NewAccessScope("client identity", name, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &ClientIdentity{AccessScope: scope}
+	if val, ok := conf.GetString("common name"); ok {
+		identity.commonNames = wildcardPatterns(val)
+	}
+	if val, ok := conf.GetString("subject alt name"); ok {
+		identity.altNames = wildcardPatterns(val)
+	}
+	if val, ok := conf.GetString("organizational unit"); ok {
+		identity.units = wildcardPatterns(val)
+	}
+
+	if len(identity.commonNames) == 0 && len(identity.altNames) == 0 && len(identity.units) == 0 {
+		return nil, fmt.Errorf("at least one of common name, subject alt name or organizational unit is required")
+	}
+
+	return identity, nil
+}
+
+// Match returns true if the certificate matches all configured attributes.
+func (ci *ClientIdentity) Match(cert *x509.Certificate) bool {
+	if len(ci.commonNames) > 0 && !wildcardMatch(ci.commonNames, cert.Subject.CommonName) {
+		return false
+	}
+
+	if len(ci.altNames) > 0 && !wildcardMatchAny(ci.altNames, certificateAltNames(cert)) {
+		return false
+	}
+
+	if len(ci.units) > 0 && !wildcardMatchAny(ci.units, cert.Subject.OrganizationalUnit) {
+		return false
+	}
+
+	return true
+}
+
+// verifiedClientCertificate returns the verified client certificate of given request or nil.
+func verifiedClientCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// verifyClientIdentity returns the client identity matching the verified client certificate of given request or nil.
+func (snc *Agent) verifyClientIdentity(req *http.Request) *ClientIdentity {
+	return snc.matchClientIdentity(verifiedClientCertificate(req))
+}
+
+// matchClientIdentity returns the first client identity matching given certificate or nil.
+func (snc *Agent) matchClientIdentity(cert *x509.Certificate) *ClientIdentity {
+	if cert == nil {
+		return nil
+	}
+
+	for _, identity := range snc.clientIdentities {
+		if identity.Match(cert) {
+			log.Debugf("request authenticated by client certificate %s as identity %s", cert.Subject.CommonName, identity.name)
+
+			return identity
+		}
+	}
+
+	return nil
+}
+
+// certificateAltNames returns all subject alternative names of the certificate.
+func certificateAltNames(cert *x509.Certificate) []string {
+	names := []string{}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
+
+// wildcardMatchAny returns true if any value matches any pattern.
+func wildcardMatchAny(patterns []*regexp.Regexp, values []string) bool {
+	for _, val := range values {
+		if wildcardMatch(patterns, val) {
+			return true
+		}
+	}
+
+	return false
+}
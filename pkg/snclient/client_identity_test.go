@@ -0,0 +1,108 @@
+package snclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIdentityMatch(t *testing.T) {
+	conf := NewConfig(false)
+	section := conf.Section("/settings/client identities/scraper")
+	section.Set("subject alt name", "*.monitoring.example.com")
+	section.Set("organizational unit", "prometheus")
+	identities, err := NewClientIdentities(conf)
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "scraper01", OrganizationalUnit: []string{"prometheus"}},
+		DNSNames: []string{"scraper01.monitoring.example.com"},
+	}
+	assert.Truef(t, identities[0].Match(cert), "san and ou match")
+
+	cert.Subject.OrganizationalUnit = []string{"naemon"}
+	assert.Falsef(t, identities[0].Match(cert), "all attributes must match")
+
+	conf = NewConfig(false)
+	conf.Section("/settings/client identities/empty").Set("allowed urls", "*")
+	_, err = NewClientIdentities(conf)
+	require.Errorf(t, err, "identity without certificate attributes")
+}
+
+func TestClientIdentityRequest(t *testing.T) {
+	config := `
+[/modules]
+WEBServer = enabled
+
+[/settings/WEB/server]
+port = 0
+use ssl = false
+password = listener-secret
+
+[/settings/client identities/naemon]
+common name = naemon.example.com
+allowed urls = /api/v1/*
+
+[/settings/client identities/scraper]
+organizational unit = prometheus
+allowed urls = /metrics
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	var handler *HandlerWeb
+	for _, module := range snc.Listeners.Modules() {
+		if h, ok := module.(*HandlerWeb); ok {
+			handler = h
+		}
+	}
+	require.NotNilf(t, handler, "web handler found")
+
+	mapping := URLMapping{
+		URL: "/api/v1/inventory",
+		Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			LogError2(res.Write([]byte(RequestIdentity(req.Context()))))
+		}),
+	}
+
+	for _, check := range []struct {
+		subject pkix.Name
+		status  int
+		body    string
+	}{
+		{pkix.Name{CommonName: "naemon.example.com"}, http.StatusOK, "naemon"},
+		{pkix.Name{CommonName: "scraper01", OrganizationalUnit: []string{"prometheus"}}, http.StatusForbidden, ""},
+		{pkix.Name{CommonName: "unknown"}, http.StatusForbidden, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/inventory", http.NoBody)
+		req.RemoteAddr = "127.0.0.1:12345"
+		req.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: check.subject}}},
+		}
+		res := httptest.NewRecorder()
+		handler.listener.WrappedCheckHTTPHandler(handler, &mapping, res, req)
+		assert.Equalf(t, check.status, res.Code, "status code for %s", check.subject.CommonName)
+		if check.status == http.StatusOK {
+			assert.Equalf(t, check.body, res.Body.String(), "identity for %s", check.subject.CommonName)
+		}
+	}
+
+	// unmapped certificates still require the password, the common name is used as identity
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/inventory", http.NoBody)
+	req.RemoteAddr = "127.0.0.1:12345"
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "unknown"}}}},
+	}
+	req.SetBasicAuth("user", "listener-secret")
+	res := httptest.NewRecorder()
+	handler.listener.WrappedCheckHTTPHandler(handler, &mapping, res, req)
+	assert.Equalf(t, http.StatusOK, res.Code, "password accepted")
+	assert.Equalf(t, "unknown", res.Body.String(), "common name used as identity")
+}
@@ -22,6 +22,9 @@ snclient inventory
 
 # print inventory for mounts only
 snclient inventory mounts
+
+# print installed packages and listening sockets
+snclient inventory packages listening_sockets
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 			agentFlags.Mode = snclient.ModeOneShot
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"pkg/check_nrpe"
+	"pkg/snclient"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	nrpeCmd := &cobra.Command{
+		Use:   "nrpe [options]",
+		Short: "Query remote nrpe agents",
+		Long: `Query remote nrpe agents just like the check_nrpe plugin.
+
+SSL is used by default, version 4 packets are tried first with
+a fallback to version 2 packets for older agents.
+
+Examples:
+
+# run the version check of the remote agent:
+snclient nrpe -H 10.0.1.5
+
+# run check_load with arguments:
+snclient nrpe -H 10.0.1.5 -c check_load -a "warn=load > 5" "crit=load > 10"
+
+# show all options:
+snclient nrpe --help
+`,
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			agentFlags.Mode = snclient.ModeOneShot
+			setInteractiveStdoutLogger()
+
+			rc := check_nrpe.Check(context.Background(), cmd.OutOrStdout(), args)
+			fmt.Fprintf(cmd.OutOrStdout(), "\n")
+			os.Exit(rc)
+		},
+	}
+	rootCmd.AddCommand(nrpeCmd)
+}
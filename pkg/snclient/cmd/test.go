@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"os/user"
 	"strings"
 
 	"pkg/snclient"
@@ -108,7 +110,13 @@ func testPrompt(cmd *cobra.Command, snc *snclient.Agent) {
 }
 
 func testRunCheck(cmd *cobra.Command, snc *snclient.Agent, args []string) int {
-	res := snc.RunCheck(args[0], args[1:])
+	// local user is used as identity in the audit log
+	identity := ""
+	if current, err := user.Current(); err == nil {
+		identity = current.Username
+	}
+	ctx := snclient.WithRequestSource(context.Background(), "cli", "", identity)
+	res := snc.RunCheckWithContext(ctx, args[0], args[1:])
 	switch cmd.CalledAs() {
 	case "test":
 		testPrintHuman(cmd, res)
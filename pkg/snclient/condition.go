@@ -29,6 +29,10 @@ type Condition struct {
 	value    interface{}
 	unit     string
 
+	// in case keyword or value are arithmetic expressions, ex.: used / size > 0.9
+	keywordExpr *ConditionExpr
+	valueExpr   *ConditionExpr
+
 	// in case this is a group of conditions
 	group         []*Condition
 	groupOperator GroupOperator
@@ -204,6 +208,13 @@ func (c *Condition) matchSingle(data map[string]string, notExists bool) bool {
 		return notExists
 	}
 	condStr := fmt.Sprintf("%v", c.value)
+	if c.valueExpr != nil {
+		condNum, ok := c.valueExpr.Eval(data)
+		if !ok {
+			return notExists
+		}
+		condStr = convert.Num2String(condNum)
+	}
 	varNum, err1 := strconv.ParseFloat(varStr, 64)
 	condNum, err2 := strconv.ParseFloat(condStr, 64)
 	switch c.operator {
@@ -318,6 +329,15 @@ func (c *Condition) matchSingle(data map[string]string, notExists bool) bool {
 // tries keyword_pct for % unit and keyword_bytes for B unit
 // returns value from keyword unless found already
 func (c *Condition) getVarValue(data map[string]string) (varStr string, ok bool) {
+	if c.keywordExpr != nil {
+		num, ok := c.keywordExpr.Eval(data)
+		if !ok {
+			return "", false
+		}
+
+		return convert.Num2String(num), true
+	}
+
 	switch {
 	case c.unit == "%":
 		varStr, ok = data[c.keyword+"_pct"]
@@ -348,6 +368,8 @@ func (c *Condition) Clone() *Condition {
 		operator:      c.operator,
 		unit:          c.unit,
 		value:         c.value,
+		keywordExpr:   c.keywordExpr,
+		valueExpr:     c.valueExpr,
 		groupOperator: c.groupOperator,
 		group:         make([]*Condition, 0),
 	}
@@ -359,6 +381,34 @@ func (c *Condition) Clone() *Condition {
 	return clone
 }
 
+// usesKeyword returns true if the condition keyword is one of the given names or
+// in case of an expression, if the expression uses any of them.
+func (c *Condition) usesKeyword(names []string) bool {
+	if slices.Contains(names, c.keyword) {
+		return true
+	}
+	if c.keywordExpr == nil {
+		return false
+	}
+	for _, attr := range c.keywordExpr.Attributes() {
+		if slices.Contains(names, attr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNumericOperator returns true if the operator compares numbers
+func (c *Condition) isNumericOperator() bool {
+	switch c.operator { //nolint:exhaustive // only numeric operators are relevant
+	case Equal, Unequal, Lower, LowerEqual, Greater, GreaterEqual:
+		return true
+	}
+
+	return false
+}
+
 // add parsed condition, returns remaining token
 func conditionAdd(token []string) (cond *Condition, remaining []string, err error) {
 	if len(token) == 0 {
@@ -390,8 +440,8 @@ func conditionAdd(token []string) (cond *Condition, remaining []string, err erro
 			groupOp = operator
 		}
 
-		// check if we start with a bracket
-		if strings.HasPrefix(token[0], "(") {
+		// check if we start with a bracket which is not part of an expression
+		if strings.HasPrefix(token[0], "(") && !isConditionExprBracket(token) {
 			token[0] = strings.TrimPrefix(token[0], "(")
 			// advance token if it was only the bracket itself
 			if token[0] == "" {
@@ -436,17 +486,27 @@ func conditionAdd(token []string) (cond *Condition, remaining []string, err erro
 
 // parse and remove next keyword/op/value combo from token list
 func conditionNext(token []string) (cond *Condition, remaining []string, err error) {
-	keyword := token[0]
-	token = token[1:]
+	var keyword string
+	var keywordExpr *ConditionExpr
+	if isConditionExprStart(token) {
+		keyword, token = conditionExprToken(token, false)
+		keywordExpr, err = NewConditionExpr(keyword)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		keyword = token[0]
+		token = token[1:]
 
-	// keyword might cuddle with operator
-	match := reCuddleKeyword.FindStringSubmatch(keyword)
-	if len(match) > 0 {
-		keyword = match[1]
-		if match[3] == "" {
-			token = append([]string{match[2]}, token...)
-		} else {
-			token = append([]string{match[2], match[3]}, token...)
+		// keyword might cuddle with operator
+		match := reCuddleKeyword.FindStringSubmatch(keyword)
+		if len(match) > 0 {
+			keyword = match[1]
+			if match[3] == "" {
+				token = append([]string{match[2]}, token...)
+			} else {
+				token = append([]string{match[2], match[3]}, token...)
+			}
 		}
 	}
 
@@ -456,7 +516,7 @@ func conditionNext(token []string) (cond *Condition, remaining []string, err err
 	query := keyword
 
 	// operator might cuddle with value
-	match = reCuddleOperator.FindStringSubmatch(token[0])
+	match := reCuddleOperator.FindStringSubmatch(token[0])
 	if len(match) > 0 && match[2] != "" {
 		token = append([]string{match[1], match[2]}, token[1:]...)
 	}
@@ -468,7 +528,8 @@ func conditionNext(token []string) (cond *Condition, remaining []string, err err
 	}
 
 	cond = &Condition{
-		keyword: keyword,
+		keyword:     keyword,
+		keywordExpr: keywordExpr,
 	}
 
 	token = conditionFixTokenOperator(token)
@@ -485,6 +546,23 @@ func conditionNext(token []string) (cond *Condition, remaining []string, err err
 		return nil, nil, fmt.Errorf("expected value after '%s'", query)
 	}
 
+	// value might be an expression as well, ex.: rss > 2 * avg_rss
+	if cond.isNumericOperator() && isConditionExprValueStart(token) {
+		var value string
+		value, token = conditionExprToken(token, true)
+		cond.valueExpr, err = NewConditionExpr(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		cond.value = cond.valueExpr.String()
+		// compare against the numeric value of the keyword as well
+		if cond.keywordExpr == nil {
+			cond.keywordExpr = &ConditionExpr{source: keyword, attribute: keyword}
+		}
+
+		return cond, token, nil
+	}
+
 	rem, err := conditionValue(cond, token)
 	if err != nil {
 		return nil, nil, err
@@ -701,6 +779,9 @@ func ThresholdString(name []string, conditions []*Condition, numberFormat func(i
 		}
 	}
 
+	// dynamic thresholds from expressions cannot be used as performance data threshold
+	filtered = slices.DeleteFunc(filtered, func(cond *Condition) bool { return cond.valueExpr != nil })
+
 	if len(filtered) == 0 {
 		return ""
 	}
@@ -0,0 +1,488 @@
+package snclient
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/humanize"
+	"pkg/utils"
+
+	"golang.org/x/exp/slices"
+)
+
+var (
+	reExprFunctionStart  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\(`)
+	reExprInlineOperator = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*[+*/]`)
+	reExprNumber         = regexp.MustCompile(`^(\d+\.\d+|\d+|\.\d+)([A-Za-z%]*)`)
+	reExprIdentifier     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*`)
+
+	// exprDateFormats contains the date formats supported by the age() function
+	exprDateFormats = []string{
+		"2006-01-02 15:04:05 MST",
+		"2006-01-02 15:04:05",
+		time.RFC3339,
+		"2006-01-02",
+	}
+)
+
+// ConditionExpr is an arithmetic expression used on either side of a condition, ex.: used / size > 0.9
+type ConditionExpr struct {
+	source string
+
+	operator  string           // +, -, *, / or the function name
+	number    float64          // constant value
+	attribute string           // attribute name from the data map
+	args      []*ConditionExpr // operands or function arguments
+}
+
+// conditionExprFunction defines a function usable in expressions
+type conditionExprFunction struct {
+	numArgs int // required number of arguments, -1 means at least one
+	eval    func(args []float64) float64
+}
+
+var conditionExprFunctions = map[string]conditionExprFunction{
+	"abs":   {1, func(args []float64) float64 { return math.Abs(args[0]) }},
+	"ceil":  {1, func(args []float64) float64 { return math.Ceil(args[0]) }},
+	"floor": {1, func(args []float64) float64 { return math.Floor(args[0]) }},
+	"round": {1, func(args []float64) float64 { return math.Round(args[0]) }},
+	"min":   {-1, func(args []float64) float64 { return slices.Min(args) }},
+	"max":   {-1, func(args []float64) float64 { return slices.Max(args) }},
+	// age is handled separately since it has to parse dates
+	"age": {1, nil},
+}
+
+// NewConditionExpr parses an arithmetic expression.
+func NewConditionExpr(input string) (*ConditionExpr, error) {
+	parser := &conditionExprParser{input: input}
+	expr, err := parser.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipSpace()
+	if parser.pos < len(parser.input) {
+		return nil, fmt.Errorf("unexpected '%s' in expression '%s'", parser.input[parser.pos:], input)
+	}
+	expr.source = strings.TrimSpace(input)
+
+	return expr, nil
+}
+
+// isConditionExprStart returns true if the token list starts with an expression instead of a plain keyword.
+func isConditionExprStart(token []string) bool {
+	if len(token) == 0 {
+		return false
+	}
+	if reExprFunctionStart.MatchString(token[0]) {
+		// function calls which are actually operators, ex.: in('a', 'b')
+		_, err := OperatorParse(token[0][:strings.Index(token[0], "(")])
+
+		return err != nil
+	}
+	if reExprInlineOperator.MatchString(token[0]) || isConditionExprBracket(token) {
+		return true
+	}
+
+	return len(token) > 1 && isConditionExprOperator(token[1])
+}
+
+// isConditionExprBracket returns true if the token list starts with a bracket which is part
+// of an expression, ex.: (used + free) / size, instead of starting a group of conditions.
+func isConditionExprBracket(token []string) bool {
+	if len(token) == 0 || !strings.HasPrefix(token[0], "(") {
+		return false
+	}
+
+	depth := 0
+	for num, str := range token {
+		for idx, char := range str {
+			switch char {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth != 0 {
+				continue
+			}
+			// check what follows the matching closing bracket
+			next := str[idx+1:]
+			if next == "" && num+1 < len(token) {
+				next = token[num+1]
+			}
+
+			return next != "" && strings.ContainsAny(next[:1], "+-*/<>=!~")
+		}
+	}
+
+	return false
+}
+
+// isConditionExprValueStart returns true if the token list starts with an expression instead of a plain value.
+// Values are more strict than keywords and only support known functions to not break string values.
+func isConditionExprValueStart(token []string) bool {
+	if reExprFunctionStart.MatchString(token[0]) {
+		_, ok := conditionExprFunctions[strings.ToLower(token[0][:strings.Index(token[0], "(")])]
+
+		return ok
+	}
+
+	return len(token) > 1 && isConditionExprOperator(token[1])
+}
+
+// conditionExprToken consumes all token belonging to an expression and returns the joined expression along with the remaining token.
+// Keyword expressions end with the comparison operator, value expressions end with the next logical operator.
+func conditionExprToken(token []string, isValue bool) (expr string, remaining []string) {
+	parts := []string{}
+	depth := 0
+	for len(token) > 0 {
+		str := token[0]
+		if isValue {
+			if _, err := GroupOperatorParse(str); err == nil {
+				break
+			}
+		} else {
+			if _, err := OperatorParse(str); err == nil || strings.EqualFold(str, "not") {
+				break
+			}
+			// operator might cuddle with the expression, ex.: used/size>0.9
+			if idx := strings.IndexAny(str, "<>=!~"); idx == 0 {
+				break
+			} else if idx > 0 {
+				token = append([]string{str[:idx], str[idx:]}, token[1:]...)
+				str = str[:idx]
+			}
+		}
+		token = token[1:]
+
+		// closing brackets which do not belong to the expression end a condition group
+		for idx, char := range str {
+			switch char {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth >= 0 {
+				continue
+			}
+			for _, rest := range strings.Split(str[idx:], "") {
+				token = append([]string{rest}, token...)
+			}
+			str = str[:idx]
+
+			break
+		}
+		if str != "" {
+			parts = append(parts, str)
+		}
+		if depth < 0 {
+			break
+		}
+	}
+
+	return strings.Join(parts, " "), token
+}
+
+func isConditionExprOperator(token string) bool {
+	switch token {
+	case "+", "-", "*", "/":
+		return true
+	}
+
+	return false
+}
+
+// Eval returns the result of the expression for given attributes. ok is false if
+// an attribute does not exist or the expression cannot be evaluated, ex.: division by zero.
+func (e *ConditionExpr) Eval(data map[string]string) (res float64, ok bool) {
+	switch {
+	case e.attribute != "":
+		return e.attributeValue(data)
+	case e.operator == "":
+		return e.number, true
+	case e.operator == "age":
+		return e.evalAge(data)
+	}
+
+	args := make([]float64, 0, len(e.args))
+	for _, arg := range e.args {
+		val, ok := arg.Eval(data)
+		if !ok {
+			return 0, false
+		}
+		args = append(args, val)
+	}
+
+	switch e.operator {
+	case "+":
+		return args[0] + args[1], true
+	case "-":
+		return args[0] - args[1], true
+	case "*":
+		return args[0] * args[1], true
+	case "/":
+		if args[1] == 0 {
+			return 0, false
+		}
+
+		return args[0] / args[1], true
+	}
+
+	if fn, ok := conditionExprFunctions[e.operator]; ok {
+		return fn.eval(args), true
+	}
+
+	return 0, false
+}
+
+// Attributes returns all attribute names used in this expression.
+func (e *ConditionExpr) Attributes() []string {
+	if e.attribute != "" {
+		return []string{e.attribute}
+	}
+
+	attributes := []string{}
+	for _, arg := range e.args {
+		attributes = append(attributes, arg.Attributes()...)
+	}
+
+	return attributes
+}
+
+// String returns the expression source.
+func (e *ConditionExpr) String() string {
+	return e.source
+}
+
+// attributeValue returns the numeric value of an attribute, it prefers the raw
+// numeric attributes (_value and _bytes) over human readable ones.
+func (e *ConditionExpr) attributeValue(data map[string]string) (res float64, ok bool) {
+	for _, key := range []string{e.attribute + "_value", e.attribute, e.attribute + "_bytes"} {
+		if val, ok := data[key]; ok {
+			num, err := strconv.ParseFloat(val, 64)
+			if err == nil {
+				return num, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// evalAge returns the number of seconds since the given unix timestamp or date.
+func (e *ConditionExpr) evalAge(data map[string]string) (res float64, ok bool) {
+	arg := e.args[0]
+	if arg.attribute == "" {
+		val, ok := arg.Eval(data)
+		if !ok {
+			return 0, false
+		}
+
+		return float64(time.Now().Unix()) - val, true
+	}
+
+	for _, key := range []string{arg.attribute + "_unix", arg.attribute} {
+		val, ok := data[key]
+		if !ok {
+			continue
+		}
+		if num, err := strconv.ParseFloat(val, 64); err == nil {
+			return float64(time.Now().Unix()) - num, true
+		}
+		for _, format := range exprDateFormats {
+			if date, err := time.Parse(format, val); err == nil {
+				return time.Since(date).Seconds(), true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// conditionExprParser is a simple recursive descent parser for arithmetic expressions.
+type conditionExprParser struct {
+	input string
+	pos   int
+}
+
+func (p *conditionExprParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space character or 0 at the end of input
+func (p *conditionExprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+// parseSum parses: product (('+'|'-') product)*
+func (p *conditionExprParser) parseSum() (*ConditionExpr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator := p.peek()
+		if operator != '+' && operator != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &ConditionExpr{operator: string(operator), args: []*ConditionExpr{left, right}}
+	}
+}
+
+// parseProduct parses: factor (('*'|'/') factor)*
+func (p *conditionExprParser) parseProduct() (*ConditionExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator := p.peek()
+		if operator != '*' && operator != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &ConditionExpr{operator: string(operator), args: []*ConditionExpr{left, right}}
+	}
+}
+
+// parseFactor parses numbers, attributes, function calls, brackets and unary minus
+func (p *conditionExprParser) parseFactor() (*ConditionExpr, error) {
+	char := p.peek()
+	switch {
+	case char == 0:
+		return nil, fmt.Errorf("unexpected end of expression '%s'", p.input)
+	case char == '-':
+		p.pos++
+		arg, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ConditionExpr{operator: "-", args: []*ConditionExpr{{}, arg}}, nil
+	case char == '(':
+		p.pos++
+		expr, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("expected closing bracket in expression '%s'", p.input)
+		}
+		p.pos++
+
+		return expr, nil
+	}
+
+	rest := p.input[p.pos:]
+	if match := reExprNumber.FindStringSubmatch(rest); len(match) > 0 {
+		p.pos += len(match[0])
+
+		num, err := parseConditionExprNumber(match[1], match[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return &ConditionExpr{number: num}, nil
+	}
+
+	name := reExprIdentifier.FindString(rest)
+	if name == "" {
+		return nil, fmt.Errorf("unexpected '%s' in expression '%s'", rest, p.input)
+	}
+	p.pos += len(name)
+
+	if p.pos < len(p.input) && p.input[p.pos] == '(' {
+		p.pos++
+
+		return p.parseFunction(strings.ToLower(name))
+	}
+
+	return &ConditionExpr{attribute: name}, nil
+}
+
+// parseFunction parses the comma separated function arguments
+func (p *conditionExprParser) parseFunction(name string) (*ConditionExpr, error) {
+	function, ok := conditionExprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s' in expression '%s'", name, p.input)
+	}
+
+	expr := &ConditionExpr{operator: name}
+	for {
+		if p.peek() == ')' && len(expr.args) == 0 {
+			p.pos++
+
+			break
+		}
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		expr.args = append(expr.args, arg)
+
+		next := p.peek()
+		p.pos++
+		if next == ')' {
+			break
+		}
+		if next != ',' {
+			return nil, fmt.Errorf("expected closing bracket in expression '%s'", p.input)
+		}
+	}
+
+	switch {
+	case function.numArgs == -1 && len(expr.args) == 0:
+		return nil, fmt.Errorf("function %s() requires at least one argument", name)
+	case function.numArgs > 0 && len(expr.args) != function.numArgs:
+		return nil, fmt.Errorf("function %s() requires %d argument(s)", name, function.numArgs)
+	}
+
+	return expr, nil
+}
+
+// parseConditionExprNumber converts numbers with unit into their base unit, ex.: 500ms into 0.5 (seconds) or 1kB into 1000 (bytes)
+func parseConditionExprNumber(num, unit string) (float64, error) {
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse number %s: %s", num, err.Error())
+	}
+
+	if unit == "" || unit == "%" {
+		return value, nil
+	}
+
+	if duration, err := utils.ExpandDuration(num + strings.ToLower(unit)); err == nil {
+		return duration, nil
+	}
+
+	bytes, err := humanize.ParseBytes(num + unit)
+	if err != nil {
+		return 0, fmt.Errorf("unknown unit %s%s in expression", num, unit)
+	}
+
+	return float64(bytes), nil
+}
@@ -3,6 +3,7 @@ package snclient
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"pkg/convert"
 
@@ -173,3 +174,70 @@ func TestConditionThresholdString(t *testing.T) {
 		assert.Equalf(t, check.expect, perfRange, fmt.Sprintf("ThresholdString(%s) -> (%v) = %v", check.threshold, perfRange, check.expect))
 	}
 }
+
+func TestConditionExpression(t *testing.T) {
+	written := time.Now().Add(-2 * time.Hour)
+	data := map[string]string{
+		"used":       "90 GB",
+		"used_bytes": "90",
+		"size":       "100",
+		"rss":        "300",
+		"avg_rss":    "100",
+		"offset":     "-600",
+		"written":    written.Format("2006-01-02 15:04:05 MST"),
+		"zero":       "0",
+	}
+
+	for _, check := range []struct {
+		threshold string
+		expect    bool
+	}{
+		{"used / size > 0.8", true},
+		{"used / size > 0.9", false},
+		{"used/size>0.8", true},
+		{"rss > 2 * avg_rss", true},
+		{"rss > 3 * avg_rss", false},
+		{"rss >= avg_rss * 3", true},
+		{"rss - avg_rss = 200", true},
+		{"(rss + avg_rss) / 2 = 200", true},
+		{"(rss + avg_rss) / 2 > 200", false},
+		{"abs(offset) > 500ms", true},
+		{"abs(offset) > 700", false},
+		{"age(written) > 1h", true},
+		{"age(written) > 3h", false},
+		{"max(rss, avg_rss, 500) = 500", true},
+		{"min(rss, avg_rss) < 150", true},
+		{"round(used / size * 100) = 90", true},
+		{"used > size * 0.8", true},
+		{"used > size * 0.8 and rss < 500", true},
+		{"(used > size * 0.8) and rss < 500", true},
+		{"(rss > used_bytes * 2) or (abs(offset) > 1000)", true},
+		{"(rss > used_bytes * 4) or (abs(offset) > 1000)", false},
+		{"rss / zero > 1", false},
+		{"missing / size > 1", false},
+	} {
+		cond, err := NewCondition(check.threshold)
+		require.NoErrorf(t, err, "parsed expression %s", check.threshold)
+		assert.Equalf(t, check.expect, cond.Match(data, false), fmt.Sprintf("Compare(%s) -> %v", check.threshold, check.expect))
+	}
+
+	for _, threshold := range []string{
+		"foo(used) > 1",
+		"abs(used, size) > 1",
+		"max() > 1",
+		"used / > 1",
+		"(used / size > 1",
+		"used / size > abs(",
+	} {
+		cond, err := NewCondition(threshold)
+		require.Errorf(t, err, "expression %s should error", threshold)
+		assert.Nilf(t, cond, "expression %s errors should not return condition", threshold)
+	}
+}
+
+func TestConditionExpressionThresholdString(t *testing.T) {
+	threshold, err := NewCondition("test > max_test * 0.9")
+	require.NoErrorf(t, err, "parsed threshold")
+	perfRange := ThresholdString([]string{"test"}, []*Condition{threshold}, convert.Num2String)
+	assert.Equalf(t, "", perfRange, "expressions are not used as performance data threshold")
+}
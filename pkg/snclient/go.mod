@@ -12,6 +12,8 @@ replace pkg/humanize => ../../pkg/humanize
 
 replace pkg/nrpe => ../../pkg/nrpe
 
+replace pkg/nsca => ../../pkg/nsca
+
 replace pkg/snclient => ../../pkg/snclient
 
 replace pkg/snclient/cmd => ../../pkg/snclient/cmd
@@ -24,6 +26,8 @@ replace pkg/check_dns => ../../pkg/check_dns
 
 replace pkg/check_tcp => ../../pkg/check_tcp
 
+replace pkg/check_nrpe => ../../pkg/check_nrpe
+
 replace github.com/shirou/gopsutil/v3 => github.com/sni/gopsutil/v3 v3.0.0-20240129124248-a5f3e5722a21
 
 require (
@@ -34,6 +38,8 @@ require (
 	github.com/kdar/factorlog v0.0.0-20211012144011-6ea75a169038
 	github.com/otiai10/copy v1.14.0
 	github.com/prometheus/client_golang v1.19.0
+	github.com/prometheus/client_model v0.6.0
+	github.com/prometheus/common v0.49.0
 	github.com/sasha-s/go-deadlock v0.3.1
 	github.com/sassoftware/go-rpmutils v0.3.0
 	github.com/sevlyar/go-daemon v0.1.6
@@ -41,16 +47,19 @@ require (
 	github.com/sni/check_http_go/pkg/checkhttp v0.0.0-20231227232912-71c069b10aae
 	github.com/sni/shelltoken v0.0.0-20240305201340-d67cf5c19d23
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.21.0
 	golang.org/x/exp v0.0.0-20240222234643-814bf88cf225
 	golang.org/x/sys v0.18.0
 	gopkg.in/yaml.v3 v3.0.1
 	pkg/check_dns v0.0.0-00010101000000-000000000000
+	pkg/check_nrpe v0.0.0-00010101000000-000000000000
 	pkg/check_tcp v0.0.0-00010101000000-000000000000
 	pkg/convert v0.0.0-00010101000000-000000000000
 	pkg/dump v0.0.0-00010101000000-000000000000
 	pkg/eventlog v0.0.0-00010101000000-000000000000
 	pkg/humanize v0.0.0-00010101000000-000000000000
 	pkg/nrpe v0.0.0-00010101000000-000000000000
+	pkg/nsca v0.0.0-00010101000000-000000000000
 	pkg/utils v0.0.0-00010101000000-000000000000
 	pkg/wmi v0.0.0-00010101000000-000000000000
 )
@@ -75,8 +84,6 @@ require (
 	github.com/petermattis/goid v0.0.0-20231207134359-e60b3f734c67 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/power-devops/perfstat v0.0.0-20240221224432-82ca36839d55 // indirect
-	github.com/prometheus/client_model v0.6.0 // indirect
-	github.com/prometheus/common v0.49.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
 	github.com/rickb777/date v1.20.6 // indirect
 	github.com/rickb777/plural v1.4.1 // indirect
@@ -86,7 +93,6 @@ require (
 	github.com/ulikunitz/xz v0.5.11 // indirect
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/mod v0.16.0 // indirect
 	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/sync v0.6.0 // indirect
@@ -1,9 +1,11 @@
 package snclient
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -65,6 +67,33 @@ func (snc *Agent) httpDo(ctx context.Context, options *HTTPClientOptions, method
 	return resp, nil
 }
 
+// httpPostJSON posts given payload as json and returns an error unless the response status is 2xx
+func (snc *Agent) httpPostJSON(ctx context.Context, options *HTTPClientOptions, url string, header map[string]string, payload []byte) error {
+	client := snc.httpClient(options)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("new request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range header {
+		req.Header.Set(key, val)
+	}
+
+	log.Tracef("http POST %s", url)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http post failed %s: %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("http post failed %s: %s", url, resp.Status)
+	}
+
+	return nil
+}
+
 // create http client options from config section
 func (snc *Agent) buildClientHTTPOptions(section *ConfigSection) (options *HTTPClientOptions, err error) {
 	options = &HTTPClientOptions{
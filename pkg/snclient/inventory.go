@@ -0,0 +1,54 @@
+package snclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AvailableInventory contains all registered inventory providers
+var AvailableInventory = make(map[string]InventoryProvider)
+
+// inventoryRoot is prepended to all files read by inventory providers
+var inventoryRoot = "/"
+
+// InventoryProvider collects inventory entries which are not available from any check.
+type InventoryProvider struct {
+	Name        string
+	Description string
+	Implemented Implemented
+	Collect     func(ctx context.Context, snc *Agent, root string) ([]map[string]string, error)
+}
+
+// readInventoryFile returns the trimmed content of a file below root or an empty string if it cannot be read
+func readInventoryFile(root string, path ...string) string {
+	data, err := os.ReadFile(filepath.Join(append([]string{root}, path...)...))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// readInventoryLines calls fn for each line of the file below root
+func readInventoryLines(root, path string, fn func(line string)) error {
+	file, err := os.Open(filepath.Join(root, path))
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %s", path, err.Error())
+	}
+
+	return nil
+}
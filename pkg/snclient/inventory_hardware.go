@@ -0,0 +1,182 @@
+package snclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"pkg/convert"
+)
+
+func init() {
+	AvailableInventory["cpu_info"] = InventoryProvider{
+		Name:        "cpu_info",
+		Description: "CPU model, cores and threads per socket from /proc/cpuinfo",
+		Implemented: Linux,
+		Collect:     inventoryCPUInfo,
+	}
+	AvailableInventory["memory_modules"] = InventoryProvider{
+		Name:        "memory_modules",
+		Description: "Memory modules (DIMMs) with size and type from the EDAC sysfs interface",
+		Implemented: Linux,
+		Collect:     inventoryMemoryModules,
+	}
+	AvailableInventory["block_devices"] = InventoryProvider{
+		Name:        "block_devices",
+		Description: "Block devices with size, model and serial from /sys/block",
+		Implemented: Linux,
+		Collect:     inventoryBlockDevices,
+	}
+}
+
+// inventoryCPUInfo returns one entry per physical cpu socket
+func inventoryCPUInfo(_ context.Context, _ *Agent, root string) ([]map[string]string, error) {
+	type cpuSocket struct {
+		entry   map[string]string
+		cores   map[string]bool
+		threads int
+	}
+	sockets := map[string]*cpuSocket{}
+
+	processor := map[string]string{}
+	addProcessor := func() {
+		if _, ok := processor["processor"]; !ok {
+			return
+		}
+		id := processor["physical id"]
+		if id == "" {
+			id = "0"
+		}
+		socket, ok := sockets[id]
+		if !ok {
+			model := processor["model name"]
+			if model == "" {
+				// arm and others use different names
+				model = processor["Processor"]
+			}
+			socket = &cpuSocket{
+				entry: map[string]string{
+					"socket": id,
+					"vendor": processor["vendor_id"],
+					"model":  model,
+					"cache":  processor["cache size"],
+				},
+				cores: map[string]bool{},
+			}
+			sockets[id] = socket
+		}
+		socket.threads++
+		coreID := processor["core id"]
+		if coreID == "" {
+			coreID = processor["processor"]
+		}
+		socket.cores[coreID] = true
+	}
+
+	err := readInventoryLines(root, "proc/cpuinfo", func(line string) {
+		if strings.TrimSpace(line) == "" {
+			addProcessor()
+			processor = map[string]string{}
+
+			return
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if ok {
+			processor[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	addProcessor()
+
+	list := make([]map[string]string, 0, len(sockets))
+	for _, socket := range sockets {
+		socket.entry["cores"] = fmt.Sprintf("%d", len(socket.cores))
+		socket.entry["threads"] = fmt.Sprintf("%d", socket.threads)
+		list = append(list, socket.entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return convert.Int64(list[i]["socket"]) < convert.Int64(list[j]["socket"])
+	})
+
+	return list, nil
+}
+
+// inventoryMemoryModules returns installed memory modules from all edac memory controllers
+func inventoryMemoryModules(_ context.Context, _ *Agent, root string) ([]map[string]string, error) {
+	dimms, err := filepath.Glob(filepath.Join(root, "sys", "devices", "system", "edac", "mc", "mc*", "dimm*"))
+	if err != nil {
+		return nil, fmt.Errorf("glob: %s", err.Error())
+	}
+	sort.Strings(dimms)
+
+	list := make([]map[string]string, 0, len(dimms))
+	for _, dimm := range dimms {
+		sizeMB := convert.Int64(readInventoryFile(dimm, "size"))
+		if sizeMB == 0 {
+			// empty slot
+			continue
+		}
+		list = append(list, map[string]string{
+			"name":      filepath.Base(filepath.Dir(dimm)) + "/" + filepath.Base(dimm),
+			"label":     readInventoryFile(dimm, "dimm_label"),
+			"location":  readInventoryFile(dimm, "dimm_location"),
+			"type":      readInventoryFile(dimm, "dimm_mem_type"),
+			"edac_mode": readInventoryFile(dimm, "dimm_edac_mode"),
+			"size":      fmt.Sprintf("%d", sizeMB*1024*1024),
+		})
+	}
+
+	return list, nil
+}
+
+// inventoryBlockDevices returns all block devices except loop and ram devices
+func inventoryBlockDevices(_ context.Context, _ *Agent, root string) ([]map[string]string, error) {
+	blockDir := filepath.Join(root, "sys", "block")
+	files, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %s", err.Error())
+	}
+
+	list := make([]map[string]string, 0, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		dir := filepath.Join(blockDir, name)
+
+		// size is always in 512 byte sectors
+		sectors := convert.Int64(readInventoryFile(dir, "size"))
+		list = append(list, map[string]string{
+			"name":       name,
+			"size":       fmt.Sprintf("%d", sectors*512),
+			"vendor":     readInventoryFile(dir, "device", "vendor"),
+			"model":      readInventoryFile(dir, "device", "model"),
+			"serial":     blockDeviceSerial(dir),
+			"rotational": readInventoryFile(dir, "queue", "rotational"),
+			"removable":  readInventoryFile(dir, "removable"),
+		})
+	}
+
+	return list, nil
+}
+
+// blockDeviceSerial returns the serial from sysfs (nvme, virtio) or the scsi vital product data page 0x80
+func blockDeviceSerial(dir string) string {
+	if serial := readInventoryFile(dir, "device", "serial"); serial != "" {
+		return serial
+	}
+
+	// page 0x80 contains a 4 byte header followed by the serial number
+	data, err := os.ReadFile(filepath.Join(dir, "device", "vpd_pg80"))
+	if err != nil || len(data) <= 4 {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Trim(string(data[4:]), "\x00"))
+}
@@ -0,0 +1,127 @@
+package snclient
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const inventoryTestRoot = "t/inventory"
+
+func TestInventoryHardware(t *testing.T) {
+	ctx := context.TODO()
+
+	cpus, err := inventoryCPUInfo(ctx, nil, inventoryTestRoot)
+	require.NoError(t, err)
+	assert.Equalf(t, []map[string]string{
+		{"socket": "0", "vendor": "GenuineIntel", "model": "Intel(R) Xeon(R) E-2234 CPU @ 3.60GHz", "cache": "8192 KB", "cores": "2", "threads": "4"},
+		{"socket": "1", "vendor": "GenuineIntel", "model": "Intel(R) Xeon(R) E-2234 CPU @ 3.60GHz", "cache": "8192 KB", "cores": "1", "threads": "1"},
+	}, cpus, "cpu sockets")
+
+	dimms, err := inventoryMemoryModules(ctx, nil, inventoryTestRoot)
+	require.NoError(t, err)
+	require.Lenf(t, dimms, 2, "empty slots are skipped")
+	assert.Equalf(t, map[string]string{
+		"name":      "mc0/dimm1",
+		"label":     "CPU_SrcID#0_MC#0_Chan#1_DIMM#0",
+		"location":  "channel 1 slot 0",
+		"type":      "DDR4",
+		"edac_mode": "SECDED",
+		"size":      "17179869184",
+	}, dimms[1], "memory module")
+
+	disks, err := inventoryBlockDevices(ctx, nil, inventoryTestRoot)
+	require.NoError(t, err)
+	assert.Equalf(t, []map[string]string{
+		{"name": "nvme0n1", "size": "512110190592", "vendor": "", "model": "Samsung SSD 970 EVO Plus 500GB", "serial": "S4EVNX0N123456A", "rotational": "0", "removable": "0"},
+		{"name": "sda", "size": "1000204886016", "vendor": "ATA", "model": "ST1000DM010-2EP1", "serial": "Z9A1B2C3", "rotational": "1", "removable": "0"},
+	}, disks, "block devices without loop devices")
+}
+
+func TestInventorySoftware(t *testing.T) {
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	tmpPath := MockSystemUtilities(t, map[string]string{
+		"rpm": "bash\t5.1.8-6.el9\tx86_64\ngpg-pubkey\t3228467c-613798eb\t(none)\nkernel-core\t5.14.0-362.el9\tx86_64\nkernel-core\t5.14.0-427.el9\tx86_64",
+	})
+	defer os.RemoveAll(tmpPath)
+
+	packages, err := inventoryPackages(context.TODO(), snc, inventoryTestRoot)
+	require.NoError(t, err)
+	assert.Equalf(t, []map[string]string{
+		{"id": "bash:x86_64", "name": "bash", "version": "5.1.8-6.el9", "arch": "x86_64", "source": "rpm"},
+		{"id": "kernel-core:x86_64", "name": "kernel-core", "version": "5.14.0-362.el9", "arch": "x86_64", "source": "rpm"},
+		{"id": "kernel-core:x86_64:5.14.0-427.el9", "name": "kernel-core", "version": "5.14.0-427.el9", "arch": "x86_64", "source": "rpm"},
+		{"id": "libc6:amd64", "name": "libc6", "version": "2.36-9+deb12u4", "arch": "amd64", "source": "dpkg"},
+		{"id": "libc6:i386", "name": "libc6", "version": "2.36-9+deb12u4", "arch": "i386", "source": "dpkg"},
+		{"id": "openssh-server:amd64", "name": "openssh-server", "version": "1:9.2p1-2+deb12u2", "arch": "amd64", "source": "dpkg"},
+	}, packages, "installed packages")
+
+	_, err = inventoryPackages(context.TODO(), snc, t.TempDir())
+	require.Errorf(t, err, "no package database")
+
+	// rpm database without working rpm command still returns the dpkg packages
+	failPath := MockSystemUtilities(t, map[string]string{
+		"rpm":      "error: cannot open Packages database",
+		"rpm_exit": "1",
+	})
+	defer os.RemoveAll(failPath)
+
+	packages, err = inventoryPackages(context.TODO(), snc, inventoryTestRoot)
+	require.NoErrorf(t, err, "failing rpm is ignored")
+	assert.Equalf(t, []map[string]string{
+		{"id": "libc6:amd64", "name": "libc6", "version": "2.36-9+deb12u4", "arch": "amd64", "source": "dpkg"},
+		{"id": "libc6:i386", "name": "libc6", "version": "2.36-9+deb12u4", "arch": "i386", "source": "dpkg"},
+		{"id": "openssh-server:amd64", "name": "openssh-server", "version": "1:9.2p1-2+deb12u2", "arch": "amd64", "source": "dpkg"},
+	}, packages, "dpkg packages")
+
+	modules, err := inventoryKernelModules(context.TODO(), nil, inventoryTestRoot)
+	require.NoError(t, err)
+	assert.Equalf(t, []map[string]string{
+		{"name": "e1000e", "size": "327680", "used": "0", "used_by": "", "state": "Live", "version": "3.2.6-k"},
+		{"name": "nf_tables", "size": "282624", "used": "5", "used_by": "nft_compat", "state": "Live", "version": ""},
+		{"name": "nft_compat", "size": "20480", "used": "2", "used_by": "", "state": "Live", "version": ""},
+	}, modules, "kernel modules")
+}
+
+func TestInventorySystem(t *testing.T) {
+	ctx := context.TODO()
+
+	sockets, err := inventoryListeningSockets(ctx, nil, inventoryTestRoot)
+	require.NoError(t, err)
+	assert.Equalf(t, []map[string]string{
+		{"socket": "tcp 0.0.0.0:22", "protocol": "tcp", "address": "0.0.0.0", "port": "22", "uid": "0", "user": "root", "pid": "812", "process": "sshd"},
+		{"socket": "tcp 127.0.0.1:25", "protocol": "tcp", "address": "127.0.0.1", "port": "25", "uid": "0", "user": "root", "pid": "", "process": ""},
+		{"socket": "tcp6 [::]:22", "protocol": "tcp6", "address": "::", "port": "22", "uid": "0", "user": "root", "pid": "812", "process": "sshd"},
+		{"socket": "tcp6 [::1]:8080", "protocol": "tcp6", "address": "::1", "port": "8080", "uid": "999", "user": "app", "pid": "", "process": ""},
+		{"socket": "udp 127.0.0.53:53", "protocol": "udp", "address": "127.0.0.53", "port": "53", "uid": "101", "user": "systemd-resolve", "pid": "1033", "process": "systemd-resolve"},
+	}, sockets, "listening sockets")
+
+	users, err := inventoryUsers(ctx, nil, inventoryTestRoot)
+	require.NoError(t, err)
+	require.Lenf(t, users, 3, "users found")
+	assert.Equalf(t, map[string]string{"name": "app", "uid": "999", "gid": "999", "comment": "Application User", "home": "/opt/app", "shell": "/bin/sh"}, users[2], "user entry")
+
+	groups, err := inventoryGroups(ctx, nil, inventoryTestRoot)
+	require.NoError(t, err)
+	assert.Equalf(t, map[string]string{"name": "sudo", "gid": "27", "members": "app,admin"}, groups[1], "group entry")
+}
+
+func TestInventoryProviders(t *testing.T) {
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	defer func(root string) { inventoryRoot = root }(inventoryRoot)
+	inventoryRoot = inventoryTestRoot
+
+	inventory := snc.BuildInventory(context.TODO(), []string{"users", "cpu_info"})
+	data, ok := inventory["inventory"].(map[string]interface{})
+	require.Truef(t, ok, "inventory has correct type")
+	assert.Lenf(t, data, 2, "only selected modules are returned")
+	assert.Lenf(t, data["users"], 3, "users from provider")
+	assert.Lenf(t, data["cpu_info"], 2, "cpu info from provider")
+}
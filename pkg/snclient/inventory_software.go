@@ -0,0 +1,171 @@
+package snclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+	AvailableInventory["packages"] = InventoryProvider{
+		Name:        "packages",
+		Description: "Installed packages with versions from the dpkg and rpm database",
+		Implemented: Linux,
+		Collect:     inventoryPackages,
+	}
+	AvailableInventory["kernel_modules"] = InventoryProvider{
+		Name:        "kernel_modules",
+		Description: "Loaded kernel modules from /proc/modules",
+		Implemented: Linux,
+		Collect:     inventoryKernelModules,
+	}
+}
+
+// inventoryPackages returns installed packages from dpkg and rpm, whatever is available
+func inventoryPackages(ctx context.Context, snc *Agent, root string) ([]map[string]string, error) {
+	list := []map[string]string{}
+	found := 0
+
+	if _, err := os.Stat(filepath.Join(root, "var", "lib", "dpkg", "status")); err == nil {
+		found++
+		packages, err := inventoryDpkgPackages(root)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, packages...)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "var", "lib", "rpm")); err == nil {
+		found++
+		packages, err := inventoryRpmPackages(ctx, snc, root)
+		switch {
+		case err != nil && found > 1:
+			// debian hosts may have a rpm database without a working rpm command, keep the dpkg packages then
+			log.Warnf("inventory packages: %s", err.Error())
+		case err != nil:
+			return nil, err
+		default:
+			list = append(list, packages...)
+		}
+	}
+
+	if found == 0 {
+		return nil, fmt.Errorf("no suitable package database found, supported are dpkg and rpm")
+	}
+
+	// packages may be installed in multiple versions, ex.: kernels
+	seen := map[string]bool{}
+	for _, entry := range list {
+		id := entry["name"] + ":" + entry["arch"]
+		if seen[id] {
+			id += ":" + entry["version"]
+		}
+		seen[id] = true
+		entry["id"] = id
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i]["id"] < list[j]["id"] })
+
+	return list, nil
+}
+
+// inventoryDpkgPackages parses the dpkg status file which contains one paragraph per package
+func inventoryDpkgPackages(root string) ([]map[string]string, error) {
+	list := []map[string]string{}
+	fields := map[string]string{}
+	addPackage := func() {
+		if fields["Package"] != "" && strings.HasSuffix(fields["Status"], " installed") {
+			list = append(list, map[string]string{
+				"name":    fields["Package"],
+				"version": fields["Version"],
+				"arch":    fields["Architecture"],
+				"source":  "dpkg",
+			})
+		}
+		fields = map[string]string{}
+	}
+
+	err := readInventoryLines(root, filepath.Join("var", "lib", "dpkg", "status"), func(line string) {
+		switch {
+		case line == "":
+			addPackage()
+		case strings.HasPrefix(line, " "), strings.HasPrefix(line, "\t"):
+			// continuation of multi line fields
+		default:
+			key, val, ok := strings.Cut(line, ":")
+			if ok {
+				fields[key] = strings.TrimSpace(val)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	addPackage()
+
+	return list, nil
+}
+
+// inventoryRpmPackages queries the rpm database, which is not readable without the rpm library
+func inventoryRpmPackages(ctx context.Context, snc *Agent, root string) ([]map[string]string, error) {
+	command := `rpm -qa --queryformat '%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\n'`
+	if root != "/" {
+		command += " --root '" + root + "'"
+	}
+	output, stderr, exitCode, err := snc.execCommand(ctx, command, DefaultCmdTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("rpm failed: %s\n%s", err.Error(), stderr)
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("rpm failed: %s\n%s", output, stderr)
+	}
+
+	list := []map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		cols := strings.Split(strings.TrimSpace(line), "\t")
+		if len(cols) < 3 || cols[0] == "gpg-pubkey" {
+			continue
+		}
+		list = append(list, map[string]string{
+			"name":    cols[0],
+			"version": cols[1],
+			"arch":    cols[2],
+			"source":  "rpm",
+		})
+	}
+
+	return list, nil
+}
+
+// inventoryKernelModules parses /proc/modules: name size refcount dependencies state address
+func inventoryKernelModules(_ context.Context, _ *Agent, root string) ([]map[string]string, error) {
+	list := []map[string]string{}
+	err := readInventoryLines(root, filepath.Join("proc", "modules"), func(line string) {
+		cols := strings.Fields(line)
+		if len(cols) < 5 {
+			return
+		}
+		usedBy := strings.TrimSuffix(cols[3], ",")
+		if usedBy == "-" {
+			usedBy = ""
+		}
+		list = append(list, map[string]string{
+			"name":    cols[0],
+			"size":    cols[1],
+			"used":    cols[2],
+			"used_by": usedBy,
+			"state":   cols[4],
+			"version": readInventoryFile(root, "sys", "module", cols[0], "version"),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i]["name"] < list[j]["name"] })
+
+	return list, nil
+}
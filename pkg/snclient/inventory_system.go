@@ -0,0 +1,228 @@
+package snclient
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pkg/convert"
+)
+
+func init() {
+	AvailableInventory["listening_sockets"] = InventoryProvider{
+		Name:        "listening_sockets",
+		Description: "Listening tcp and udp sockets with owning process from /proc/net",
+		Implemented: Linux,
+		Collect:     inventoryListeningSockets,
+	}
+	AvailableInventory["users"] = InventoryProvider{
+		Name:        "users",
+		Description: "Local users from /etc/passwd",
+		Implemented: Linux | FreeBSD,
+		Collect:     inventoryUsers,
+	}
+	AvailableInventory["groups"] = InventoryProvider{
+		Name:        "groups",
+		Description: "Local groups from /etc/group",
+		Implemented: Linux | FreeBSD,
+		Collect:     inventoryGroups,
+	}
+}
+
+const (
+	procNetTCPListen    = "0A"
+	procNetUDPUnconnect = "07"
+)
+
+// inventoryListeningSockets returns all listening sockets, the owning process is only known for processes we are allowed to inspect
+func inventoryListeningSockets(ctx context.Context, snc *Agent, root string) ([]map[string]string, error) {
+	list := []map[string]string{}
+	inodes := map[string]map[string]string{}
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		listenState := procNetTCPListen
+		if strings.HasPrefix(protocol, "udp") {
+			listenState = procNetUDPUnconnect
+		}
+
+		err := readInventoryLines(root, filepath.Join("proc", "net", protocol), func(line string) {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			cols := strings.Fields(line)
+			if len(cols) < 10 || cols[3] != listenState {
+				return
+			}
+			address, port, err := parseProcNetAddress(cols[1])
+			if err != nil {
+				log.Debugf("%s: %s", protocol, err.Error())
+
+				return
+			}
+			if _, remotePort, _ := parseProcNetAddress(cols[2]); remotePort != 0 {
+				// connected udp socket
+				return
+			}
+			entry := map[string]string{
+				"socket":   fmt.Sprintf("%s %s", protocol, net.JoinHostPort(address, fmt.Sprintf("%d", port))),
+				"protocol": protocol,
+				"address":  address,
+				"port":     fmt.Sprintf("%d", port),
+				"uid":      cols[7],
+				"pid":      "",
+				"process":  "",
+			}
+			inodes[cols[9]] = entry
+			list = append(list, entry)
+		})
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// ex.: ipv6 is disabled
+				continue
+			}
+
+			return nil, err
+		}
+	}
+
+	inventorySocketOwners(root, inodes)
+
+	users := map[string]string{}
+	if passwd, err := inventoryUsers(ctx, snc, root); err == nil {
+		for _, user := range passwd {
+			users[user["uid"]] = user["name"]
+		}
+	}
+	for _, entry := range list {
+		entry["user"] = users[entry["uid"]]
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i]["protocol"] != list[j]["protocol"] {
+			return list[i]["protocol"] < list[j]["protocol"]
+		}
+		if list[i]["port"] != list[j]["port"] {
+			return convert.Int64(list[i]["port"]) < convert.Int64(list[j]["port"])
+		}
+
+		return list[i]["address"] < list[j]["address"]
+	})
+
+	return list, nil
+}
+
+// inventorySocketOwners sets the pid and process name by searching the socket inodes in all file descriptors
+func inventorySocketOwners(root string, inodes map[string]map[string]string) {
+	if len(inodes) == 0 {
+		return
+	}
+
+	procs, err := os.ReadDir(filepath.Join(root, "proc"))
+	if err != nil {
+		return
+	}
+	pids := []int{}
+	for _, proc := range procs {
+		if pid, err := strconv.Atoi(proc.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	// prefer the parent process if sockets are shared with forked children
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		fdDir := filepath.Join(root, "proc", fmt.Sprintf("%d", pid), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			inode, ok := strings.CutPrefix(link, "socket:[")
+			if !ok {
+				continue
+			}
+			entry, ok := inodes[strings.TrimSuffix(inode, "]")]
+			if !ok || entry["pid"] != "" {
+				continue
+			}
+			entry["pid"] = fmt.Sprintf("%d", pid)
+			entry["process"] = readInventoryFile(root, "proc", fmt.Sprintf("%d", pid), "comm")
+		}
+	}
+}
+
+// parseProcNetAddress parses hex encoded addresses like 0100007F:0016, ipv6 addresses are stored as 4 little endian words
+func parseProcNetAddress(raw string) (address string, port int64, err error) {
+	hexAddr, hexPort, ok := strings.Cut(raw, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address: %s", raw)
+	}
+
+	port, err = strconv.ParseInt(hexPort, 16, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port: %s", raw)
+	}
+
+	data, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(data) != net.IPv4len && len(data) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address: %s", raw)
+	}
+	for i := 0; i < len(data); i += 4 {
+		data[i], data[i+1], data[i+2], data[i+3] = data[i+3], data[i+2], data[i+1], data[i]
+	}
+
+	return net.IP(data).String(), port, nil
+}
+
+// inventoryUsers parses the passwd file: name:password:uid:gid:comment:home:shell
+func inventoryUsers(_ context.Context, _ *Agent, root string) ([]map[string]string, error) {
+	list := []map[string]string{}
+	err := readInventoryLines(root, filepath.Join("etc", "passwd"), func(line string) {
+		cols := strings.Split(line, ":")
+		if len(cols) < 7 || strings.HasPrefix(cols[0], "#") {
+			return
+		}
+		list = append(list, map[string]string{
+			"name":    cols[0],
+			"uid":     cols[2],
+			"gid":     cols[3],
+			"comment": cols[4],
+			"home":    cols[5],
+			"shell":   cols[6],
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// inventoryGroups parses the group file: name:password:gid:members
+func inventoryGroups(_ context.Context, _ *Agent, root string) ([]map[string]string, error) {
+	list := []map[string]string{}
+	err := readInventoryLines(root, filepath.Join("etc", "group"), func(line string) {
+		cols := strings.Split(line, ":")
+		if len(cols) < 4 || strings.HasPrefix(cols[0], "#") {
+			return
+		}
+		list = append(list, map[string]string{
+			"name":    cols[0],
+			"gid":     cols[2],
+			"members": cols[3],
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
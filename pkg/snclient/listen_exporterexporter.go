@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -129,6 +130,7 @@ func (l *HandlerExporterExporter) GetMappings(*Agent) []URLMapping {
 	return []URLMapping{
 		{URL: l.urlPrefix + "/list", Handler: l.handler},
 		{URL: l.urlPrefix + "/proxy", Handler: l.handler},
+		{URL: l.urlPrefix + "/merge", Handler: l.handler},
 	}
 }
 
@@ -176,6 +178,9 @@ func modulesAdd(snc *Agent, modules map[string]*exporterModuleConfig, entry fs.D
 		return fmt.Errorf("failed reading configs %s, %w", fullpath, err)
 	}
 	mcfg.snc = snc
+	mcfg.Exec.mcfg = mcfg
+	mcfg.HTTP.mcfg = mcfg
+	mcfg.File.mcfg = mcfg
 
 	if mcfg.Timeout == 0 {
 		mcfg.Timeout = DefaultSocketTimeout * time.Second
@@ -198,6 +203,8 @@ func (l *HandlerWebExporterExporter) ServeHTTP(res http.ResponseWriter, req *htt
 		l.Handler.listModules(res, req)
 	case "/proxy":
 		l.Handler.doProxy(res, req)
+	case "/merge":
+		l.Handler.doMerge(res, req)
 	default:
 		res.WriteHeader(http.StatusNotFound)
 		LogError2(res.Write([]byte("404 - nothing here\n")))
@@ -258,9 +265,10 @@ func (l *HandlerExporterExporter) doProxy(res http.ResponseWriter, req *http.Req
 }
 
 type exporterModuleConfig struct {
-	Method  string                 `yaml:"method"`
-	Timeout time.Duration          `yaml:"timeout"`
-	XXX     map[string]interface{} `yaml:",inline"`
+	Method  string                   `yaml:"method"`
+	Timeout time.Duration            `yaml:"timeout"`
+	Relabel []*exporterRelabelConfig `yaml:"relabel_configs"`
+	XXX     map[string]interface{}   `yaml:",inline"`
 
 	Exec exporterExecConfig `yaml:"exec"`
 	HTTP exporterHTTPConfig `yaml:"http"`
@@ -328,6 +336,12 @@ func checkModuleConfig(name string, cfg *exporterModuleConfig) error {
 
 	cfg.name = name
 
+	for _, relabel := range cfg.Relabel {
+		if err := relabel.init(); err != nil {
+			return fmt.Errorf("invalid relabel config in module %v: %s", name, err.Error())
+		}
+	}
+
 	switch cfg.Method {
 	case "http":
 		if len(cfg.HTTP.XXX) != 0 {
@@ -469,13 +483,10 @@ func (cfg *exporterModuleConfig) ServeHTTP(res http.ResponseWriter, req *http.Re
 
 	switch cfg.Method {
 	case "exec":
-		cfg.Exec.mcfg = cfg
 		cfg.Exec.ServeHTTP(res, wrapReq)
 	case "http":
-		cfg.HTTP.mcfg = cfg
 		cfg.HTTP.ServeHTTP(res, wrapReq)
 	case "file":
-		cfg.File.mcfg = cfg
 		cfg.File.ServeHTTP(res, wrapReq)
 	default:
 		log.Errorf("unknown module method  %v\n", cfg.Method)
@@ -486,26 +497,37 @@ func (cfg *exporterModuleConfig) ServeHTTP(res http.ResponseWriter, req *http.Re
 }
 
 func (m exporterFileConfig) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	ctx := req.Context()
-	deadline, _ := ctx.Deadline()
-	data, mtime, err := readFileWithDeadline(m.Path, deadline)
+	data, err := m.read(req.Context())
 	if err != nil {
 		http.Error(res, fmt.Sprintf("file module error: %s\n", err.Error()), http.StatusInternalServerError)
 
 		return
 	}
 
-	data = bytes.TrimSpace(data)
 	res.WriteHeader(http.StatusOK)
 	LogError2(res.Write(data))
-	LogError2(res.Write([]byte("\n")))
+}
+
+// read returns the file content followed by the mtime metric
+func (m exporterFileConfig) read(ctx context.Context) ([]byte, error) {
+	deadline, _ := ctx.Deadline()
+	data, mtime, err := readFileWithDeadline(m.Path, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	buf.Write(bytes.TrimSpace(data))
+	buf.WriteString("\n")
 
 	// add mtime metric
 	if !mtime.IsZero() {
-		LogError2(res.Write([]byte("# HELP expexp_file_mtime_timestamp Time of modification of parsed file\n")))
-		LogError2(res.Write([]byte("# TYPE expexp_file_mtime_timestamp gauge\n")))
-		LogError2(fmt.Fprintf(res, "expexp_file_mtime_timestamp{module=\"%s\",path=\"%s\"} %d\n", m.mcfg.name, m.Path, mtime.Unix()))
+		buf.WriteString("# HELP expexp_file_mtime_timestamp Time of modification of parsed file\n")
+		buf.WriteString("# TYPE expexp_file_mtime_timestamp gauge\n")
+		fmt.Fprintf(&buf, "expexp_file_mtime_timestamp{module=\"%s\",path=\"%s\"} %d\n", m.mcfg.name, m.Path, mtime.Unix())
 	}
+
+	return buf.Bytes(), nil
 }
 
 func readFileWithDeadline(path string, deadline time.Time) ([]byte, time.Time, error) {
@@ -517,7 +539,8 @@ func readFileWithDeadline(path string, deadline time.Time) ([]byte, time.Time, e
 	defer file.Close()
 
 	if !deadline.IsZero() {
-		if err2 := file.SetDeadline(deadline); err2 != nil {
+		// regular files do not support deadlines, only pipes do
+		if err2 := file.SetDeadline(deadline); err2 != nil && !errors.Is(err2, os.ErrNoDeadline) {
 			return nil, mtime, fmt.Errorf("file.SetDeadline %s: %s", path, err2.Error())
 		}
 	}
@@ -528,39 +551,48 @@ func readFileWithDeadline(path string, deadline time.Time) ([]byte, time.Time, e
 		}
 	}
 	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, mtime, fmt.Errorf("io.read %s: %s", path, err.Error())
+	}
 
-	return data, mtime, fmt.Errorf("io.read %s: %s", path, err.Error())
+	return data, mtime, nil
 }
 
 func (m exporterExecConfig) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	ctx := req.Context()
-	cmd, err := m.mcfg.snc.MakeCmd(ctx, m.Command)
+	stdout, err := m.run(req.Context())
 	if err != nil {
-		http.Error(res, fmt.Sprintf("exec module error: %s\n", err.Error()), http.StatusInternalServerError)
+		http.Error(res, err.Error()+"\n", http.StatusInternalServerError)
 
 		return
 	}
+
+	res.WriteHeader(http.StatusOK)
+	LogError2(res.Write(stdout))
+}
+
+// run executes the command and returns its stdout
+func (m exporterExecConfig) run(ctx context.Context) ([]byte, error) {
+	cmd, err := m.mcfg.snc.MakeCmd(ctx, m.Command)
+	if err != nil {
+		return nil, fmt.Errorf("exec module error: %s", err.Error())
+	}
 	cmd.Path = m.Command
-	cmd.Args = m.Args
+	cmd.Args = append([]string{m.Command}, m.Args...)
 	for k, v := range m.Env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
 
-	deadline, ok := ctx.Deadline()
-	if !ok {
-		deadline = time.Now().Add(DefaultSocketTimeout * time.Second)
+	timeout := int64(DefaultSocketTimeout)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = int64(math.Ceil(time.Until(deadline).Seconds()))
 	}
-	stdout, stderr, _, _, err := m.mcfg.snc.runExternalCommand(ctx, cmd, deadline.Unix())
+	stdout, stderr, _, _, err := m.mcfg.snc.runExternalCommand(ctx, cmd, timeout)
 	if err != nil {
-		http.Error(res, fmt.Sprintf("exec module error: %s\n", err.Error()), http.StatusInternalServerError)
-
-		return
+		return nil, fmt.Errorf("exec module error: %s", err.Error())
 	}
 	if stderr != "" {
 		log.Warnf("expexp module %s stderr: %s", m.mcfg.name, stderr)
 	}
 
-	res.WriteHeader(http.StatusOK)
-	LogError2(res.Write([]byte(stdout)))
-	LogError2(res.Write([]byte("\n")))
+	return []byte(stdout + "\n"), nil
 }
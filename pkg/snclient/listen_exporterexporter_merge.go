@@ -0,0 +1,352 @@
+package snclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// exporterRelabelConfig is a prometheus style relabel rule which is applied to all metrics of a module in the merge endpoint.
+type exporterRelabelConfig struct {
+	SourceLabels []string               `yaml:"source_labels"`
+	Separator    *string                `yaml:"separator"`    // ;
+	Regex        string                 `yaml:"regex"`        // (.*)
+	TargetLabel  string                 `yaml:"target_label"` // no default
+	Replacement  *string                `yaml:"replacement"`  // $1
+	Action       string                 `yaml:"action"`       // replace
+	XXX          map[string]interface{} `yaml:",inline"`
+	regex        *regexp.Regexp
+}
+
+// exporterScrapeResult contains the parsed metrics of a single module.
+type exporterScrapeResult struct {
+	name     string
+	families map[string]*dto.MetricFamily
+	err      error
+}
+
+func (l *HandlerExporterExporter) doMerge(res http.ResponseWriter, req *http.Request) {
+	names := req.URL.Query()["module"]
+	if len(names) == 0 {
+		for name := range l.modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		if _, ok := l.modules[name]; !ok {
+			log.Warnf("unknown module requested  %v\n", name)
+			http.Error(res, fmt.Sprintf("unknown module %v\n", name), http.StatusNotFound)
+
+			return
+		}
+	}
+
+	log.Debugf("merging modules %v\n", names)
+
+	results := make([]*exporterScrapeResult, len(names))
+	waitGroup := sync.WaitGroup{}
+	for i, name := range names {
+		// a panicking module leaves this failed result behind and is reported as down
+		results[i] = &exporterScrapeResult{name: name, err: fmt.Errorf("scraping module failed unexpectedly")}
+		waitGroup.Add(1)
+		go func(i int, mcfg *exporterModuleConfig) {
+			defer l.snc.logPanicRecover()
+			defer waitGroup.Done()
+			results[i] = mcfg.scrapeFamilies(req.Context())
+		}(i, l.modules[name])
+	}
+	waitGroup.Wait()
+
+	families := mergeMetricFamilies(results)
+
+	format := expfmt.NewFormat(expfmt.TypeTextPlain)
+	res.Header().Set("Content-Type", string(format))
+	res.WriteHeader(http.StatusOK)
+	encoder := expfmt.NewEncoder(res, format)
+	for _, family := range families {
+		LogError(encoder.Encode(family))
+	}
+}
+
+// mergeMetricFamilies combines all module results into a sorted list of metric families and adds the up metric for each module
+func mergeMetricFamilies(results []*exporterScrapeResult) []*dto.MetricFamily {
+	upName, upHelp, upType := "up", "Whether the exporter module could be scraped successfully.", dto.MetricType_GAUGE
+	upFamily := &dto.MetricFamily{Name: &upName, Help: &upHelp, Type: &upType}
+
+	merged := map[string]*dto.MetricFamily{}
+	for _, result := range results {
+		upValue := 1.0
+		if result.err != nil {
+			log.Warnf("expexp module %s failed: %s", result.name, result.err.Error())
+			upValue = 0
+		}
+		upFamily.Metric = append(upFamily.Metric, &dto.Metric{
+			Label: []*dto.LabelPair{newLabelPair("module", result.name)},
+			Gauge: &dto.Gauge{Value: &upValue},
+		})
+
+		for name, family := range result.families {
+			existing, ok := merged[name]
+			switch {
+			case !ok:
+				merged[name] = family
+			case existing.GetType() != family.GetType():
+				log.Warnf("expexp module %s: skipping metric %s, type %s does not match type %s from other modules",
+					result.name, name, family.GetType(), existing.GetType())
+			default:
+				existing.Metric = append(existing.Metric, family.Metric...)
+			}
+		}
+	}
+
+	if existing, ok := merged[upName]; ok && existing.GetType() == upType {
+		// generated up series take precedence over duplicates from the modules
+		existing.Metric = append(upFamily.Metric, existing.Metric...)
+	} else {
+		merged[upName] = upFamily
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(merged))
+	for _, family := range merged {
+		family.Metric = dedupeMetrics(family)
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+
+	return families
+}
+
+// dedupeMetrics removes series with identical labels, which may be left over after relabeling. Prometheus rejects
+// the whole scrape if it contains duplicate series, so only the first one is kept.
+func dedupeMetrics(family *dto.MetricFamily) []*dto.Metric {
+	seen := map[string]bool{}
+	metrics := make([]*dto.Metric, 0, len(family.Metric))
+	for _, metric := range family.Metric {
+		labels := make([]string, 0, len(metric.Label))
+		for _, label := range metric.Label {
+			labels = append(labels, label.GetName()+"="+strconv.Quote(label.GetValue()))
+		}
+		sort.Strings(labels)
+		key := strings.Join(labels, ",")
+		if seen[key] {
+			log.Warnf("expexp: skipping duplicate series %s{%s}", family.GetName(), key)
+
+			continue
+		}
+		seen[key] = true
+		metrics = append(metrics, metric)
+	}
+
+	return metrics
+}
+
+// scrapeFamilies scrapes the module and returns the relabeled metric families
+func (cfg *exporterModuleConfig) scrapeFamilies(ctx context.Context) *exporterScrapeResult {
+	result := &exporterScrapeResult{name: cfg.name}
+
+	data, err := cfg.scrape(ctx)
+	if err != nil {
+		result.err = err
+
+		return result
+	}
+
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		result.err = fmt.Errorf("parsing metrics failed: %s", err.Error())
+
+		return result
+	}
+
+	for name, family := range families {
+		metrics := make([]*dto.Metric, 0, len(family.Metric))
+		for _, metric := range family.Metric {
+			if cfg.relabelMetric(name, metric) {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
+			delete(families, name)
+
+			continue
+		}
+		family.Metric = metrics
+	}
+	result.families = families
+
+	return result
+}
+
+// relabelMetric adds the module label and applies all relabel rules, returns false if the metric should be dropped
+func (cfg *exporterModuleConfig) relabelMetric(name string, metric *dto.Metric) bool {
+	labels := map[string]string{}
+	for _, label := range metric.Label {
+		labels[label.GetName()] = label.GetValue()
+	}
+	labels["module"] = cfg.name
+	labels["__name__"] = name
+
+	for _, relabel := range cfg.Relabel {
+		if !relabel.apply(labels) {
+			return false
+		}
+	}
+
+	metric.Label = make([]*dto.LabelPair, 0, len(labels))
+	for key, val := range labels {
+		if key == "__name__" || val == "" {
+			continue
+		}
+		metric.Label = append(metric.Label, newLabelPair(key, val))
+	}
+	sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+
+	return true
+}
+
+// scrape returns the raw metrics of the module
+func (cfg *exporterModuleConfig) scrape(ctx context.Context) ([]byte, error) {
+	if cfg.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	switch cfg.Method {
+	case "exec":
+		return cfg.Exec.run(ctx)
+	case "http":
+		return cfg.HTTP.fetch(ctx)
+	case "file":
+		return cfg.File.read(ctx)
+	default:
+		return nil, fmt.Errorf("unknown module method %v", cfg.Method)
+	}
+}
+
+// fetch requests the metrics from the exporter
+func (m *exporterHTTPConfig) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("http module error: %s", err.Error())
+	}
+	// the director removes the first module parameter which is our own one
+	req.URL = &url.URL{RawQuery: url.Values{"module": []string{m.mcfg.name}}.Encode()}
+	m.ReverseProxy.Director(req)
+
+	client := &http.Client{Transport: m.ReverseProxy.Transport}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http module error: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("http module error: %s", err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http module error: %s", res.Status)
+	}
+
+	return body, nil
+}
+
+func (r *exporterRelabelConfig) init() error {
+	if len(r.XXX) != 0 {
+		return fmt.Errorf("unknown relabel configuration fields: %v", r.XXX)
+	}
+
+	if r.Action == "" {
+		r.Action = "replace"
+	}
+	if r.Separator == nil {
+		separator := ";"
+		r.Separator = &separator
+	}
+	if r.Replacement == nil {
+		replacement := "$1"
+		r.Replacement = &replacement
+	}
+	if r.Regex == "" {
+		r.Regex = "(.*)"
+	}
+
+	regex, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex %s: %s", r.Regex, err.Error())
+	}
+	r.regex = regex
+
+	switch r.Action {
+	case "replace":
+		if r.TargetLabel == "" {
+			return fmt.Errorf("replace action requires a target_label")
+		}
+		if r.TargetLabel == "__name__" {
+			return fmt.Errorf("renaming metrics is not supported")
+		}
+	case "keep", "drop", "labelkeep", "labeldrop":
+	default:
+		return fmt.Errorf("unknown relabel action: %s", r.Action)
+	}
+
+	return nil
+}
+
+// apply changes the labels in place and returns false if the metric should be dropped
+func (r *exporterRelabelConfig) apply(labels map[string]string) bool {
+	values := make([]string, 0, len(r.SourceLabels))
+	for _, label := range r.SourceLabels {
+		values = append(values, labels[label])
+	}
+	value := strings.Join(values, *r.Separator)
+
+	switch r.Action {
+	case "keep":
+		return r.regex.MatchString(value)
+	case "drop":
+		return !r.regex.MatchString(value)
+	case "labelkeep", "labeldrop":
+		keep := r.Action == "labelkeep"
+		for name := range labels {
+			if name == "__name__" || name == "module" {
+				continue
+			}
+			if r.regex.MatchString(name) != keep {
+				delete(labels, name)
+			}
+		}
+	case "replace":
+		indexes := r.regex.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+		replaced := string(r.regex.ExpandString([]byte{}, *r.Replacement, value, indexes))
+		if replaced == "" {
+			delete(labels, r.TargetLabel)
+		} else {
+			labels[r.TargetLabel] = replaced
+		}
+	}
+
+	return true
+}
+
+func newLabelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
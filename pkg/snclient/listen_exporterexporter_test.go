@@ -0,0 +1,166 @@
+package snclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporterExporterProxy(t *testing.T) {
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	moduleDir := t.TempDir()
+	textFile := filepath.Join(moduleDir, "metrics.prom")
+	writeTestFile(t, textFile, "# TYPE backup_last_success gauge\nbackup_last_success{job=\"db\"} 1\n")
+	writeTestFile(t, filepath.Join(moduleDir, "backup.yaml"), fmt.Sprintf(`
+method: file
+file:
+  path: %s
+`, textFile))
+	writeTestFile(t, filepath.Join(moduleDir, "echo.yaml"), `
+method: exec
+exec:
+  command: /bin/echo
+  args: [expexp_test_metric, "1"]
+`)
+
+	handler := &HandlerExporterExporter{snc: snc}
+	modules, err := handler.readModules(snc, moduleDir)
+	require.NoErrorf(t, err, "read modules")
+	handler.modules = modules
+	web := &HandlerWebExporterExporter{Handler: handler}
+
+	res := httptest.NewRecorder()
+	web.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/proxy?module=backup", http.NoBody))
+	assert.Equalf(t, http.StatusOK, res.Code, "file module succeeds")
+	assert.Containsf(t, res.Body.String(), `backup_last_success{job="db"} 1`, "file content")
+	assert.Containsf(t, res.Body.String(), `expexp_file_mtime_timestamp{module="backup",path=`, "file mtime metric")
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	res = httptest.NewRecorder()
+	web.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/proxy?module=echo", http.NoBody))
+	assert.Equalf(t, http.StatusOK, res.Code, "exec module succeeds")
+	assert.Containsf(t, res.Body.String(), "expexp_test_metric 1\n", "exec passes all arguments")
+}
+
+func TestExporterExporterMerge(t *testing.T) {
+	snc := StartTestAgent(t, "")
+	defer StopTestAgent(t, snc)
+
+	exporter := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		LogError2(fmt.Fprintf(res, "%s\n", strings.Join([]string{
+			"# HELP http_requests_total Total requests.",
+			"# TYPE http_requests_total counter",
+			`http_requests_total{code="200",instance="localhost:9100"} 5`,
+			`http_requests_total{code="500",instance="localhost:9100"} 1`,
+			`http_requests_total{code="500",instance="localhost:9101"} 2`,
+			"# TYPE go_goroutines gauge",
+			"go_goroutines 7",
+		}, "\n")))
+	}))
+	defer exporter.Close()
+	exporterURL, err := url.Parse(exporter.URL)
+	require.NoErrorf(t, err, "parse url")
+
+	moduleDir := t.TempDir()
+	textFile := filepath.Join(moduleDir, "metrics.prom")
+	writeTestFile(t, textFile, "# TYPE backup_last_success gauge\nbackup_last_success{job=\"db\"} 1\n")
+	writeTestFile(t, filepath.Join(moduleDir, "node.yaml"), fmt.Sprintf(`
+method: http
+http:
+  address: 127.0.0.1
+  port: %s
+relabel_configs:
+  - source_labels: [__name__]
+    regex: go_.*
+    action: drop
+  - source_labels: [instance]
+    regex: (.*):\d+
+    target_label: host
+  - regex: instance
+    action: labeldrop
+`, exporterURL.Port()))
+	writeTestFile(t, filepath.Join(moduleDir, "backup.yaml"), fmt.Sprintf(`
+method: file
+file:
+  path: %s
+`, textFile))
+	writeTestFile(t, filepath.Join(moduleDir, "broken.yaml"), `
+method: exec
+exec:
+  command: /does/not/exist
+`)
+
+	handler := &HandlerExporterExporter{snc: snc}
+	handler.modules, err = handler.readModules(snc, moduleDir)
+	require.NoErrorf(t, err, "read modules")
+	// uninitialized http module panics while scraping
+	handler.modules["panic"] = &exporterModuleConfig{Method: "http", snc: snc, name: "panic"}
+
+	web := &HandlerWebExporterExporter{Handler: handler}
+	res := httptest.NewRecorder()
+	web.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/merge", http.NoBody))
+	assert.Equalf(t, http.StatusOK, res.Code, "merge request succeeds")
+
+	body := res.Body.String()
+	assert.Containsf(t, body, `http_requests_total{code="200",host="localhost",module="node"} 5`, "relabeled http metric")
+	assert.Containsf(t, body, `http_requests_total{code="500",host="localhost",module="node"} 1`, "relabeled http metric")
+	assert.Equalf(t, 1, strings.Count(body, `http_requests_total{code="500",host="localhost",module="node"}`), "duplicate series are removed")
+	assert.NotContainsf(t, body, "go_goroutines", "dropped metric")
+	assert.Containsf(t, body, `backup_last_success{job="db",module="backup"} 1`, "file metric")
+	assert.Containsf(t, body, `expexp_file_mtime_timestamp{module="backup",path=`, "file mtime metric")
+	assert.Containsf(t, body, `up{module="backup"} 1`, "file module is up")
+	assert.Containsf(t, body, `up{module="broken"} 0`, "exec module failed")
+	assert.Containsf(t, body, `up{module="node"} 1`, "http module is up")
+	assert.Containsf(t, body, `up{module="panic"} 0`, "panicking module is down")
+
+	res = httptest.NewRecorder()
+	web.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/merge?module=backup", http.NoBody))
+	assert.Equalf(t, http.StatusOK, res.Code, "merge request succeeds")
+	assert.NotContainsf(t, res.Body.String(), "http_requests_total", "only selected modules")
+	assert.Containsf(t, res.Body.String(), `up{module="backup"} 1`, "file module is up")
+
+	res = httptest.NewRecorder()
+	web.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/merge?module=unknown", http.NoBody))
+	assert.Equalf(t, http.StatusNotFound, res.Code, "unknown module")
+}
+
+func TestExporterExporterRelabelConfig(t *testing.T) {
+	relabel := &exporterRelabelConfig{Action: "replace", TargetLabel: "__name__"}
+	require.Errorf(t, relabel.init(), "renaming metrics is not supported")
+
+	relabel = &exporterRelabelConfig{Action: "unknown"}
+	require.Errorf(t, relabel.init(), "unknown action")
+
+	relabel = &exporterRelabelConfig{SourceLabels: []string{"job", "instance"}, Regex: "(.*);(.*)", TargetLabel: "target"}
+	require.NoErrorf(t, relabel.init(), "valid config")
+	replacement := "$2/$1"
+	relabel.Replacement = &replacement
+	labels := map[string]string{"job": "db", "instance": "host1"}
+	assert.Truef(t, relabel.apply(labels), "metric is kept")
+	assert.Equalf(t, "host1/db", labels["target"], "replaced label")
+
+	relabel = &exporterRelabelConfig{SourceLabels: []string{"job"}, Regex: "db", Action: "keep"}
+	require.NoErrorf(t, relabel.init(), "valid config")
+	assert.Truef(t, relabel.apply(map[string]string{"job": "db"}), "metric is kept")
+	assert.Falsef(t, relabel.apply(map[string]string{"job": "web"}), "metric is dropped")
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0o600)
+	require.NoErrorf(t, err, "write %s", path)
+}
@@ -1,6 +1,9 @@
 package snclient
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"math"
 	"net"
 	"strings"
@@ -110,24 +113,44 @@ func (l *HandlerNRPE) ServeTCP(snc *Agent, con net.Conn) {
 		return
 	}
 
+	if cmd == "_NRPE_CHECK" {
+		// version check
+		cmd = "check_snclient_version"
+	}
+
 	var statusResult *CheckResult
+	cert := connectionClientCertificate(con)
+	identity := snc.matchClientIdentity(cert)
+	identityName := ""
+	switch {
+	case identity != nil:
+		identityName = identity.name
+	case cert != nil:
+		identityName = cert.Subject.CommonName
+	}
+	ctx := WithRequestSource(context.Background(), l.Type(), con.RemoteAddr().String(), identityName)
+
+	// commands with an argument policy verify their arguments themselves
+	policy := commandArgumentPolicy(cmd)
 
 	switch {
-	case !checkAllowArguments(l.conf, args):
+	case identity != nil && !identity.AllowConnection(con.RemoteAddr().String(), cmd, args):
+		statusResult = &CheckResult{
+			State:  CheckExitUnknown,
+			Output: "Exception processing request: Request not allowed for client identity " + identity.name + ".",
+		}
+	case policy == nil && !checkAllowArguments(l.conf, args):
 		statusResult = &CheckResult{
 			State:  CheckExitUnknown,
 			Output: "Exception processing request: Request contained arguments (check the allow arguments option).",
 		}
-	case !checkNastyCharacters(l.conf, cmd, args):
+	case !checkNastyCharacters(l.conf, cmd, policy.UncheckedArgs(args)):
 		statusResult = &CheckResult{
 			State:  CheckExitUnknown,
 			Output: "Exception processing request: Request contained illegal characters (check the allow nasty characters option).",
 		}
-	case cmd == "_NRPE_CHECK":
-		// version check
-		statusResult = snc.RunCheck("check_snclient_version", args)
 	default:
-		statusResult = snc.RunCheck(cmd, args)
+		statusResult = snc.RunCheckWithContext(ctx, cmd, args)
 	}
 
 	output := statusResult.BuildPluginOutput()
@@ -144,6 +167,21 @@ func (l *HandlerNRPE) ServeTCP(snc *Agent, con net.Conn) {
 	}
 }
 
+// connectionClientCertificate returns the verified client certificate of given connection or nil.
+func connectionClientCertificate(con net.Conn) *x509.Certificate {
+	tlsCon, ok := con.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsCon.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
 func checkAllowArguments(conf *ConfigSection, args []string) bool {
 	allowed, _, err := conf.GetBool("allow arguments")
 	if err != nil {
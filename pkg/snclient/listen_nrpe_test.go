@@ -1,8 +1,18 @@
 package snclient
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
 	"net"
+	"path/filepath"
 	"regexp"
+	"runtime"
 	"testing"
 	"time"
 
@@ -47,3 +57,164 @@ use ssl = false
 
 	StopTestAgent(t, snc)
 }
+
+func TestNRPEArgumentPolicy(t *testing.T) {
+	config := `
+[/modules]
+NRPEServer = enabled
+CheckExternalScripts = enabled
+
+[/settings/NRPE/server]
+port = 45666
+allow arguments = false
+allow nasty characters = false
+use ssl = false
+
+[/settings/external scripts/alias/alias_policy]
+command = check_snclient_version "top-syntax=$ARG1$"
+allowed arguments = arg1
+argument arg1 = [a-z]+
+
+[/settings/external scripts/alias/alias_nopolicy]
+command = check_snclient_version "top-syntax=$ARG1$"
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	query := func(cmd string) string {
+		t.Helper()
+		con, err := net.DialTimeout("tcp", "127.0.0.1:45666", 10*time.Second)
+		require.NoErrorf(t, err, "connection established")
+		defer con.Close()
+
+		req := nrpe.BuildPacketV4(nrpe.NrpeQueryPacket, 0, []byte(cmd))
+		require.NoErrorf(t, req.Write(con), "request send")
+		res, err := nrpe.ReadNrpePacket(con)
+		require.NoErrorf(t, err, "response read")
+		output, _ := res.Data()
+
+		return output
+	}
+
+	assert.Regexpf(t, regexp.MustCompile(`^test \|`), query("alias_policy!test"), "policy allows arguments")
+	assert.Containsf(t, query("alias_policy!Test"), "argument arg1: value does not match", "policy rejects arguments")
+	assert.Containsf(t, query("alias_nopolicy!test"), "check the allow arguments option", "arguments without policy are rejected")
+	assert.Containsf(t, query("check_snclient_version!test"), "check the allow arguments option", "builtin checks are rejected")
+}
+
+func TestNRPEClientIdentity(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+
+	scriptsDir, err := filepath.Abs("t/scripts")
+	require.NoErrorf(t, err, "scripts dir")
+
+	config := fmt.Sprintf(`
+[/modules]
+CheckExternalScripts = enabled
+
+[/paths]
+scripts = %s
+
+[/settings/external scripts]
+allow arguments = true
+
+[/settings/external scripts/scripts/check_identity]
+command = ${scripts}/check_dummy.sh 0 "$IDENTITY$"
+
+[/settings/client identities/naemon]
+common name = naemon.example.com
+
+[/settings/client identities/scraper]
+organizational unit = prometheus
+allowed commands = check_identity
+`, scriptsDir)
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	conf := NewConfigSection(snc.Config, "/settings/NRPE/server")
+	conf.Set("allow arguments", "true")
+	handler := &HandlerNRPE{conf: conf}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoErrorf(t, err, "ca key")
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoErrorf(t, err, "ca certificate")
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoErrorf(t, err, "parse ca certificate")
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert)
+
+	newCert := func(serial int64, subject pkix.Name, usage x509.ExtKeyUsage) tls.Certificate {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoErrorf(t, err, "key")
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      subject,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		require.NoErrorf(t, err, "certificate")
+
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	serverCert := newCert(2, pkix.Name{CommonName: "127.0.0.1"}, x509.ExtKeyUsageServerAuth)
+
+	query := func(subject pkix.Name, cmd string) string {
+		t.Helper()
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    caPool,
+			MinVersion:   tls.VersionTLS12,
+		})
+		require.NoErrorf(t, err, "listen")
+		defer listener.Close()
+		go func() {
+			con, err := listener.Accept()
+			if err == nil {
+				handler.ServeTCP(snc, con)
+			}
+		}()
+
+		client, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			Certificates: []tls.Certificate{newCert(3, subject, x509.ExtKeyUsageClientAuth)},
+			RootCAs:      caPool,
+			ServerName:   "127.0.0.1",
+			MinVersion:   tls.VersionTLS12,
+		})
+		require.NoErrorf(t, err, "connect")
+		defer client.Close()
+
+		req := nrpe.BuildPacketV4(nrpe.NrpeQueryPacket, 0, []byte(cmd))
+		require.NoErrorf(t, req.Write(client), "request send")
+		res, err := nrpe.ReadNrpePacket(client)
+		require.NoErrorf(t, err, "response read")
+		output, _ := res.Data()
+
+		return output
+	}
+
+	scraper := pkix.Name{CommonName: "scraper01", OrganizationalUnit: []string{"prometheus"}}
+	assert.Equalf(t, "OK: scraper", query(scraper, "check_identity"), "mapped identity name is used")
+	assert.Containsf(t, query(scraper, "check_snclient_version"), "not allowed for client identity scraper", "command is not allowed")
+	assert.Containsf(t, query(scraper, "check_identity!arg"), "not allowed for client identity scraper", "arguments are not allowed")
+
+	naemon := pkix.Name{CommonName: "naemon.example.com"}
+	assert.Regexpf(t, regexp.MustCompile("^SNClient"), query(naemon, "check_snclient_version"), "all commands allowed")
+	assert.Equalf(t, "OK: unknown", query(pkix.Name{CommonName: "unknown"}, "check_identity"), "common name of unmapped certificate")
+}
@@ -1,7 +1,7 @@
 package snclient
 
 import (
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"runtime"
 
@@ -47,12 +47,49 @@ var (
 		Help: "Duration of TCP requests.",
 	}, []string{"module"})
 
+	promCheckQueueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snclient_check_queue_length",
+			Help: "number of checks waiting for a free slot",
+		})
+
+	promCheckRunning = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snclient_check_running",
+			Help: "number of currently running checks",
+		})
+
+	promCheckRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snclient_check_rejected_total",
+			Help: "total checks rejected because of the concurrency limits",
+		},
+		[]string{"reason"})
+
+	promCheckCoalescedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "snclient_check_coalesced_total",
+			Help: "total checks which shared the result of an identical running check",
+		})
+
+	promRateLimitedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snclient_rate_limited_total",
+			Help: "total requests rejected by the rate limit",
+		},
+		[]string{"module"})
+
 	promCollectors = []prometheus.Collector{
 		promInfoCount,
 		promHTTPRequestsTotal,
 		promHTTPDuration,
 		promTCPRequestsTotal,
 		promTCPDuration,
+		promCheckQueueLength,
+		promCheckRunning,
+		promCheckRejectedTotal,
+		promCheckCoalescedTotal,
+		promRateLimitedTotal,
 	}
 )
 
@@ -62,7 +99,10 @@ type HandlerPrometheus struct {
 	listener     *Listener
 	password     string
 	snc          *Agent
+	conf         *ConfigSection
 	allowedHosts *AllowedHostConfig
+	checks       []PrometheusCheck
+	checkAPI     bool // serve /api/v1/metrics/check/{command}
 }
 
 // ensure we fully implement the RequestHandlerHTTP type
@@ -79,12 +119,8 @@ func NewHandlerPrometheus() Module {
 
 	listen := &HandlerPrometheus{}
 	listen.handler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		if !verifyRequestPassword(listen.snc, req, listen.password) {
-			http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-			res.Header().Set("Content-Type", "application/json")
-			LogError(json.NewEncoder(res).Encode(map[string]interface{}{
-				"error": "permission denied",
-			}))
+		if requestAccessScope(req) == nil && !verifyRequestPassword(listen.snc, req, listen.password) {
+			writePermissionDenied(res)
 
 			return
 		}
@@ -117,20 +153,28 @@ func (l *HandlerPrometheus) Stop() {
 
 func (l *HandlerPrometheus) Defaults() ConfigData {
 	defaults := ConfigData{
-		"port":    "9999",
-		"use ssl": "0",
+		"port":                 "9999",
+		"use ssl":              "0",
+		"allow arguments":      "false",
+		"allow check endpoint": "false",
 	}
 	defaults.Merge(DefaultListenHTTPConfig)
 
 	return defaults
 }
 
-func (l *HandlerPrometheus) Init(snc *Agent, conf *ConfigSection, _ *Config, set *ModuleSet) error {
+func (l *HandlerPrometheus) Init(snc *Agent, conf *ConfigSection, config *Config, set *ModuleSet) error {
 	l.snc = snc
+	l.conf = conf
 	l.password = DefaultPassword
 	if password, ok := conf.GetString("password"); ok {
 		l.password = password
 	}
+	checkAPI, _, err := conf.GetBool("allow check endpoint")
+	if err != nil {
+		return fmt.Errorf("invalid allow check endpoint specification: %s", err.Error())
+	}
+	l.checkAPI = checkAPI
 	registerMetrics()
 	if Revision != "" {
 		promInfoCount.WithLabelValues(VERSION+"."+Revision, Build, runtime.GOOS).Set(1)
@@ -150,6 +194,11 @@ func (l *HandlerPrometheus) Init(snc *Agent, conf *ConfigSection, _ *Config, set
 	}
 	l.allowedHosts = allowedHosts
 
+	err = l.setChecks(config)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -162,9 +211,15 @@ func (l *HandlerPrometheus) CheckPassword(req *http.Request, _ URLMapping) bool
 }
 
 func (l *HandlerPrometheus) GetMappings(*Agent) []URLMapping {
-	return []URLMapping{
+	mappings := []URLMapping{
 		{URL: "/metrics", Handler: l.handler},
+		{URL: "/metrics/checks", Handler: http.HandlerFunc(l.serveChecks)},
 	}
+	if l.checkAPI {
+		mappings = append(mappings, URLMapping{URL: "/api/v1/metrics/check/{command}", Handler: http.HandlerFunc(l.serveCheck)})
+	}
+
+	return mappings
 }
 
 func registerMetrics() {
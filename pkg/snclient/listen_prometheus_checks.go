@@ -0,0 +1,243 @@
+package snclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"pkg/convert"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sni/shelltoken"
+)
+
+var (
+	promCheckStateDesc = prometheus.NewDesc(
+		"snclient_check_state",
+		"check state (0 - ok, 1 - warning, 2 - critical, 3 - unknown)",
+		[]string{"command"}, nil)
+
+	promCheckMetricDesc = prometheus.NewDesc(
+		"snclient_check_metric",
+		"performance data value of the check",
+		[]string{"command", "metric", "unit"}, nil)
+
+	promCheckMetricMinDesc = prometheus.NewDesc(
+		"snclient_check_metric_min",
+		"minimum value of the performance data",
+		[]string{"command", "metric", "unit"}, nil)
+
+	promCheckMetricMaxDesc = prometheus.NewDesc(
+		"snclient_check_metric_max",
+		"maximum value of the performance data",
+		[]string{"command", "metric", "unit"}, nil)
+
+	promCheckThresholdDesc = prometheus.NewDesc(
+		"snclient_check_threshold",
+		"warning and critical thresholds of the performance data",
+		[]string{"command", "metric", "unit", "type", "bound"}, nil)
+)
+
+// PrometheusCheck is a check which is run on every scrape of /metrics/checks.
+type PrometheusCheck struct {
+	name    string
+	command string
+	args    []string
+}
+
+// prometheusCheckResult is a finished check which will be exported as prometheus metrics.
+type prometheusCheckResult struct {
+	name   string
+	result *CheckResult
+}
+
+// promCheckCollector implements the prometheus.Collector interface for a list of check results.
+type promCheckCollector struct {
+	results []prometheusCheckResult
+}
+
+// Describe sends nothing, which makes this an unchecked collector since metric names depend on the check results.
+func (c *promCheckCollector) Describe(_ chan<- *prometheus.Desc) {}
+
+// Collect sends the state, performance data and thresholds of all check results.
+func (c *promCheckCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, res := range c.results {
+		metrics <- prometheus.MustNewConstMetric(promCheckStateDesc, prometheus.GaugeValue, float64(res.result.State), res.name)
+
+		for _, metric := range res.result.Metrics {
+			if metric.PerfConfig != nil && metric.PerfConfig.Ignore {
+				continue
+			}
+			value, err := convert.Float64E(metric.Value)
+			if err != nil {
+				// skip unknown values like "U"
+				continue
+			}
+			labels := []string{res.name, metric.Name, metric.Unit}
+			metrics <- prometheus.MustNewConstMetric(promCheckMetricDesc, prometheus.GaugeValue, value, labels...)
+
+			if metric.Min != nil {
+				metrics <- prometheus.MustNewConstMetric(promCheckMetricMinDesc, prometheus.GaugeValue, *metric.Min, labels...)
+			}
+			if metric.Max != nil {
+				metrics <- prometheus.MustNewConstMetric(promCheckMetricMaxDesc, prometheus.GaugeValue, *metric.Max, labels...)
+			}
+
+			c.collectThreshold(metrics, metric, metric.Warning, "warning", labels)
+			c.collectThreshold(metrics, metric, metric.Critical, "critical", labels)
+		}
+	}
+}
+
+// collectThreshold sends the lower and upper bound of the threshold range as separate series.
+func (c *promCheckCollector) collectThreshold(metrics chan<- prometheus.Metric, metric *CheckMetric, conditions []*Condition, thresholdType string, labels []string) {
+	if len(conditions) == 0 {
+		return
+	}
+
+	names := []string{metric.Name}
+	if metric.ThresholdName != "" {
+		names = append(names, metric.ThresholdName)
+	}
+
+	lower, upper := parseThresholdRange(ThresholdString(names, conditions, convert.Num2String))
+	if lower != nil {
+		metrics <- prometheus.MustNewConstMetric(promCheckThresholdDesc, prometheus.GaugeValue, *lower, append(labels, thresholdType, "lower")...)
+	}
+	if upper != nil {
+		metrics <- prometheus.MustNewConstMetric(promCheckThresholdDesc, prometheus.GaugeValue, *upper, append(labels, thresholdType, "upper")...)
+	}
+}
+
+// parseThresholdRange returns lower and upper bound from a nagios threshold range, ex.: "10", "10:", "10:20" or "@10:20".
+func parseThresholdRange(threshold string) (lower, upper *float64) {
+	threshold = strings.TrimPrefix(threshold, "@")
+	if threshold == "" {
+		return nil, nil
+	}
+
+	low, high, found := strings.Cut(threshold, ":")
+	if !found {
+		high = low
+		low = ""
+	}
+
+	if num, err := convert.Float64E(low); err == nil && low != "" && low != "~" {
+		lower = &num
+	}
+	if num, err := convert.Float64E(high); err == nil && high != "" {
+		upper = &num
+	}
+
+	return lower, upper
+}
+
+// setChecks reads the list of checks from the checks sub section.
+func (l *HandlerPrometheus) setChecks(conf *Config) error {
+	l.checks = make([]PrometheusCheck, 0)
+	if conf == nil {
+		return nil
+	}
+
+	checks := conf.Section("/settings/Prometheus/server/checks")
+	for _, name := range checks.Keys() {
+		command, _ := checks.GetString(name)
+		cmdLine, err := shelltoken.SplitQuotes(command, shelltoken.Whitespace)
+		if err != nil {
+			return fmt.Errorf("checks %s: error parsing command: %s", name, err.Error())
+		}
+		if len(cmdLine) == 0 {
+			return fmt.Errorf("checks %s: missing command", name)
+		}
+		l.checks = append(l.checks, PrometheusCheck{
+			name:    name,
+			command: cmdLine[0],
+			args:    cmdLine[1:],
+		})
+	}
+
+	return nil
+}
+
+// serveChecks runs all configured checks and returns their results as prometheus metrics.
+func (l *HandlerPrometheus) serveChecks(res http.ResponseWriter, req *http.Request) {
+	results := make([]prometheusCheckResult, len(l.checks))
+	waitGroup := &sync.WaitGroup{}
+	for i := range l.checks {
+		waitGroup.Add(1)
+		// a panicking check leaves this unknown result behind
+		results[i] = prometheusCheckResult{
+			name: l.checks[i].name,
+			result: &CheckResult{
+				State:  CheckExitUnknown,
+				Output: "check failed unexpectedly",
+			},
+		}
+		go func(num int, chk PrometheusCheck) {
+			defer l.snc.logPanicRecover()
+			defer waitGroup.Done()
+			results[num].result = l.snc.RunCheckWithContext(req.Context(), chk.command, chk.args)
+		}(i, l.checks[i])
+	}
+	waitGroup.Wait()
+
+	l.serveCheckResults(res, req, results)
+}
+
+// serveCheck runs a single check with the query parameters as arguments and returns the result as prometheus metrics.
+func (l *HandlerPrometheus) serveCheck(res http.ResponseWriter, req *http.Request) {
+	command := chi.URLParam(req, "command")
+	args := queryParam2CommandArgs(req)
+
+	if !verifyRequestCommand(req, command, args) {
+		writePermissionDenied(res)
+
+		return
+	}
+
+	// commands with an argument policy verify their arguments themselves
+	policy := commandArgumentPolicy(command)
+
+	var result *CheckResult
+	switch {
+	case policy == nil && !checkAllowArguments(l.conf, args):
+		result = &CheckResult{
+			State:  CheckExitUnknown,
+			Output: "Exception processing request: Request contained arguments (check the allow arguments option).",
+		}
+	case !checkNastyCharacters(l.conf, command, policy.UncheckedArgs(args)):
+		result = &CheckResult{
+			State:  CheckExitUnknown,
+			Output: "Exception processing request: Request contained illegal characters (check the allow nasty characters option).",
+		}
+	default:
+		result = l.snc.RunCheckWithContext(req.Context(), command, args)
+	}
+
+	l.serveCheckResults(res, req, []prometheusCheckResult{{name: command, result: result}})
+}
+
+func (l *HandlerPrometheus) serveCheckResults(res http.ResponseWriter, req *http.Request, results []prometheusCheckResult) {
+	for _, r := range results {
+		if r.result.State != CheckExitOK {
+			log.Debugf("prometheus check %s: %s", r.name, r.result.Output)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&promCheckCollector{results: results}); err != nil {
+		log.Errorf("failed to register prometheus check collector: %s", err.Error())
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		ErrorHandling:     promhttp.ContinueOnError,
+	})
+	handler.ServeHTTP(res, req)
+}
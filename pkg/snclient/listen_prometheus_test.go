@@ -1,11 +1,175 @@
 package snclient
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandlerPrometheus(t *testing.T) {
 	assert.Implements(t, (*RequestHandlerHTTP)(nil), new(HandlerPrometheus))
 }
+
+func TestPrometheusThresholdRange(t *testing.T) {
+	tests := []struct {
+		threshold string
+		lower     interface{}
+		upper     interface{}
+	}{
+		{"", nil, nil},
+		{"10", nil, 10.0},
+		{"10:", 10.0, nil},
+		{"5:10", 5.0, 10.0},
+		{"@5:10", 5.0, 10.0},
+		{"~:10", nil, 10.0},
+	}
+
+	for _, tst := range tests {
+		lower, upper := parseThresholdRange(tst.threshold)
+		if tst.lower == nil {
+			assert.Nilf(t, lower, "lower bound of %s", tst.threshold)
+		} else {
+			require.NotNilf(t, lower, "lower bound of %s", tst.threshold)
+			assert.InDeltaf(t, tst.lower, *lower, 0.0001, "lower bound of %s", tst.threshold)
+		}
+		if tst.upper == nil {
+			assert.Nilf(t, upper, "upper bound of %s", tst.threshold)
+		} else {
+			require.NotNilf(t, upper, "upper bound of %s", tst.threshold)
+			assert.InDeltaf(t, tst.upper, *upper, 0.0001, "upper bound of %s", tst.threshold)
+		}
+	}
+}
+
+func TestPrometheusChecks(t *testing.T) {
+	config := `
+[/modules]
+PrometheusServer = enabled
+
+[/settings/Prometheus/server]
+port = 0
+allow check endpoint = true
+allow arguments = true
+
+[/settings/Prometheus/server/checks]
+uptime = check_uptime warn="uptime < 2d" crit="uptime < 1d"
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	var handler *HandlerPrometheus
+	for _, l := range snc.Listeners.Modules() {
+		if h, ok := l.(*HandlerPrometheus); ok {
+			handler = h
+		}
+	}
+	require.NotNilf(t, handler, "prometheus handler found")
+	require.Lenf(t, handler.checks, 1, "one check configured")
+
+	res := httptest.NewRecorder()
+	handler.serveChecks(res, httptest.NewRequest(http.MethodGet, "/metrics/checks", http.NoBody))
+	body := res.Body.String()
+	assert.Equalf(t, http.StatusOK, res.Code, "request successful")
+	assert.Containsf(t, body, `snclient_check_state{command="uptime"}`, "check state")
+	assert.Containsf(t, body, `snclient_check_metric{command="uptime",metric="uptime",unit="s"}`, "check metric")
+	assert.Containsf(t, body, `snclient_check_threshold{bound="lower",command="uptime",metric="uptime",type="warning",unit="s"} 172800`, "warning threshold")
+	assert.Containsf(t, body, `snclient_check_threshold{bound="lower",command="uptime",metric="uptime",type="critical",unit="s"} 86400`, "critical threshold")
+
+	assert.Lenf(t, handler.GetMappings(snc), 3, "check endpoint is enabled")
+
+	res = httptest.NewRecorder()
+	handler.serveCheck(res, newPrometheusCheckRequest("check_uptime", "crit=uptime%20gt%201s"))
+	body = res.Body.String()
+	assert.Equalf(t, http.StatusOK, res.Code, "request successful")
+	assert.Containsf(t, body, `snclient_check_state{command="check_uptime"} 2`, "check state critical")
+	assert.Containsf(t, body, `snclient_check_threshold{bound="upper",command="check_uptime",metric="uptime",type="critical",unit="s"} 1`, "critical threshold")
+
+	res = httptest.NewRecorder()
+	handler.serveCheck(res, newPrometheusCheckRequest("check_uptime", "crit=uptime>1s"))
+	assert.Containsf(t, res.Body.String(), `snclient_check_state{command="check_uptime"} 3`, "nasty characters are rejected")
+}
+
+// checkTestPanic is a check which panics on every run.
+type checkTestPanic struct{}
+
+func (c *checkTestPanic) Build() *CheckData {
+	return &CheckData{name: "check_test_panic"}
+}
+
+func (c *checkTestPanic) Check(_ context.Context, _ *Agent, _ *CheckData, _ []Argument) (*CheckResult, error) {
+	panic("test panic")
+}
+
+func TestPrometheusChecksPanic(t *testing.T) {
+	AvailableChecks["check_test_panic"] = CheckEntry{"check_test_panic", func() CheckHandler { return &checkTestPanic{} }}
+	defer delete(AvailableChecks, "check_test_panic")
+
+	config := `
+[/modules]
+PrometheusServer = enabled
+
+[/settings/Prometheus/server]
+port = 0
+
+[/settings/Prometheus/server/checks]
+broken = check_test_panic
+uptime = check_uptime
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	var handler *HandlerPrometheus
+	for _, l := range snc.Listeners.Modules() {
+		if h, ok := l.(*HandlerPrometheus); ok {
+			handler = h
+		}
+	}
+	require.NotNilf(t, handler, "prometheus handler found")
+
+	res := httptest.NewRecorder()
+	handler.serveChecks(res, httptest.NewRequest(http.MethodGet, "/metrics/checks", http.NoBody))
+	assert.Equalf(t, http.StatusOK, res.Code, "request successful")
+	assert.Containsf(t, res.Body.String(), `snclient_check_state{command="broken"} 3`, "panicking check is unknown")
+	assert.Containsf(t, res.Body.String(), `snclient_check_state{command="uptime"}`, "other checks are served")
+}
+
+func TestPrometheusCheckEndpointDefaults(t *testing.T) {
+	config := `
+[/modules]
+PrometheusServer = enabled
+
+[/settings/Prometheus/server]
+port = 0
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	var handler *HandlerPrometheus
+	for _, l := range snc.Listeners.Modules() {
+		if h, ok := l.(*HandlerPrometheus); ok {
+			handler = h
+		}
+	}
+	require.NotNilf(t, handler, "prometheus handler found")
+
+	for _, mapping := range handler.GetMappings(snc) {
+		assert.NotEqualf(t, "/api/v1/metrics/check/{command}", mapping.URL, "check endpoint is disabled by default")
+	}
+
+	res := httptest.NewRecorder()
+	handler.serveCheck(res, newPrometheusCheckRequest("check_uptime", "crit=uptime%20gt%201s"))
+	assert.Containsf(t, res.Body.String(), `snclient_check_state{command="check_uptime"} 3`, "arguments are not allowed by default")
+}
+
+func newPrometheusCheckRequest(command, query string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics/check/"+command+"?"+query, http.NoBody)
+	routeCtx := chi.NewRouteContext()
+	routeCtx.URLParams.Add("command", command)
+
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeCtx))
+}
@@ -62,6 +62,8 @@ type HandlerWeb struct {
 	handlerLegacy  http.Handler
 	handlerV1      http.Handler
 	password       string
+	hostName       string
+	graphitePrefix string
 	snc            *Agent
 	listener       *Listener
 	allowedHosts   *AllowedHostConfig
@@ -111,6 +113,7 @@ func (l *HandlerWeb) Defaults() ConfigData {
 		"use ssl":                "1",
 		"allow arguments":        "true",
 		"allow nasty characters": "false",
+		"host name":              "${hostname}",
 	}
 	defaults.Merge(DefaultListenHTTPConfig)
 
@@ -124,6 +127,12 @@ func (l *HandlerWeb) Init(snc *Agent, conf *ConfigSection, _ *Config, set *Modul
 		l.password = password
 	}
 
+	l.hostName, _ = conf.GetString("host name")
+	l.graphitePrefix = "snclient." + graphiteName(l.hostName)
+	if prefix, ok := conf.GetString("graphite prefix"); ok && prefix != "" {
+		l.graphitePrefix = strings.TrimSuffix(prefix, ".")
+	}
+
 	listener, err := SharedWebListener(snc, conf, l, set)
 	if err != nil {
 		return err
@@ -325,14 +334,24 @@ func (l *HandlerWeb) result2V1(result *CheckResult) (v1Res []CheckWebLineV1) {
 }
 
 func verifyRequestPassword(snc *Agent, req *http.Request, requiredPassword string) bool {
+	return snc.verifyPassword(requiredPassword, requestPassword(req))
+}
+
+// requestPassword returns the password from basic auth, bearer token or password header.
+func requestPassword(req *http.Request) string {
 	// check basic auth password
 	_, password, _ := req.BasicAuth()
+	if password == "" {
+		if bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			password = strings.TrimSpace(bearer)
+		}
+	}
 	if password == "" {
 		// fallback to clear text  password from http header
 		password = req.Header.Get("Password")
 	}
 
-	return snc.verifyPassword(requiredPassword, password)
+	return password
 }
 
 type HandlerWebLegacy struct {
@@ -343,6 +362,11 @@ type HandlerWebLegacy struct {
 func (l *HandlerWebLegacy) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	command := chi.URLParam(req, "command")
 	args := queryParam2CommandArgs(req)
+	if !verifyRequestCommand(req, command, args) {
+		writePermissionDenied(res)
+
+		return
+	}
 	result := l.Handler.snc.RunCheckWithContext(req.Context(), command, args)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
@@ -397,8 +421,32 @@ func (l *HandlerWebV1) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 func (l *HandlerWebV1) serveCommand(res http.ResponseWriter, req *http.Request) {
 	command := chi.URLParam(req, "command")
-	args := queryParam2CommandArgs(req)
+	format, args, err := webOutputFormat(req, queryParam2CommandArgs(req))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+	if !verifyRequestCommand(req, command, args) {
+		writePermissionDenied(res)
+
+		return
+	}
 	result := l.Handler.snc.RunCheckWithContext(req.Context(), command, args)
+	switch format {
+	case WebFormatOpenMetrics:
+		l.Handler.writeOpenMetrics(res, command, result)
+
+		return
+	case WebFormatInflux:
+		l.Handler.writeInflux(res, command, result)
+
+		return
+	case WebFormatGraphite:
+		l.Handler.writeGraphite(res, command, result)
+
+		return
+	}
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
 	LogError(json.NewEncoder(res).Encode(map[string]interface{}{
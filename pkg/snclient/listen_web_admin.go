@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 )
 
 func init() {
@@ -111,15 +112,28 @@ func (l *HandlerWebAdmin) ServeHTTP(res http.ResponseWriter, req *http.Request)
 	path := strings.TrimSuffix(req.URL.Path, "/")
 	switch path {
 	case "/api/v1/admin/reload":
-		l.serveReload(res, req)
+		l.auditAction(res, req, l.serveReload)
 	case "/api/v1/admin/certs/replace":
-		l.serveCertsReplace(res, req)
+		l.auditAction(res, req, l.serveCertsReplace)
 	default:
 		res.WriteHeader(http.StatusNotFound)
 		LogError2(res.Write([]byte("404 - nothing here\n")))
 	}
 }
 
+// auditAction runs the admin action and adds the result to the audit log.
+func (l *HandlerWebAdmin) auditAction(res http.ResponseWriter, req *http.Request, action http.HandlerFunc) {
+	started := time.Now()
+	capture := &ResponseWriterCapture{w: res, statusCode: http.StatusOK}
+	action(capture, req)
+
+	state := CheckExitOK
+	if capture.statusCode != http.StatusOK {
+		state = CheckExitCritical
+	}
+	l.Handler.snc.audit.Log(req.Context(), req.URL.Path, []string{}, time.Since(started), state, strings.TrimSpace(capture.body.String()))
+}
+
 func (l *HandlerWebAdmin) serveReload(res http.ResponseWriter, req *http.Request) {
 	if !l.requirePostMethod(res, req) {
 		return
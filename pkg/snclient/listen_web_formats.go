@@ -0,0 +1,224 @@
+package snclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"pkg/convert"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// WebFormatJSON is the default v1 api output format
+	WebFormatJSON = "json"
+
+	// WebFormatOpenMetrics renders check results as OpenMetrics text
+	WebFormatOpenMetrics = "openmetrics"
+
+	// WebFormatInflux renders check results as InfluxDB line protocol
+	WebFormatInflux = "influx"
+
+	// WebFormatGraphite renders check results as Graphite plaintext protocol
+	WebFormatGraphite = "graphite"
+
+	// WebFormatQueryParam is the reserved query parameter to select the output format, it is not passed to the check
+	WebFormatQueryParam = "output_format"
+)
+
+// webFormatContentTypes maps accept header content types to output formats.
+var webFormatContentTypes = map[string]string{
+	"application/json":                     WebFormatJSON,
+	"application/openmetrics-text":         WebFormatOpenMetrics,
+	"application/x-influxdb-line-protocol": WebFormatInflux,
+	"application/x-graphite":               WebFormatGraphite,
+}
+
+var (
+	influxTagEscaper   = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	influxFieldEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	reGraphiteInvalid  = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+)
+
+// webOutputFormat returns the requested output format and the remaining query arguments.
+// The output_format= query parameter has precedence over the accept header, all other arguments are kept.
+func webOutputFormat(req *http.Request, args []string) (format string, remaining []string, err error) {
+	remaining = make([]string, 0, len(args))
+	for _, arg := range args {
+		if val, ok := strings.CutPrefix(arg, WebFormatQueryParam+"="); ok {
+			format = strings.ToLower(val)
+
+			continue
+		}
+		remaining = append(remaining, arg)
+	}
+
+	switch format {
+	case WebFormatJSON, WebFormatOpenMetrics, WebFormatInflux, WebFormatGraphite:
+		return format, remaining, nil
+	case "":
+	default:
+		return "", remaining, fmt.Errorf("unknown format %s, supported are: json, openmetrics, influx and graphite", format)
+	}
+
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		contentType, _, _ := strings.Cut(accept, ";")
+		if format, ok := webFormatContentTypes[strings.TrimSpace(strings.ToLower(contentType))]; ok {
+			return format, remaining, nil
+		}
+	}
+
+	return WebFormatJSON, remaining, nil
+}
+
+// writeOpenMetrics writes the check result in OpenMetrics text format.
+func (l *HandlerWeb) writeOpenMetrics(res http.ResponseWriter, command string, result *CheckResult) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&promCheckCollector{results: []prometheusCheckResult{{name: command, result: result}}}); err != nil {
+		log.Errorf("failed to register prometheus check collector: %s", err.Error())
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		log.Debugf("failed to gather check metrics: %s", err.Error())
+	}
+
+	format := expfmt.NewFormat(expfmt.TypeOpenMetrics)
+	res.Header().Set("Content-Type", string(format))
+	res.WriteHeader(http.StatusOK)
+	encoder := expfmt.NewEncoder(res, format)
+	for _, family := range families {
+		LogError(encoder.Encode(family))
+	}
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		LogError(closer.Close())
+	}
+}
+
+// writeInflux writes the check result in InfluxDB line protocol.
+// The state is written as snclient_check and each performance data as snclient_check_metric measurement.
+func (l *HandlerWeb) writeInflux(res http.ResponseWriter, command string, result *CheckResult) {
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+
+	timestamp := time.Now().UnixNano()
+	// empty tag values are not allowed in the line protocol
+	hostTags := "command=" + influxTagEscaper.Replace(command)
+	if l.hostName != "" {
+		hostTags = "host=" + influxTagEscaper.Replace(l.hostName) + "," + hostTags
+	}
+	LogError2(fmt.Fprintf(res, "snclient_check,%s state=%di,output=\"%s\" %d\n",
+		hostTags, result.State, influxFieldEscaper.Replace(result.Output), timestamp))
+
+	for _, metric := range result.Metrics {
+		if metric.PerfConfig != nil && metric.PerfConfig.Ignore {
+			continue
+		}
+		value, err := convert.Float64E(metric.Value)
+		if err != nil {
+			continue
+		}
+
+		tags := hostTags + ",metric=" + influxTagEscaper.Replace(metric.Name)
+		if metric.Unit != "" {
+			tags += ",unit=" + influxTagEscaper.Replace(metric.Unit)
+		}
+		fields := []string{"value=" + convert.Num2String(value)}
+		for _, bound := range l.metricBounds(metric) {
+			fields = append(fields, bound.name+"="+convert.Num2String(bound.value))
+		}
+		LogError2(fmt.Fprintf(res, "snclient_check_metric,%s %s %d\n", tags, strings.Join(fields, ","), timestamp))
+	}
+}
+
+// writeGraphite writes the check result in Graphite plaintext protocol.
+func (l *HandlerWeb) writeGraphite(res http.ResponseWriter, command string, result *CheckResult) {
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+
+	timestamp := time.Now().Unix()
+	prefix := l.graphitePrefix + "." + graphiteName(command)
+	writeGraphiteLine(res, prefix+".state", float64(result.State), timestamp)
+
+	for _, metric := range result.Metrics {
+		if metric.PerfConfig != nil && metric.PerfConfig.Ignore {
+			continue
+		}
+		value, err := convert.Float64E(metric.Value)
+		if err != nil {
+			continue
+		}
+
+		metricPrefix := prefix + "." + graphiteName(metric.Name)
+		writeGraphiteLine(res, metricPrefix+".value", value, timestamp)
+		for _, bound := range l.metricBounds(metric) {
+			writeGraphiteLine(res, metricPrefix+"."+bound.name, bound.value, timestamp)
+		}
+	}
+}
+
+func writeGraphiteLine(output io.Writer, path string, value float64, timestamp int64) {
+	LogError2(fmt.Fprintf(output, "%s %s %d\n", path, convert.Num2String(value), timestamp))
+}
+
+// graphiteName replaces all characters which are not allowed in graphite paths.
+func graphiteName(name string) string {
+	name = strings.Trim(reGraphiteInvalid.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		return "_"
+	}
+
+	return name
+}
+
+// webMetricBound is a single additional value of a metric, ex.: min or warning_upper.
+type webMetricBound struct {
+	name  string
+	value float64
+}
+
+// metricBounds returns min, max and the threshold bounds of given metric.
+func (l *HandlerWeb) metricBounds(metric *CheckMetric) []webMetricBound {
+	bounds := make([]webMetricBound, 0)
+	if metric.Min != nil {
+		bounds = append(bounds, webMetricBound{"min", *metric.Min})
+	}
+	if metric.Max != nil {
+		bounds = append(bounds, webMetricBound{"max", *metric.Max})
+	}
+
+	names := []string{metric.Name}
+	if metric.ThresholdName != "" {
+		names = append(names, metric.ThresholdName)
+	}
+
+	thresholds := []struct {
+		name       string
+		conditions []*Condition
+	}{
+		{"warning", metric.Warning},
+		{"critical", metric.Critical},
+	}
+	for _, threshold := range thresholds {
+		if len(threshold.conditions) == 0 {
+			continue
+		}
+		lower, upper := parseThresholdRange(ThresholdString(names, threshold.conditions, convert.Num2String))
+		if lower != nil {
+			bounds = append(bounds, webMetricBound{threshold.name + "_lower", *lower})
+		}
+		if upper != nil {
+			bounds = append(bounds, webMetricBound{threshold.name + "_upper", *upper})
+		}
+	}
+
+	return bounds
+}
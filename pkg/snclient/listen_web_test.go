@@ -1,9 +1,14 @@
 package snclient
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestListenWebPerfInt(t *testing.T) {
@@ -68,3 +73,96 @@ func TestListenWebPerfUnknown(t *testing.T) {
 	assert.Nilf(t, perf.FloatVal, "float value is empty")
 	assert.Equalf(t, perf.IntVal, expect, "int value")
 }
+
+func TestListenWebOutputFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	format, args, err := webOutputFormat(req, []string{"drive=/", "output_format=Influx"})
+	require.NoErrorf(t, err, "format parsed")
+	assert.Equalf(t, WebFormatInflux, format, "format from query")
+	assert.Equalf(t, []string{"drive=/"}, args, "format removed from args")
+
+	format, args, err = webOutputFormat(req, []string{"format=%(status)", "output_format=json"})
+	require.NoErrorf(t, err, "format parsed")
+	assert.Equalf(t, WebFormatJSON, format, "format from query")
+	assert.Equalf(t, []string{"format=%(status)"}, args, "check arguments named format are kept")
+
+	req.Header.Set("Accept", "text/html;q=0.9, application/openmetrics-text; version=1.0.0")
+	format, _, err = webOutputFormat(req, []string{})
+	require.NoErrorf(t, err, "format parsed")
+	assert.Equalf(t, WebFormatOpenMetrics, format, "format from accept header")
+
+	format, _, err = webOutputFormat(req, []string{"output_format=graphite"})
+	require.NoErrorf(t, err, "format parsed")
+	assert.Equalf(t, WebFormatGraphite, format, "query has precedence")
+
+	req.Header.Set("Accept", "*/*")
+	format, _, err = webOutputFormat(req, []string{})
+	require.NoErrorf(t, err, "format parsed")
+	assert.Equalf(t, WebFormatJSON, format, "json is default")
+
+	_, _, err = webOutputFormat(req, []string{"output_format=xml"})
+	require.Errorf(t, err, "unknown format")
+}
+
+func testWebFormatResult(t *testing.T) *CheckResult {
+	t.Helper()
+
+	warn, err := NewCondition("used > 80")
+	require.NoErrorf(t, err, "condition parsed")
+	crit, err := NewCondition("used > 90")
+	require.NoErrorf(t, err, "condition parsed")
+	maxVal := 100.0
+
+	return &CheckResult{
+		State:  CheckExitWarning,
+		Output: `WARNING - "/" used 85%`,
+		Metrics: []*CheckMetric{
+			{Name: "/ used", Unit: "%", Value: 85, Max: &maxVal, Warning: []*Condition{warn}, Critical: []*Condition{crit}, ThresholdName: "used"},
+			{Name: "rss", Value: "U"},
+		},
+	}
+}
+
+func TestListenWebFormatInflux(t *testing.T) {
+	l := &HandlerWeb{hostName: "test host"}
+	res := httptest.NewRecorder()
+	l.writeInflux(res, "check_drivesize", testWebFormatResult(t))
+
+	lines := regexp.MustCompile(` \d+\n`).ReplaceAllString(res.Body.String(), "\n")
+	assert.Equalf(t, `snclient_check,host=test\ host,command=check_drivesize state=1i,output="WARNING - \"/\" used 85%"
+snclient_check_metric,host=test\ host,command=check_drivesize,metric=/\ used,unit=% value=85,max=100,warning_upper=80,critical_upper=90
+`, lines, "influx output")
+
+	l = &HandlerWeb{}
+	res = httptest.NewRecorder()
+	l.writeInflux(res, "check_drivesize", testWebFormatResult(t))
+	assert.Truef(t, strings.HasPrefix(res.Body.String(), "snclient_check,command=check_drivesize state=1i"), "empty host tag is omitted")
+	assert.NotContainsf(t, res.Body.String(), "host=", "empty host tag is omitted")
+}
+
+func TestListenWebFormatGraphite(t *testing.T) {
+	l := &HandlerWeb{graphitePrefix: "snclient.test"}
+	res := httptest.NewRecorder()
+	l.writeGraphite(res, "check_drivesize", testWebFormatResult(t))
+
+	lines := regexp.MustCompile(` \d+\n`).ReplaceAllString(res.Body.String(), "\n")
+	assert.Equalf(t, `snclient.test.check_drivesize.state 1
+snclient.test.check_drivesize.used.value 85
+snclient.test.check_drivesize.used.max 100
+snclient.test.check_drivesize.used.warning_upper 80
+snclient.test.check_drivesize.used.critical_upper 90
+`, lines, "graphite output")
+}
+
+func TestListenWebFormatOpenMetrics(t *testing.T) {
+	l := &HandlerWeb{}
+	res := httptest.NewRecorder()
+	l.writeOpenMetrics(res, "check_drivesize", testWebFormatResult(t))
+
+	body := res.Body.String()
+	assert.Containsf(t, res.Header().Get("Content-Type"), "application/openmetrics-text", "content type")
+	assert.Containsf(t, body, `snclient_check_state{command="check_drivesize"} 1`, "state")
+	assert.Containsf(t, body, `snclient_check_metric{command="check_drivesize",metric="/ used",unit="%"} 85`, "metric")
+	assert.Containsf(t, body, `snclient_check_threshold{bound="upper",command="check_drivesize",metric="/ used",type="critical",unit="%"} 90`, "threshold")
+	assert.Containsf(t, body, "# EOF", "finalized")
+}
@@ -3,7 +3,6 @@ package snclient
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -47,7 +46,9 @@ type Listener struct {
 	port          int64
 	bindAddress   string
 	tlsConfig     *tls.Config
+	certFile      string // path to the certificate file if ssl is enabled
 	socketTimeout time.Duration
+	rateLimit     *RateLimiter // limits requests per remote address, nil if disabled
 }
 
 // NewListener creates a new Listener object.
@@ -120,6 +121,22 @@ func (l *Listener) setListenConfig(conf *ConfigSection) error {
 		l.socketTimeout = DefaultSocketTimeout * time.Second
 	}
 
+	// parse / set rate limit
+	rateLimit := 0.0
+	if raw, ok := conf.GetString("rate limit"); ok && raw != "" {
+		rateLimit, err = ParseRateLimit(raw)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit specification: %s", err.Error())
+		}
+	}
+	rateLimitBurst, _, err := conf.GetInt("rate limit burst")
+	if err != nil {
+		return fmt.Errorf("invalid rate limit burst specification: %s", err.Error())
+	}
+	if rateLimit > 0 {
+		l.rateLimit = NewRateLimiter(rateLimit, rateLimitBurst)
+	}
+
 	// parse / set ssl config
 	useSsl, _, err := conf.GetBool("use ssl")
 	switch {
@@ -158,34 +175,42 @@ func (l *Listener) setListenTLSConfig(conf *ConfigSection) error {
 
 	// certificate
 	certPath, ok := conf.GetString("certificate")
-	switch {
-	case !ok:
+	if !ok {
 		return fmt.Errorf("invalid ssl configuration, ssl enabled but no certificate set")
-	case ok:
-		_, err := os.ReadFile(certPath)
-		if err != nil {
-			return fmt.Errorf("cannot read certificate: %s", err.Error())
-		}
 	}
 
 	certKey := certPath
 	if !strings.HasSuffix(certPath, ".pem") {
 		certKey, ok = conf.GetString("certificate key")
-		switch {
-		case !ok:
+		if !ok {
 			return fmt.Errorf("invalid ssl configuration, ssl enabled but no certificate key set")
-		case ok:
-			_, err := os.ReadFile(certKey)
-			if err != nil {
-				return fmt.Errorf("cannot read certificate key: %s", err.Error())
-			}
 		}
 	}
-	cer, err := tls.LoadX509KeyPair(certPath, certKey)
+
+	// create local ca and certificate if none exists yet
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(certKey)
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		log.Infof("certificate %s does not exist, creating new one", certPath)
+		if err := createListenerCertificate(certPath, certKey); err != nil {
+			return fmt.Errorf("cannot create certificate: %s", err.Error())
+		}
+	}
+
+	if _, err := os.ReadFile(certPath); err != nil {
+		return fmt.Errorf("cannot read certificate: %s", err.Error())
+	}
+	if _, err := os.ReadFile(certKey); err != nil {
+		return fmt.Errorf("cannot read certificate key: %s", err.Error())
+	}
+
+	// certificate is reloaded automatically if the files change
+	cert, err := NewListenerCertificate(certPath, certKey)
 	if err != nil {
-		return fmt.Errorf("tls.LoadX509KeyPair: %s / %s: %s", certPath, certKey, err.Error())
+		return err
 	}
-	l.tlsConfig.Certificates = []tls.Certificate{cer}
+	l.tlsConfig.GetCertificate = cert.GetCertificate
+	l.certFile = certPath
 
 	clientPEMs, ok := conf.GetString("client certificates")
 	if ok {
@@ -313,6 +338,14 @@ func (l *Listener) handleTCPCon(con net.Conn, handler RequestHandlerTCP) {
 		return
 	}
 
+	if !l.rateLimit.Allow(con.RemoteAddr().String()) {
+		log.Warnf("ip %s exceeded the %s rate limit", con.RemoteAddr().String(), l.connType)
+		promRateLimitedTotal.WithLabelValues(handler.Type()).Inc()
+		con.Close()
+
+		return
+	}
+
 	if err := con.SetReadDeadline(time.Now().Add(l.socketTimeout)); err != nil {
 		log.Warnf("setting timeout on %s client connection failed: %s", l.connType, err.Error())
 	}
@@ -395,6 +428,7 @@ func (l *Listener) LogWrapHTTPHandler(next http.Handler, res http.ResponseWriter
 		w: res,
 	}
 	res = resCapture
+	req, auth := withRequestAuth(req)
 	next.ServeHTTP(res, req)
 
 	if capture, ok := res.(*ResponseWriterCapture); ok {
@@ -405,36 +439,64 @@ func (l *Listener) LogWrapHTTPHandler(next http.Handler, res http.ResponseWriter
 	promHTTPRequestsTotal.WithLabelValues(fmt.Sprintf("%d", resCapture.statusCode), req.URL.Path).Add(1)
 	promHTTPDuration.WithLabelValues(fmt.Sprintf("%d", resCapture.statusCode), req.URL.Path).Observe(duration.Seconds())
 
-	log.Debugf("http(s) request finished from: %-20s | duration: %12s | code: %3d | %s %s",
+	identity := ""
+	if auth.identity != "" {
+		identity = " | identity: " + auth.identity
+	}
+	log.Debugf("http(s) request finished from: %-20s | duration: %12s | code: %3d | %s %s%s",
 		req.RemoteAddr,
 		duration,
 		resCapture.statusCode,
 		req.Method,
 		req.URL.Path,
+		identity,
 	)
 }
 
-// wrapper for all known web requests to verfify passwords and allowed hosts
+// wrapper for all known web requests to verfify passwords, client identities, api tokens and allowed hosts
 func (l *Listener) WrappedCheckHTTPHandler(webhandler RequestHandlerHTTP, mapping *URLMapping, res http.ResponseWriter, req *http.Request) {
 	allowed := webhandler.GetAllowedHosts()
 	if !allowed.Check(req.RemoteAddr) {
 		log.Warnf("ip %s is not in the allowed hosts", req.RemoteAddr)
+		writePermissionDenied(res)
+
+		return
+	}
 
-		http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		res.Header().Set("Content-Type", "application/json")
-		LogError(json.NewEncoder(res).Encode(map[string]interface{}{
-			"error": "permission denied",
-		}))
+	if !l.rateLimit.Allow(req.RemoteAddr) {
+		log.Warnf("ip %s exceeded the %s rate limit", req.RemoteAddr, webhandler.Type())
+		promRateLimitedTotal.WithLabelValues(webhandler.Type()).Inc()
+		writeTooManyRequests(res)
 
 		return
 	}
 
-	if !webhandler.CheckPassword(req, *mapping) {
-		http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-		res.Header().Set("Content-Type", "application/json")
-		LogError(json.NewEncoder(res).Encode(map[string]interface{}{
-			"error": "permission denied",
-		}))
+	req, auth := withRequestAuth(req)
+	auth.listener = webhandler.Type()
+	auth.remoteAddr = req.RemoteAddr
+	if cert := verifiedClientCertificate(req); cert != nil {
+		auth.identity = cert.Subject.CommonName
+	}
+
+	// client identities and named api tokens replace the listener password and restrict access to their scope
+	var scope *AccessScope
+	if identity := l.snc.verifyClientIdentity(req); identity != nil {
+		scope = identity.AccessScope
+	} else if token := l.snc.verifyRequestToken(req); token != nil {
+		scope = token.AccessScope
+	}
+
+	switch {
+	case scope != nil:
+		auth.scope = scope
+		auth.identity = scope.name
+		if !scope.AllowRequest(req) {
+			writePermissionDenied(res)
+
+			return
+		}
+	case !webhandler.CheckPassword(req, *mapping):
+		writePermissionDenied(res)
 
 		return
 	}
@@ -0,0 +1,261 @@
+package snclient
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// certificateReloadInterval sets how often the certificate files are checked for changes
+	certificateReloadInterval = 5 * time.Second
+
+	// generated certificates are valid for this duration
+	generatedCAValidity   = 10 * 365 * 24 * time.Hour
+	generatedCertValidity = 2 * 365 * 24 * time.Hour
+)
+
+// ListenerCertificate contains the tls key pair of a listener which is reloaded when the files change.
+type ListenerCertificate struct {
+	noCopy    noCopy
+	lock      deadlock.RWMutex
+	certFile  string
+	keyFile   string
+	cert      *tls.Certificate
+	stamp     string // modification time and size of certificate and key file
+	lastCheck time.Time
+}
+
+// NewListenerCertificate loads the key pair from given files.
+func NewListenerCertificate(certFile, keyFile string) (*ListenerCertificate, error) {
+	lc := &ListenerCertificate{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := lc.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return lc, nil
+}
+
+// GetCertificate returns the current certificate and can be used as tls.Config.GetCertificate callback.
+func (lc *ListenerCertificate) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	lc.lock.RLock()
+	cert := lc.cert
+	check := time.Since(lc.lastCheck) > certificateReloadInterval
+	lc.lock.RUnlock()
+
+	if !check {
+		return cert, nil
+	}
+
+	lc.lock.Lock()
+	lc.lastCheck = time.Now()
+	changed := lc.fileStamp() != lc.stamp
+	lc.lock.Unlock()
+
+	if changed {
+		if err := lc.load(); err != nil {
+			// keep the previous certificate, ex.: if only the certificate has been replaced so far
+			log.Warnf("failed to reload certificate, keeping previous one: %s", err.Error())
+		}
+	}
+
+	lc.lock.RLock()
+	defer lc.lock.RUnlock()
+
+	return lc.cert, nil
+}
+
+// load reads the key pair from disk.
+func (lc *ListenerCertificate) load() error {
+	stamp := lc.fileStamp()
+	cert, err := tls.LoadX509KeyPair(lc.certFile, lc.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls.LoadX509KeyPair: %s / %s: %s", lc.certFile, lc.keyFile, err.Error())
+	}
+
+	lc.lock.Lock()
+	if lc.cert != nil {
+		log.Infof("reloaded certificate %s", lc.certFile)
+	}
+	lc.cert = &cert
+	lc.stamp = stamp
+	lc.lastCheck = time.Now()
+	lc.lock.Unlock()
+
+	return nil
+}
+
+// fileStamp returns a string which changes if certificate or key file change.
+func (lc *ListenerCertificate) fileStamp() string {
+	stamp := ""
+	for _, file := range []string{lc.certFile, lc.keyFile} {
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			return ""
+		}
+		stamp += fmt.Sprintf("%d:%d;", fileInfo.ModTime().UnixNano(), fileInfo.Size())
+	}
+
+	return stamp
+}
+
+// createListenerCertificate creates a host certificate signed by a local ca. The ca is created as well
+// unless it already exists in the certificate folder.
+func createListenerCertificate(certFile, keyFile string) error {
+	caCertFile := filepath.Join(filepath.Dir(certFile), "ca.crt")
+	caKeyFile := filepath.Join(filepath.Dir(certFile), "ca.key")
+
+	caCert, caKey, err := loadOrCreateCA(caCertFile, caKeyFile)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to create private key: %s", err.Error())
+	}
+
+	dnsNames, ipAddresses := certificateHostNames(hostname)
+	template := &x509.Certificate{
+		SerialNumber: newCertificateSerial(),
+		Subject:      pkix.Name{CommonName: hostname, Organization: []string{NAME}},
+		DNSNames:     dnsNames,
+		IPAddresses:  ipAddresses,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(generatedCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %s", err.Error())
+	}
+
+	return writeCertificate(certFile, keyFile, der, key)
+}
+
+// loadOrCreateCA returns the local ca from given files or creates a new one.
+func loadOrCreateCA(certFile, keyFile string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err == nil {
+		cert, err2 := x509.ParseCertificate(pair.Certificate[0])
+		if err2 != nil {
+			return nil, nil, fmt.Errorf("failed to parse ca certificate %s: %s", certFile, err2.Error())
+		}
+		key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported ca key type in %s", keyFile)
+		}
+
+		return cert, key, nil
+	}
+	if _, err2 := os.Stat(certFile); !errors.Is(err2, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("failed to load ca: %s", err.Error())
+	}
+
+	log.Infof("creating local ca %s", certFile)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create ca key: %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          newCertificateSerial(),
+		Subject:               pkix.Name{CommonName: "Root CA " + NAME, Organization: []string{NAME}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(generatedCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create ca certificate: %s", err.Error())
+	}
+
+	err = writeCertificate(certFile, keyFile, der, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ca certificate: %s", err.Error())
+	}
+
+	return cert, key, nil
+}
+
+// writeCertificate writes certificate and key as pem files, both are written into the same file if the names are equal.
+func writeCertificate(certFile, keyFile string, der []byte, key *rsa.PrivateKey) error {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	if certFile == keyFile {
+		certPEM = append(certPEM, keyPEM...)
+	} else {
+		if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+			return fmt.Errorf("failed to write certificate key %s: %s", keyFile, err.Error())
+		}
+	}
+
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write certificate %s: %s", certFile, err.Error())
+	}
+
+	return nil
+}
+
+// certificateHostNames returns the subject alternative names for the host certificate.
+func certificateHostNames(hostname string) (dnsNames []string, ipAddresses []net.IP) {
+	dnsNames = []string{hostname}
+	if hostname != "localhost" {
+		dnsNames = append(dnsNames, "localhost")
+	}
+
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Debugf("failed to get interface addresses: %s", err.Error())
+	}
+	for _, addr := range addresses {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ipAddresses = append(ipAddresses, ipNet.IP)
+	}
+
+	return dnsNames, ipAddresses
+}
+
+func newCertificateSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+
+	return serial
+}
@@ -0,0 +1,81 @@
+package snclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerCertificateCreate(t *testing.T) {
+	certDir := t.TempDir()
+	config := `
+[/modules]
+WEBServer = enabled
+
+[/settings/WEB/server]
+port = 0
+use ssl = true
+certificate = ` + filepath.Join(certDir, "server.crt") + `
+certificate key = ` + filepath.Join(certDir, "server.key") + `
+`
+	snc := StartTestAgent(t, config)
+
+	for _, file := range []string{"server.crt", "server.key", "ca.crt", "ca.key"} {
+		assert.FileExistsf(t, filepath.Join(certDir, file), "%s has been created", file)
+	}
+
+	caCerts, err := readX509File(filepath.Join(certDir, "ca.crt"))
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCerts[0])
+
+	var address string
+	for _, module := range snc.Listeners.Modules() {
+		if handler, ok := module.(RequestHandler); ok && handler.Listener() != nil {
+			address = handler.Listener().listen.Addr().String()
+		}
+	}
+	require.NotEmptyf(t, address, "found listener address")
+
+	conn, err := tls.Dial("tcp", address, &tls.Config{
+		RootCAs:    roots,
+		ServerName: "localhost",
+		MinVersion: tls.VersionTLS12,
+	})
+	require.NoErrorf(t, err, "certificate is signed by local ca")
+	assert.Equalf(t, "localhost", conn.ConnectionState().PeerCertificates[0].DNSNames[1], "san contains localhost")
+	conn.Close()
+
+	StopTestAgent(t, snc)
+}
+
+func TestListenerCertificateReload(t *testing.T) {
+	certDir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, certDir, 10*24*time.Hour)
+
+	cert, err := NewListenerCertificate(certFile, keyFile)
+	require.NoError(t, err)
+
+	first, err := cert.GetCertificate(nil)
+	require.NoError(t, err)
+
+	// replace certificate, it is picked up after the reload interval
+	_, _ = writeTestCertificate(t, certDir, 20*24*time.Hour)
+	cert.lastCheck = time.Time{}
+	second, err := cert.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEqualf(t, first.Certificate[0], second.Certificate[0], "certificate has been reloaded")
+
+	// broken key keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+	cert.lastCheck = time.Time{}
+	third, err := cert.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equalf(t, second.Certificate[0], third.Certificate[0], "previous certificate is kept")
+}
@@ -2,6 +2,7 @@ package snclient
 
 import (
 	"fmt"
+	"sync"
 )
 
 // Module is a generic module interface to abstract optional agent functionality
@@ -15,8 +16,10 @@ type Module interface {
 // ModuleSet is a list of modules sharing a common type
 type ModuleSet struct {
 	noCopy  noCopy
+	lock    sync.RWMutex // protects modules and failed
 	name    string
 	modules map[string]Module
+	failed  []string // names of modules which failed to start
 }
 
 func NewModuleSet(name string) *ModuleSet {
@@ -29,12 +32,18 @@ func NewModuleSet(name string) *ModuleSet {
 }
 
 func (ms *ModuleSet) Stop() {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
 	for _, t := range ms.modules {
 		t.Stop()
 	}
 }
 
 func (ms *ModuleSet) StopRemove() {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
 	for name, t := range ms.modules {
 		t.Stop()
 		delete(ms.modules, name)
@@ -42,12 +51,18 @@ func (ms *ModuleSet) StopRemove() {
 }
 
 func (ms *ModuleSet) Start() {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
 	for name := range ms.modules {
 		ms.startModule(name)
 	}
 }
 
 func (ms *ModuleSet) Get(name string) (task Module) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
 	if task, ok := ms.modules[name]; ok {
 		return task
 	}
@@ -55,7 +70,31 @@ func (ms *ModuleSet) Get(name string) (task Module) {
 	return nil
 }
 
+// Modules returns a copy of all modules by name
+func (ms *ModuleSet) Modules() map[string]Module {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	modules := make(map[string]Module, len(ms.modules))
+	for name, t := range ms.modules {
+		modules[name] = t
+	}
+
+	return modules
+}
+
+// Failed returns the names of all modules which failed to start
+func (ms *ModuleSet) Failed() []string {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+
+	return append([]string{}, ms.failed...)
+}
+
 func (ms *ModuleSet) Add(name string, task Module) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
 	if _, ok := ms.modules[name]; ok {
 		if mod, ok := task.(RequestHandler); ok {
 			name = name + ":" + mod.Type()
@@ -69,6 +108,7 @@ func (ms *ModuleSet) Add(name string, task Module) error {
 	return nil
 }
 
+// startModule starts a single module, the caller must hold the write lock
 func (ms *ModuleSet) startModule(name string) {
 	module, ok := ms.modules[name]
 	if !ok {
@@ -82,6 +122,7 @@ func (ms *ModuleSet) startModule(name string) {
 		log.Errorf("failed to start %s %s module: %s", name, ms.name, err.Error())
 		module.Stop()
 		delete(ms.modules, name)
+		ms.failed = append(ms.failed, name)
 
 		return
 	}
@@ -0,0 +1,136 @@
+package snclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pkg/utils"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// rateLimitCleanupInterval sets how often idle remote addresses are removed from the rate limiter.
+const rateLimitCleanupInterval = time.Minute
+
+// RateLimiter limits the number of requests per remote address using a token bucket for each address.
+type RateLimiter struct {
+	noCopy      noCopy
+	lock        deadlock.Mutex
+	rate        float64 // tokens added per second
+	burst       float64 // maximum number of tokens
+	buckets     map[string]*rateLimitBucket
+	lastCleanup time.Time
+}
+
+type rateLimitBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter returns a rate limiter which allows rate requests per second with bursts up to burst requests.
+func NewRateLimiter(rate float64, burst int64) *RateLimiter {
+	minBurst := math.Max(1, math.Ceil(rate))
+	if float64(burst) < minBurst {
+		burst = int64(minBurst)
+	}
+
+	return &RateLimiter{
+		rate:        rate,
+		burst:       float64(burst),
+		buckets:     make(map[string]*rateLimitBucket),
+		lastCleanup: time.Now(),
+	}
+}
+
+// ParseRateLimit parses a rate limit and returns the allowed requests per second. The limit is either a
+// number of requests per second, ex.: 10 or 0.5, or a number of requests per duration, ex.: 1/10s or 30/1m.
+func ParseRateLimit(raw string) (float64, error) {
+	raw = strings.TrimSpace(raw)
+	count, duration, found := strings.Cut(raw, "/")
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %s: %s", raw, err.Error())
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("cannot parse %s: rate limit must not be negative", raw)
+	}
+
+	if found {
+		seconds, err := utils.ExpandDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %s: %s", raw, err.Error())
+		}
+		if seconds <= 0 {
+			return 0, fmt.Errorf("cannot parse %s: duration must be positive", raw)
+		}
+		rate /= seconds
+	}
+
+	return rate, nil
+}
+
+// Allow returns true if the remote address has not exceeded the rate limit. A nil rate limiter allows everything.
+func (rl *RateLimiter) Allow(remoteAddr string) bool {
+	if rl == nil {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	now := time.Now()
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if now.Sub(rl.lastCleanup) > rateLimitCleanupInterval {
+		rl.cleanup(now)
+	}
+
+	bucket, ok := rl.buckets[host]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: rl.burst, updated: now}
+		rl.buckets[host] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.updated).Seconds() * rl.rate
+	if bucket.tokens > rl.burst {
+		bucket.tokens = rl.burst
+	}
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+
+	return true
+}
+
+// cleanup removes buckets which have been refilled completely, must be called with lock held.
+func (rl *RateLimiter) cleanup(now time.Time) {
+	for host, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, host)
+		}
+	}
+	rl.lastCleanup = now
+}
+
+// writeTooManyRequests sends a 429 response.
+func writeTooManyRequests(res http.ResponseWriter) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusTooManyRequests)
+	LogError(json.NewEncoder(res).Encode(map[string]interface{}{
+		"error": "rate limit exceeded",
+	}))
+}
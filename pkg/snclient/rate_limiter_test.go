@@ -0,0 +1,68 @@
+package snclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		assert.Truef(t, limiter.Allow("127.0.0.1:12345"), "request %d within burst", i)
+	}
+	assert.Falsef(t, limiter.Allow("127.0.0.1:23456"), "burst exceeded, port does not matter")
+	assert.Truef(t, limiter.Allow("[::1]:12345"), "other address has its own limit")
+
+	var disabled *RateLimiter
+	assert.Truef(t, disabled.Allow("127.0.0.1:12345"), "disabled rate limiter allows everything")
+}
+
+func TestRateLimiterSlowRate(t *testing.T) {
+	limiter := NewRateLimiter(0.1, 0)
+	assert.Truef(t, limiter.Allow("127.0.0.1:12345"), "first request is allowed")
+	assert.Falsef(t, limiter.Allow("127.0.0.1:12345"), "second request is rejected")
+
+	// pretend the last request was 10 seconds ago
+	limiter.buckets["127.0.0.1"].updated = time.Now().Add(-10 * time.Second)
+	assert.Truef(t, limiter.Allow("127.0.0.1:12345"), "request is allowed after 10 seconds")
+}
+
+func TestParseRateLimit(t *testing.T) {
+	for _, check := range []struct {
+		raw    string
+		expect float64
+	}{
+		{"10", 10},
+		{"0.5", 0.5},
+		{"1/10s", 0.1},
+		{"30 / 1m", 0.5},
+		{"0", 0},
+	} {
+		rate, err := ParseRateLimit(check.raw)
+		require.NoErrorf(t, err, "parse %s", check.raw)
+		assert.InDeltaf(t, check.expect, rate, 0.0001, "rate for %s", check.raw)
+	}
+
+	for _, raw := range []string{"abc", "-1", "1/0s", "1/abc"} {
+		_, err := ParseRateLimit(raw)
+		assert.Errorf(t, err, "invalid rate limit %s", raw)
+	}
+}
+
+func TestWriteTooManyRequests(t *testing.T) {
+	res := httptest.NewRecorder()
+	writeTooManyRequests(res)
+
+	assert.Equalf(t, http.StatusTooManyRequests, res.Code, "status code")
+	assert.Equalf(t, "application/json", res.Header().Get("Content-Type"), "content type")
+	body := map[string]interface{}{}
+	require.NoErrorf(t, json.Unmarshal(res.Body.Bytes(), &body), "body is valid json")
+	assert.Equalf(t, "rate limit exceeded", body["error"], "error message")
+}
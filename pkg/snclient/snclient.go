@@ -132,10 +132,18 @@ type AgentFlags struct {
 }
 
 type Agent struct {
-	Config            *Config     // reference to global config object
-	Listeners         *ModuleSet  // Listeners stores if we started listeners
-	Tasks             *ModuleSet  // Tasks stores if we started task runners
-	Counter           *CounterSet // Counter stores collected counters from tasks
+	Config            *Config           // reference to global config object
+	Listeners         *ModuleSet        // Listeners stores if we started listeners
+	Tasks             *ModuleSet        // Tasks stores if we started task runners
+	Counter           *CounterSet       // Counter stores collected counters from tasks
+	checkCache        *CheckCache       // checkCache stores results of commands with enabled caching
+	stateStore        *StateStore       // stateStore keeps list entries of checks with enabled diff
+	apiTokens         []*APIToken       // apiTokens contains the named tokens for the web listeners
+	clientIdentities  []*ClientIdentity // clientIdentities maps client certificates to identities
+	audit             *AuditLog         // audit writes executed commands to the audit log, nil if disabled
+	checkLimiter      *CheckLimiter     // checkLimiter limits the number of concurrently running checks
+	ctx               context.Context   // ctx is canceled when the agent stops
+	cancel            context.CancelFunc
 	flags             *AgentFlags
 	cpuProfileHandler *os.File
 	initSet           *AgentRunSet
@@ -146,24 +154,35 @@ type Agent struct {
 
 // AgentRunSet contains the initial startup config items
 type AgentRunSet struct {
-	config    *Config
-	listeners *ModuleSet
-	tasks     *ModuleSet
-	files     []string
+	config     *Config
+	listeners  *ModuleSet
+	tasks      *ModuleSet
+	apiTokens  []*APIToken
+	identities []*ClientIdentity
+	audit      *AuditLog
+	limits     *CheckLimitConfig
+	stateFile  string
+	files      []string
 }
 
 // NewAgent returns a new Agent object ready to be started by Run()
 func NewAgent(flags *AgentFlags) *Agent {
 	snc := &Agent{
-		Listeners: NewModuleSet("listener"),
-		Tasks:     NewModuleSet("task"),
-		Counter:   NewCounterSet(),
-		Config:    NewConfig(true),
-		flags:     flags,
-		Log:       log,
-	}
+		Listeners:    NewModuleSet("listener"),
+		Tasks:        NewModuleSet("task"),
+		Counter:      NewCounterSet(),
+		checkCache:   NewCheckCache(),
+		checkLimiter: NewCheckLimiter(),
+		Config:       NewConfig(true),
+		flags:        flags,
+		Log:          log,
+	}
+	snc.ctx, snc.cancel = context.WithCancel(context.Background())
 	snc.checkFlags()
 	snc.createLogger(nil)
+	if flags.Mode == ModeServer {
+		snc.checkPendingUpdate()
+	}
 
 	// reads the args, check if they are params, if so sends them to the configuration reader
 	initSet, err := snc.Init()
@@ -176,8 +195,14 @@ func NewAgent(flags *AgentFlags) *Agent {
 		snc.CleanExit(ExitCodeError)
 	}
 	snc.initSet = initSet
+	snc.stateStore = NewStateStore(initSet.stateFile)
+	if err := snc.stateStore.Load(); err != nil {
+		LogStderrf("WARNING: %s", err.Error())
+	}
 	snc.Tasks = initSet.tasks
 	snc.Config = initSet.config
+	snc.audit = initSet.audit
+	snc.checkLimiter.SetConfig(initSet.limits)
 
 	snc.osSignalChannel = make(chan os.Signal, 1)
 
@@ -282,6 +307,7 @@ func (snc *Agent) mainLoop() MainStateType {
 
 				snc.createLogger(updateSet.config)
 				snc.startModules(updateSet)
+				snc.checkCache.Flush()
 
 				return exitCode
 			case Shutdown, ShutdownGraceFully:
@@ -333,8 +359,11 @@ func (snc *Agent) StopWait(maxWait time.Duration) bool {
 }
 
 func (snc *Agent) stop() {
+	snc.cancel()
 	snc.Tasks.StopRemove()
 	snc.Listeners.StopRemove()
+	snc.audit.Close()
+	LogError(snc.stateStore.Flush())
 }
 
 func (snc *Agent) startModules(initSet *AgentRunSet) {
@@ -348,6 +377,18 @@ func (snc *Agent) startModules(initSet *AgentRunSet) {
 	snc.Config = initSet.config
 	snc.Listeners = initSet.listeners
 	snc.Tasks = initSet.tasks
+	snc.apiTokens = initSet.apiTokens
+	snc.clientIdentities = initSet.identities
+	if snc.audit != initSet.audit {
+		snc.audit.Close()
+		snc.audit = initSet.audit
+	}
+	snc.checkLimiter.SetConfig(initSet.limits)
+	if snc.stateStore.file != initSet.stateFile {
+		LogError(snc.stateStore.Flush())
+		snc.stateStore = NewStateStore(initSet.stateFile)
+		LogError(snc.stateStore.Load())
+	}
 
 	snc.Tasks.Start()
 	snc.Listeners.Start()
@@ -459,6 +500,7 @@ func (snc *Agent) readConfiguration(files []string) (initSet *AgentRunSet, err e
 	if err = utils.IsFolder(pathSection.data["shared-path"]); err != nil {
 		return initSet, fmt.Errorf("shared-path %s", err.Error())
 	}
+	initSet.stateFile = pathSection.data["state-file"]
 
 	// replace other sections
 	for _, section := range config.sections {
@@ -473,6 +515,36 @@ func (snc *Agent) readConfiguration(files []string) (initSet *AgentRunSet, err e
 		return initSet, fmt.Errorf("reading settings failed: %s", parseError.Error())
 	}
 
+	apiTokens, err := NewAPITokens(config)
+	if err != nil {
+		return initSet, fmt.Errorf("api token initialization failed: %s", err.Error())
+	}
+	initSet.apiTokens = apiTokens
+
+	identities, err := NewClientIdentities(config)
+	if err != nil {
+		return initSet, fmt.Errorf("client identity initialization failed: %s", err.Error())
+	}
+	initSet.identities = identities
+
+	auditConf := config.Section(AuditSection)
+	auditEnabled, _, err := auditConf.GetBool("enabled")
+	if err != nil {
+		return initSet, fmt.Errorf("audit log initialization failed: enabled: %s", err.Error())
+	}
+	if auditEnabled {
+		initSet.audit, err = NewAuditLog(auditConf)
+		if err != nil {
+			return initSet, fmt.Errorf("audit log initialization failed: %s", err.Error())
+		}
+	}
+
+	limits, err := NewCheckLimitConfig(config.Section(CheckLimitSection))
+	if err != nil {
+		return initSet, fmt.Errorf("check limits initialization failed: %s", err.Error())
+	}
+	initSet.limits = limits
+
 	tasks, err2 := snc.initModules("tasks", AvailableTasks, config)
 	initSet.tasks = tasks
 	if err2 != nil {
@@ -487,7 +559,7 @@ func (snc *Agent) readConfiguration(files []string) (initSet *AgentRunSet, err e
 			return initSet, fmt.Errorf("listener initialization failed: %s", err.Error())
 		}
 
-		if len(listen.modules) == 0 {
+		if len(listen.Modules()) == 0 {
 			log.Warnf("no listener enabled")
 		}
 		initSet.listeners = listen
@@ -691,10 +763,14 @@ func (snc *Agent) RunCheck(name string, args []string) *CheckResult {
 
 // RunCheckWithContext calls check by name and returns the check result
 func (snc *Agent) RunCheckWithContext(ctx context.Context, name string, args []string) *CheckResult {
-	res := snc.runCheck(ctx, name, args)
+	started := time.Now()
+	res := snc.checkLimiter.Run(ctx, name, args, func(ctx context.Context) *CheckResult {
+		return snc.runCheck(ctx, name, args)
+	})
 	if res.Raw == nil || res.Raw.showHelp == 0 {
 		res.Finalize()
 	}
+	snc.audit.Log(ctx, name, args, time.Since(started), res.State, res.Output)
 
 	return res
 }
@@ -734,6 +810,9 @@ func (snc *Agent) runCheck(ctx context.Context, name string, args []string) *Che
 		}
 	}
 
+	chk.stateStore = snc.stateStore
+	chk.stateName = strings.TrimSpace(name + " " + strings.Join(args, " "))
+
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(chk.timeout+1)*time.Second)
 	defer cancel()
 
@@ -1135,6 +1214,12 @@ func (snc *Agent) setDefaultPaths(config *Config, configFiles []string) *ConfigS
 		pathSection.Set("certificate-path", pathSection.data["shared-path"])
 	}
 
+	// state-file points to %{shared-path}/snclient.state unless set otherwise
+	stateFile, ok := pathSection.GetString("state-file")
+	if !ok || stateFile == "" {
+		pathSection.Set("state-file", filepath.Join(pathSection.data["shared-path"], "snclient.state"))
+	}
+
 	// add script root
 	scriptsSection := config.Section("/settings/external scripts")
 	scriptRoot, ok := scriptsSection.GetString("script root")
@@ -1199,7 +1284,8 @@ func (snc *Agent) BuildInventory(ctx context.Context, modules []string) map[stri
 		check := AvailableChecks[k]
 		handler := check.Handler()
 		meta := handler.Build()
-		if !meta.isImplemented(runtime.GOOS) {
+		// external scripts have no platform set but are always available on this host
+		if meta.hasInventory != ScriptsInventory && !meta.isImplemented(runtime.GOOS) {
 			continue
 		}
 		switch meta.hasInventory {
@@ -1210,16 +1296,14 @@ func (snc *Agent) BuildInventory(ctx context.Context, modules []string) map[stri
 			if len(modules) > 0 && !slices.Contains(modules, name) {
 				continue
 			}
-			meta.output = "inventory_json"
-			meta.filter = []*Condition{{isNone: true}}
-			data, err := handler.Check(ctx, snc, meta, []Argument{})
-			if err != nil && (data == nil || data.Raw == nil) {
+			listData, err := snc.runInventoryCheck(ctx, &check)
+			if err != nil {
 				log.Tracef("inventory %s returned error: %s", check.Name, err.Error())
 
 				continue
 			}
 
-			inventory[name] = data.Raw.listData
+			inventory[name] = listData
 		case NoCallInventory:
 			name := strings.TrimPrefix(check.Name, "check_")
 			if len(modules) > 0 && !slices.Contains(modules, name) {
@@ -1231,6 +1315,22 @@ func (snc *Agent) BuildInventory(ctx context.Context, modules []string) map[stri
 		}
 	}
 
+	for name, provider := range AvailableInventory {
+		if !provider.Implemented.supports(runtime.GOOS) {
+			continue
+		}
+		if len(modules) > 0 && !slices.Contains(modules, name) {
+			continue
+		}
+		list, err := provider.Collect(ctx, snc, inventoryRoot)
+		if err != nil {
+			log.Tracef("inventory %s returned error: %s", name, err.Error())
+
+			continue
+		}
+		inventory[name] = list
+	}
+
 	if len(modules) == 0 || slices.Contains(modules, "scripts") {
 		inventory["scripts"] = scripts
 	}
@@ -1240,3 +1340,20 @@ func (snc *Agent) BuildInventory(ctx context.Context, modules []string) map[stri
 		"localtime": time.Now().Unix(),
 	})
 }
+
+// runInventoryCheck runs given check in inventory mode and returns the unfiltered list entries
+func (snc *Agent) runInventoryCheck(ctx context.Context, check *CheckEntry) ([]map[string]string, error) {
+	handler := check.Handler()
+	meta := handler.Build()
+	meta.output = "inventory_json"
+	meta.filter = []*Condition{{isNone: true}}
+	data, err := handler.Check(ctx, snc, meta, []Argument{})
+	if err != nil && (data == nil || data.Raw == nil) {
+		return nil, err
+	}
+	if data == nil || data.Raw == nil {
+		return nil, fmt.Errorf("%s returned no inventory data", check.Name)
+	}
+
+	return data.Raw.listData, nil
+}
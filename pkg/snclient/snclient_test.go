@@ -1,6 +1,7 @@
 package snclient
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -42,3 +43,20 @@ password3 = SHA256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00
 
 	StopTestAgent(t, snc)
 }
+
+func TestBuildInventoryScripts(t *testing.T) {
+	config := `
+[/modules]
+CheckExternalScripts = enabled
+
+[/settings/external scripts/scripts]
+check_inventory_script = ./t/scripts/check_dummy.sh 0
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	inventory := snc.BuildInventory(context.TODO(), []string{"scripts"})
+	data, ok := inventory["inventory"].(map[string]interface{})
+	assert.Truef(t, ok, "inventory has correct type")
+	assert.Containsf(t, data["scripts"], "check_inventory_script", "external script is part of the inventory")
+}
@@ -0,0 +1,218 @@
+package snclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// StateStoreSaveDelay sets the time changes are collected before the state file is written
+	StateStoreSaveDelay = 10 * time.Second
+
+	// StateStoreExpire sets the duration after which unused entries are removed
+	StateStoreExpire = 30 * 24 * time.Hour
+)
+
+// StateStore persists the list entries of checks between runs to detect changes.
+type StateStore struct {
+	noCopy    noCopy
+	lock      deadlock.Mutex
+	file      string // state will not be persisted if file is empty
+	checks    map[string]*StateStoreEntry
+	saveTimer *time.Timer // pending write of the state file, nil if nothing changed
+	locks     map[string]*stateStoreLock
+}
+
+// stateStoreLock serializes read-and-update cycles of a single entry.
+type stateStoreLock struct {
+	lock  sync.Mutex
+	users int
+}
+
+// StateStoreEntry contains the list entries of a single check run, indexed by key attribute.
+type StateStoreEntry struct {
+	Updated int64                        `json:"updated"`
+	Used    int64                        `json:"used"`
+	Key     string                       `json:"key"`
+	Entries map[string]map[string]string `json:"entries"`
+}
+
+// NewStateStore returns a new state store which is saved to given file.
+func NewStateStore(file string) *StateStore {
+	return &StateStore{
+		file:   file,
+		checks: make(map[string]*StateStoreEntry),
+		locks:  make(map[string]*stateStoreLock),
+	}
+}
+
+// Load reads the state file. A missing file is not an error.
+func (ss *StateStore) Load() error {
+	if ss.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(ss.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read state file: %s", err.Error())
+	}
+
+	checks := make(map[string]*StateStoreEntry)
+	err = json.Unmarshal(data, &checks)
+	if err != nil {
+		return fmt.Errorf("failed to parse state file %s: %s", ss.file, err.Error())
+	}
+
+	ss.lock.Lock()
+	ss.checks = checks
+	ss.expire()
+	ss.lock.Unlock()
+
+	return nil
+}
+
+// Get returns the stored entries for given check or nil.
+func (ss *StateStore) Get(name string) *StateStoreEntry {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	entry := ss.checks[name]
+	if entry != nil {
+		entry.Used = time.Now().Unix()
+	}
+
+	return entry
+}
+
+// Set stores the entries for given check. The state file is written with a short delay.
+func (ss *StateStore) Set(name string, entry *StateStoreEntry) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	entry.Updated = time.Now().Unix()
+	entry.Used = entry.Updated
+	ss.checks[name] = entry
+	ss.scheduleSave()
+
+	return nil
+}
+
+// Swap stores the new entries for given check and returns the previous ones.
+func (ss *StateStore) Swap(name string, entry *StateStoreEntry) (previous *StateStoreEntry, err error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	previous = ss.checks[name]
+	entry.Updated = time.Now().Unix()
+	entry.Used = entry.Updated
+	ss.checks[name] = entry
+	ss.scheduleSave()
+
+	return previous, nil
+}
+
+// LockEntry blocks until no one else holds the lock for given entry and returns the unlock function.
+// It is used to make reading and updating an entry atomic for concurrent check runs.
+func (ss *StateStore) LockEntry(name string) (unlock func()) {
+	ss.lock.Lock()
+	entryLock, ok := ss.locks[name]
+	if !ok {
+		entryLock = &stateStoreLock{}
+		ss.locks[name] = entryLock
+	}
+	entryLock.users++
+	ss.lock.Unlock()
+
+	entryLock.lock.Lock()
+
+	return func() {
+		entryLock.lock.Unlock()
+
+		ss.lock.Lock()
+		entryLock.users--
+		if entryLock.users == 0 {
+			delete(ss.locks, name)
+		}
+		ss.lock.Unlock()
+	}
+}
+
+// Flush writes pending changes to the state file immediately.
+func (ss *StateStore) Flush() error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.saveTimer == nil {
+		return nil
+	}
+	ss.saveTimer.Stop()
+	ss.saveTimer = nil
+
+	return ss.save()
+}
+
+// scheduleSave writes the state file after StateStoreSaveDelay, so multiple changes result in a single write.
+// Must be called with lock held.
+func (ss *StateStore) scheduleSave() {
+	if ss.file == "" || ss.saveTimer != nil {
+		return
+	}
+
+	ss.saveTimer = time.AfterFunc(StateStoreSaveDelay, func() {
+		ss.lock.Lock()
+		defer ss.lock.Unlock()
+
+		if ss.saveTimer == nil {
+			return
+		}
+		ss.saveTimer = nil
+		LogError(ss.save())
+	})
+}
+
+// expire removes all entries which have not been used for StateStoreExpire, must be called with lock held.
+func (ss *StateStore) expire() {
+	expired := time.Now().Add(-StateStoreExpire).Unix()
+	for name, entry := range ss.checks {
+		if entry.Updated < expired && entry.Used < expired {
+			delete(ss.checks, name)
+		}
+	}
+}
+
+// save writes the state file atomically, must be called with lock held.
+func (ss *StateStore) save() error {
+	if ss.file == "" {
+		return nil
+	}
+
+	ss.expire()
+
+	data, err := json.Marshal(ss.checks)
+	if err != nil {
+		return fmt.Errorf("failed to serialize state: %s", err.Error())
+	}
+
+	tmpFile := ss.file + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %s", err.Error())
+	}
+
+	err = os.Rename(tmpFile, ss.file)
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %s", err.Error())
+	}
+
+	return nil
+}
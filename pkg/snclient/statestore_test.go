@@ -0,0 +1,118 @@
+package snclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateStoreRestart(t *testing.T) {
+	sharedPath := t.TempDir()
+	configFile := filepath.Join(sharedPath, "snclient.ini")
+	writeTestFile(t, configFile, "[/modules]\nWEBServer = disabled\n")
+
+	// no pidfile, like the systemd service
+	flags := &AgentFlags{
+		Quiet:       true,
+		ConfigFiles: []string{configFile},
+		Mode:        ModeServer,
+	}
+	snc := NewAgent(flags)
+	assert.Equalf(t, filepath.Join(sharedPath, "snclient.state"), snc.stateStore.file, "state file in shared path")
+	require.Truef(t, snc.StartWait(10*time.Second), "agent started")
+	require.NoError(t, snc.stateStore.Set("test", &StateStoreEntry{Key: "name", Entries: map[string]map[string]string{"a": {"name": "a"}}}))
+	require.Truef(t, snc.StopWait(10*time.Second), "agent stopped")
+
+	snc = NewAgent(flags)
+	entry := snc.stateStore.Get("test")
+	require.NotNilf(t, entry, "state survives restart")
+	assert.Equalf(t, map[string]map[string]string{"a": {"name": "a"}}, entry.Entries, "entries are restored")
+
+	// state file can be changed
+	writeTestFile(t, configFile, "[/modules]\nWEBServer = disabled\n[/paths]\nstate-file = ${shared-path}/other.state\n")
+	snc = NewAgent(flags)
+	assert.Equalf(t, filepath.Join(sharedPath, "other.state"), snc.stateStore.file, "state file from config")
+	assert.Nilf(t, snc.stateStore.Get("test"), "other state file is empty")
+}
+
+func TestStateStoreSaveExpire(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "snclient.state")
+	store := NewStateStore(stateFile)
+
+	require.NoError(t, store.Set("current", &StateStoreEntry{Key: "name"}))
+	require.NoError(t, store.Set("unused", &StateStoreEntry{Key: "name"}))
+	assert.NoFileExistsf(t, stateFile, "state file is written delayed")
+
+	expired := time.Now().Add(-StateStoreExpire - time.Hour).Unix()
+	store.checks["unused"].Updated = expired
+	store.checks["unused"].Used = expired
+	store.checks["current"].Updated = expired
+	assert.NotNilf(t, store.Get("current"), "entry exists")
+
+	require.NoError(t, store.Flush())
+	assert.FileExistsf(t, stateFile, "state file is written on flush")
+
+	store = NewStateStore(stateFile)
+	require.NoError(t, store.Load())
+	assert.NotNilf(t, store.Get("current"), "recently used entry is kept")
+	assert.Nilf(t, store.Get("unused"), "unused entry is expired")
+}
+
+func TestCheckDiff(t *testing.T) {
+	snc := StartTestAgent(t, "")
+
+	tmpPath := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "snclient.state")
+	snc.stateStore = NewStateStore(stateFile)
+
+	writeFile := func(name, content string) {
+		t.Helper()
+		err := os.WriteFile(filepath.Join(tmpPath, name), []byte(content), 0o600)
+		require.NoError(t, err)
+	}
+	writeFile("a.txt", "a")
+	writeFile("b.txt", "b")
+
+	args := []string{
+		"path=" + tmpPath, "diff-key=name", "diff-attributes=size",
+		"warn=added_count > 0 or changed_count > 0", "crit=removed_count > 0",
+		"top-syntax=%(status) - added: %(added) removed: %(removed) changed: %(changed)",
+	}
+
+	// first run has nothing to compare
+	res := snc.RunCheck("check_files", args)
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	output := string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "OK - added:  removed:  changed:  |", "output matches")
+	assert.Containsf(t, output, "'added'=0;0;;0 'removed'=0;;0;0 'changed'=0;0;;0", "perfdata matches")
+
+	writeFile("b.txt", "bb")
+	writeFile("c.txt", "c")
+	res = snc.RunCheck("check_files", args)
+	assert.Equalf(t, CheckExitWarning, res.State, "state Warning")
+	output = string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "WARNING - added: c.txt removed:  changed: b.txt |", "output matches")
+	assert.Containsf(t, output, "'added'=1;0;;0 'removed'=0;;0;0 'changed'=1;0;;0", "perfdata matches")
+
+	// state survives restarts
+	require.NoError(t, snc.stateStore.Flush())
+	snc.stateStore = NewStateStore(stateFile)
+	require.NoError(t, snc.stateStore.Load())
+
+	require.NoError(t, os.Remove(filepath.Join(tmpPath, "a.txt")))
+	res = snc.RunCheck("check_files", args)
+	assert.Equalf(t, CheckExitCritical, res.State, "state Critical")
+	output = string(res.BuildPluginOutput())
+	assert.Containsf(t, output, "CRITICAL - added:  removed: a.txt changed:  |", "output matches")
+	assert.Containsf(t, output, "'added'=0;0;;0 'removed'=1;;0;0 'changed'=0;0;;0", "perfdata matches")
+
+	res = snc.RunCheck("check_files", append(args, "detail-syntax=%(name): %(diff)", "top-syntax=%(list)"))
+	assert.Equalf(t, CheckExitOK, res.State, "state OK")
+	assert.Containsf(t, string(res.BuildPluginOutput()), "b.txt: unchanged, c.txt: unchanged", "entries contain diff attribute")
+
+	StopTestAgent(t, snc)
+}
@@ -80,9 +80,19 @@ func (e *ExternalScriptsHandler) registerScripts(conf *Config) error {
 			continue
 		}
 		cmdConf := conf.Section(sectionName)
+		var policy *ArgumentPolicy
+		if hasArgumentPolicy(cmdConf) {
+			argPolicy, err := NewArgumentPolicy(name, cmdConf)
+			if err != nil {
+				return err
+			}
+			policy = argPolicy
+		}
 		if command, ok := cmdConf.GetString("command"); ok {
 			log.Tracef("registered script: %s -> %s", name, command)
-			AvailableChecks[name] = CheckEntry{name, func() CheckHandler { return &CheckWrap{name: name, commandString: command, config: cmdConf} }}
+			AvailableChecks[name] = CheckEntry{name, func() CheckHandler {
+				return &CheckWrap{name: name, commandString: command, config: cmdConf, policy: policy}
+			}}
 		} else {
 			return fmt.Errorf("missing command in external script %s", name)
 		}
@@ -108,10 +118,18 @@ func (e *ExternalScriptsHandler) registerWrapped(conf *Config) error {
 			continue
 		}
 		cmdConf := conf.Section(sectionName)
+		var policy *ArgumentPolicy
+		if hasArgumentPolicy(cmdConf) {
+			argPolicy, err := NewArgumentPolicy(name, cmdConf)
+			if err != nil {
+				return err
+			}
+			policy = argPolicy
+		}
 		if command, ok := cmdConf.GetString("command"); ok {
 			log.Tracef("registered wrapped script: %s -> %s", name, command)
 			AvailableChecks[name] = CheckEntry{name, func() CheckHandler {
-				return &CheckWrap{name: name, commandString: command, wrapped: true, config: cmdConf}
+				return &CheckWrap{name: name, commandString: command, wrapped: true, config: cmdConf, policy: policy}
 			}}
 		} else {
 			return fmt.Errorf("missing command in wrapped external script %s", name)
@@ -138,10 +156,20 @@ func (e *ExternalScriptsHandler) registerAliases(conf *Config) error {
 			continue
 		}
 		cmdConf := conf.Section(sectionName)
+		var policy *ArgumentPolicy
+		if hasArgumentPolicy(cmdConf) {
+			argPolicy, err := NewArgumentPolicy(name, cmdConf)
+			if err != nil {
+				return err
+			}
+			policy = argPolicy
+		}
 		if command, ok := cmdConf.GetString("command"); ok {
 			f := utils.Tokenize(command)
 			log.Tracef("registered alias script: %s -> %s", name, command)
-			AvailableChecks[name] = CheckEntry{name, func() CheckHandler { return &CheckAlias{command: f[0], args: f[1:], config: cmdConf} }}
+			AvailableChecks[name] = CheckEntry{name, func() CheckHandler {
+				return &CheckAlias{name: name, command: f[0], args: f[1:], config: cmdConf, policy: policy}
+			}}
 		} else {
 			return fmt.Errorf("missing command in alias script %s", name)
 		}
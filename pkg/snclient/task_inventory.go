@@ -0,0 +1,404 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// InventoryIntervalInitial sets the delay until the first inventory is built after start
+	InventoryIntervalInitial = 30 * time.Second
+
+	// InventoryMinInterval sets the minimum allowed inventory interval
+	InventoryMinInterval = 1 * time.Minute
+
+	// inventoryStatePrefix is used for the snapshots in the state store
+	inventoryStatePrefix = "inventory"
+)
+
+func init() {
+	RegisterModule(&AvailableTasks, "Inventory", "/settings/inventory", NewInventoryHandler)
+}
+
+// inventoryDiffKeys contains the attribute which identifies an entry of an inventory module, defaults to name.
+var inventoryDiffKeys = map[string]string{
+	"os_updates": "package",
+	"mount":      "mount",
+	"drivesize":  "drive",
+	"process":    "pid",
+	"container":  "id",
+	"x509":       "file",
+
+	"cpu_info":          "socket",
+	"packages":          "id",
+	"listening_sockets": "socket",
+}
+
+// inventoryVolatileAttributes change on every run and are not part of the inventory documents.
+var inventoryVolatileAttributes = map[string][]string{
+	"os_updates": {"prefix"},
+	"service":    {"pid", "created", "age", "rss", "vms", "cpu", "tasks"},
+	"network":    {"received", "total_received", "sent", "total_sent", "total"},
+
+	"kernel_modules":    {"used"},
+	"listening_sockets": {"pid"},
+}
+
+// InventoryHandler builds the inventory periodically and pushes changes to a central endpoint.
+type InventoryHandler struct {
+	noCopy noCopy
+
+	snc *Agent
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	url          string
+	header       map[string]string
+	hostName     string
+	modules      []string
+	interval     time.Duration
+	fullInterval time.Duration
+	httpOptions  *HTTPClientOptions
+}
+
+// InventoryDocument is posted to the inventory url, either containing the full inventory or the changes only.
+type InventoryDocument struct {
+	Type      string                         `json:"type"` // full or delta
+	HostName  string                         `json:"host_name"`
+	Timestamp int64                          `json:"timestamp"`
+	Inventory map[string][]map[string]string `json:"inventory,omitempty"`
+	Changes   map[string]*InventoryChanges   `json:"changes,omitempty"`
+}
+
+// InventoryChanges contains the changed entries of a single inventory module.
+type InventoryChanges struct {
+	Key     string              `json:"key"`
+	Added   []map[string]string `json:"added"`
+	Changed []map[string]string `json:"changed"`
+	Removed []map[string]string `json:"removed"`
+}
+
+func NewInventoryHandler() Module {
+	return &InventoryHandler{}
+}
+
+func (i *InventoryHandler) Defaults() ConfigData {
+	defaults := ConfigData{
+		"interval":      "1h",
+		"full interval": "7d",
+		"host name":     "${hostname}",
+		"modules":       "os_updates, service, mount, network, scripts",
+	}
+	defaults.Merge(DefaultHTTPClientConfig)
+
+	return defaults
+}
+
+func (i *InventoryHandler) Init(snc *Agent, section *ConfigSection, _ *Config, _ *ModuleSet) error {
+	i.snc = snc
+	ctx, cancel := context.WithCancel(WithRequestSource(context.Background(), "inventory", "", ""))
+	i.ctx = ctx
+	i.cancel = cancel
+	i.header = map[string]string{}
+
+	url, ok := section.GetString("url")
+	if !ok || url == "" {
+		return fmt.Errorf("missing url")
+	}
+	i.url = url
+
+	if token, ok := section.GetString("token"); ok && token != "" {
+		i.header["Authorization"] = "Bearer " + token
+	}
+
+	if hostName, ok := section.GetString("host name"); ok {
+		i.hostName = hostName
+	}
+
+	i.modules = []string{}
+	if modules, ok := section.GetString("modules"); ok {
+		for _, name := range strings.Split(modules, ",") {
+			name = strings.TrimPrefix(strings.TrimSpace(name), "check_")
+			if name != "" {
+				i.modules = append(i.modules, name)
+			}
+		}
+	}
+
+	interval, _, err := section.GetDuration("interval")
+	if err != nil {
+		return fmt.Errorf("interval: %s", err.Error())
+	}
+	i.interval = time.Duration(interval * float64(time.Second))
+	if i.interval < InventoryMinInterval {
+		return fmt.Errorf("interval: must be at least %s", InventoryMinInterval.String())
+	}
+
+	fullInterval, _, err := section.GetDuration("full interval")
+	if err != nil {
+		return fmt.Errorf("full interval: %s", err.Error())
+	}
+	i.fullInterval = time.Duration(fullInterval * float64(time.Second))
+
+	httpOptions, err := snc.buildClientHTTPOptions(section)
+	if err != nil {
+		return err
+	}
+	i.httpOptions = httpOptions
+
+	return nil
+}
+
+func (i *InventoryHandler) Start() error {
+	i.wg.Add(1)
+	go func() {
+		defer i.snc.logPanicExit()
+		defer i.wg.Done()
+		i.mainLoop()
+	}()
+
+	return nil
+}
+
+func (i *InventoryHandler) Stop() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+func (i *InventoryHandler) mainLoop() {
+	ticker := time.NewTicker(InventoryIntervalInitial)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.ctx.Done():
+			log.Tracef("[inventory] stopping InventoryHandler mainLoop")
+
+			return
+		case <-ticker.C:
+			ticker.Reset(i.interval)
+			if err := i.Push(i.ctx); err != nil {
+				log.Warnf("[inventory] submitting inventory failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Push builds the inventory and posts the full document or the changes since the last successful submit.
+func (i *InventoryHandler) Push(ctx context.Context) error {
+	current := i.collect(ctx)
+	if ctx.Err() != nil {
+		// agent is shutting down, inventory is not complete
+		return nil
+	}
+
+	doc, snapshots := i.buildDocument(current, time.Now())
+	if doc == nil {
+		log.Debugf("[inventory] no changes since last submit")
+
+		return nil
+	}
+
+	payload, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("json error: %s", err.Error())
+	}
+
+	if err := i.snc.httpPostJSON(ctx, i.httpOptions, i.url, i.header, payload); err != nil {
+		return err
+	}
+	log.Debugf("[inventory] submitted %s inventory to %s", doc.Type, i.url)
+
+	// only store snapshots after successful submits, so changes will be sent again on errors
+	for name, snapshot := range snapshots {
+		LogError(i.snc.stateStore.Set(inventoryStatePrefix+" "+name, snapshot))
+	}
+	if doc.Type == "full" {
+		LogError(i.snc.stateStore.Set(inventoryStatePrefix, &StateStoreEntry{}))
+	}
+
+	return nil
+}
+
+// collect builds the inventory of all configured modules, entries are reduced to non-volatile attributes.
+func (i *InventoryHandler) collect(ctx context.Context) map[string][]map[string]string {
+	result := make(map[string][]map[string]string)
+	raw := i.snc.BuildInventory(ctx, i.modules)
+	inventory, _ := raw["inventory"].(map[string]interface{})
+	for name, data := range inventory {
+		var list []map[string]string
+		switch data := data.(type) {
+		case []map[string]string:
+			list = data
+		case []string:
+			for _, val := range data {
+				list = append(list, map[string]string{"name": val})
+			}
+		default:
+			// modules which are too expensive for the inventory api, ex.: os_updates
+			check, ok := AvailableChecks["check_"+name]
+			if !ok {
+				continue
+			}
+			listData, err := i.snc.runInventoryCheck(ctx, &check)
+			if err != nil {
+				log.Debugf("[inventory] %s returned error: %s", name, err.Error())
+
+				continue
+			}
+			list = listData
+		}
+
+		entries := make([]map[string]string, 0, len(list))
+		for _, entry := range list {
+			entries = append(entries, inventoryEntry(name, entry))
+		}
+		result[name] = entries
+	}
+
+	return result
+}
+
+// buildDocument compares the current inventory with the last snapshots and returns the document to submit
+// and the new snapshots. The document is nil if nothing has changed.
+func (i *InventoryHandler) buildDocument(current map[string][]map[string]string, now time.Time) (doc *InventoryDocument, snapshots map[string]*StateStoreEntry) {
+	snapshots = make(map[string]*StateStoreEntry)
+	for name, entries := range current {
+		snapshots[name] = inventorySnapshot(name, entries)
+	}
+
+	doc = &InventoryDocument{
+		Type:      "full",
+		HostName:  i.hostName,
+		Timestamp: now.Unix(),
+	}
+
+	lastFull := i.snc.stateStore.Get(inventoryStatePrefix)
+	if lastFull == nil || (i.fullInterval > 0 && now.Sub(time.Unix(lastFull.Updated, 0)) >= i.fullInterval) {
+		doc.Inventory = current
+
+		return doc, snapshots
+	}
+
+	doc.Type = "delta"
+	doc.Changes = make(map[string]*InventoryChanges)
+	for name, snapshot := range snapshots {
+		previous := i.snc.stateStore.Get(inventoryStatePrefix + " " + name)
+		if previous != nil && previous.Key != snapshot.Key {
+			previous = nil
+		}
+		changes := inventoryDiff(previous, snapshot)
+		if len(changes.Added)+len(changes.Changed)+len(changes.Removed) > 0 {
+			doc.Changes[name] = changes
+		}
+	}
+
+	if len(doc.Changes) == 0 {
+		return nil, snapshots
+	}
+
+	return doc, snapshots
+}
+
+// inventoryEntry returns a copy of the entry without internal and volatile attributes
+func inventoryEntry(name string, entry map[string]string) map[string]string {
+	volatile := inventoryVolatileAttributes[name]
+	result := make(map[string]string, len(entry))
+	for key, val := range entry {
+		if strings.HasPrefix(key, "_") || slices.Contains(volatile, key) {
+			continue
+		}
+		result[key] = val
+	}
+
+	return result
+}
+
+// inventorySnapshot returns the entries indexed by the key attribute of this module
+func inventorySnapshot(name string, entries []map[string]string) *StateStoreEntry {
+	keyAttr, ok := inventoryDiffKeys[name]
+	if !ok {
+		keyAttr = "name"
+	}
+
+	snapshot := &StateStoreEntry{
+		Key:     keyAttr,
+		Entries: make(map[string]map[string]string, len(entries)),
+	}
+	for _, entry := range entries {
+		snapshot.Entries[inventoryEntryKey(keyAttr, entry)] = entry
+	}
+
+	return snapshot
+}
+
+// inventoryEntryKey returns the value of the key attribute or all values if the entry has no such attribute
+func inventoryEntryKey(keyAttr string, entry map[string]string) string {
+	if key, ok := entry[keyAttr]; ok {
+		return key
+	}
+
+	attributes := make([]string, 0, len(entry))
+	for key, val := range entry {
+		attributes = append(attributes, key+"="+val)
+	}
+	sort.Strings(attributes)
+
+	return strings.Join(attributes, ",")
+}
+
+// inventoryDiff returns added, changed and removed entries sorted by key, all entries are added without previous snapshot
+func inventoryDiff(previous, current *StateStoreEntry) *InventoryChanges {
+	changes := &InventoryChanges{
+		Key:     current.Key,
+		Added:   []map[string]string{},
+		Changed: []map[string]string{},
+		Removed: []map[string]string{},
+	}
+
+	keys := make([]string, 0, len(current.Entries))
+	for key := range current.Entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		entry := current.Entries[key]
+		if previous == nil {
+			changes.Added = append(changes.Added, entry)
+
+			continue
+		}
+		prev, ok := previous.Entries[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, entry)
+		case len(diffAttributes(prev, entry)) > 0:
+			changes.Changed = append(changes.Changed, entry)
+		}
+	}
+
+	if previous != nil {
+		removed := make([]string, 0)
+		for key := range previous.Entries {
+			if _, ok := current.Entries[key]; !ok {
+				removed = append(removed, key)
+			}
+		}
+		sort.Strings(removed)
+		for _, key := range removed {
+			changes.Removed = append(changes.Removed, previous.Entries[key])
+		}
+	}
+
+	return changes
+}
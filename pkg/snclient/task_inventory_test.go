@@ -0,0 +1,178 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventoryPush(t *testing.T) {
+	// fake inventory receiver
+	status := http.StatusNoContent
+	documents := make(chan *InventoryDocument, 5)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		doc := &InventoryDocument{}
+		LogError(json.NewDecoder(req.Body).Decode(doc))
+		assert.Equalf(t, "Bearer secret", req.Header.Get("Authorization"), "token is sent")
+		documents <- doc
+		res.WriteHeader(status)
+	}))
+	defer httpServer.Close()
+
+	config := fmt.Sprintf(`
+[/modules]
+Inventory = enabled
+CheckExternalScripts = enabled
+
+[/settings/inventory]
+url = %s
+token = secret
+host name = testhost
+modules = scripts
+
+[/settings/external scripts/scripts]
+check_inventory_a = echo a
+check_inventory_b = echo b
+`, httpServer.URL)
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	task := snc.Tasks.Get("Inventory")
+	require.NotNilf(t, task, "inventory task is running")
+	handler, ok := task.(*InventoryHandler)
+	require.Truef(t, ok, "inventory task has correct type")
+
+	// first submit sends the full inventory
+	ctx := context.Background()
+	require.NoError(t, handler.Push(ctx))
+	doc := <-documents
+	assert.Equalf(t, "full", doc.Type, "full inventory is sent first")
+	assert.Equalf(t, "testhost", doc.HostName, "host name is set")
+	assert.Containsf(t, doc.Inventory["scripts"], map[string]string{"name": "check_inventory_a"}, "script is part of the inventory")
+	assert.Containsf(t, doc.Inventory["scripts"], map[string]string{"name": "check_inventory_b"}, "script is part of the inventory")
+
+	// nothing changed, nothing is sent
+	require.NoError(t, handler.Push(ctx))
+	assert.Emptyf(t, documents, "no document without changes")
+
+	// simulate changes since the last snapshot
+	snapshot := snc.stateStore.Get("inventory scripts")
+	require.NotNilf(t, snapshot, "snapshot is stored")
+	delete(snapshot.Entries, "check_inventory_b")
+	snapshot.Entries["check_inventory_removed"] = map[string]string{"name": "check_inventory_removed"}
+	require.NoError(t, snc.stateStore.Set("inventory scripts", snapshot))
+
+	// failed submits keep the last snapshot
+	status = http.StatusInternalServerError
+	require.Errorf(t, handler.Push(ctx), "failed submit returns error")
+	<-documents
+	assert.Containsf(t, snc.stateStore.Get("inventory scripts").Entries, "check_inventory_removed", "snapshot is unchanged")
+
+	status = http.StatusNoContent
+	require.NoError(t, handler.Push(ctx))
+	doc = <-documents
+	assert.Equalf(t, "delta", doc.Type, "only changes are sent")
+	assert.Nilf(t, doc.Inventory, "no full inventory in delta")
+	require.Lenf(t, doc.Changes, 1, "only scripts changed")
+	assert.Equalf(t, &InventoryChanges{
+		Key:     "name",
+		Added:   []map[string]string{{"name": "check_inventory_b"}},
+		Changed: []map[string]string{},
+		Removed: []map[string]string{{"name": "check_inventory_removed"}},
+	}, doc.Changes["scripts"], "changes are sent")
+
+	// snapshots are kept on disk
+	require.NoError(t, snc.stateStore.Flush())
+	store := NewStateStore(snc.stateStore.file)
+	require.NoError(t, store.Load())
+	assert.NotContainsf(t, store.Get("inventory scripts").Entries, "check_inventory_removed", "snapshot is updated")
+	assert.NotNilf(t, store.Get("inventory"), "time of last full inventory is stored")
+
+	// full inventory is sent again after the full interval
+	handler.fullInterval = time.Nanosecond
+	require.NoError(t, handler.Push(ctx))
+	doc = <-documents
+	assert.Equalf(t, "full", doc.Type, "full inventory is sent after full interval")
+}
+
+func TestInventoryRestart(t *testing.T) {
+	documents := make(chan *InventoryDocument, 5)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		doc := &InventoryDocument{}
+		LogError(json.NewDecoder(req.Body).Decode(doc))
+		documents <- doc
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer httpServer.Close()
+
+	config := fmt.Sprintf(`
+[/modules]
+Inventory = enabled
+CheckExternalScripts = enabled
+
+[/paths]
+state-file = %s
+
+[/settings/inventory]
+url = %s
+modules = scripts
+
+[/settings/external scripts/scripts]
+check_inventory_restart_a = echo a
+`, filepath.Join(t.TempDir(), "snclient.state"), httpServer.URL)
+
+	pushInventory := func() {
+		t.Helper()
+		snc := StartTestAgent(t, config)
+		defer StopTestAgent(t, snc)
+
+		handler, ok := snc.Tasks.Get("Inventory").(*InventoryHandler)
+		require.Truef(t, ok, "inventory task is running")
+		require.NoError(t, handler.Push(context.Background()))
+	}
+
+	pushInventory()
+	doc := <-documents
+	assert.Equalf(t, "full", doc.Type, "full inventory is sent first")
+
+	// snapshot is read from the state file by the new agent
+	config += "check_inventory_restart_b = echo b\n"
+	pushInventory()
+	doc = <-documents
+	assert.Equalf(t, "delta", doc.Type, "only changes are sent after restart")
+	assert.Equalf(t, []map[string]string{{"name": "check_inventory_restart_b"}}, doc.Changes["scripts"].Added, "added script is sent")
+}
+
+func TestInventoryDiff(t *testing.T) {
+	entries := []map[string]string{
+		inventoryEntry("service", map[string]string{"name": "sshd", "state": "running", "pid": "123", "_internal": "1"}),
+		inventoryEntry("service", map[string]string{"name": "cron", "state": "running", "pid": "456"}),
+	}
+	assert.Equalf(t, map[string]string{"name": "sshd", "state": "running"}, entries[0], "volatile attributes are removed")
+
+	previous := inventorySnapshot("service", entries)
+	assert.Equalf(t, "name", previous.Key, "default key attribute")
+
+	current := inventorySnapshot("service", []map[string]string{
+		{"name": "sshd", "state": "stopped"},
+		{"name": "nginx", "state": "running"},
+	})
+	changes := inventoryDiff(previous, current)
+	assert.Equalf(t, []map[string]string{{"name": "nginx", "state": "running"}}, changes.Added, "added entries")
+	assert.Equalf(t, []map[string]string{{"name": "sshd", "state": "stopped"}}, changes.Changed, "changed entries")
+	assert.Equalf(t, []map[string]string{{"name": "cron", "state": "running"}}, changes.Removed, "removed entries")
+
+	changes = inventoryDiff(nil, current)
+	assert.Lenf(t, changes.Added, 2, "all entries are added without previous snapshot")
+
+	assert.Equalf(t, "package", inventorySnapshot("os_updates", nil).Key, "module specific key attribute")
+	assert.Equalf(t, "a=1,b=2", inventoryEntryKey("name", map[string]string{"b": "2", "a": "1"}), "entries without key attribute")
+}
@@ -106,8 +106,10 @@ func (l *LogrotateHandler) mainLoop() {
 func (l *LogrotateHandler) rotate(logFile string) {
 	log.Debugf("rotating logfile %s", logFile)
 
+	rotated := rotatedLogFileName(logFile)
+
 	// remove previously rotated logfile
-	os.Remove(logFile + ".old")
+	os.Remove(rotated)
 
 	if LogFileHandle != nil {
 		err := LogFileHandle.Close()
@@ -118,9 +120,9 @@ func (l *LogrotateHandler) rotate(logFile string) {
 		}
 	}
 
-	err := os.Rename(logFile, logFile+".old")
+	err := os.Rename(logFile, rotated)
 	if err != nil {
-		log.Errorf("failed to rename logfile %s %s.old: %s", logFile, logFile, err.Error())
+		log.Errorf("failed to rename logfile %s %s: %s", logFile, rotated, err.Error())
 
 		return
 	}
@@ -128,5 +130,10 @@ func (l *LogrotateHandler) rotate(logFile string) {
 	// reopen logfile
 	l.snc.createLogger(l.snc.Config)
 
-	log.Infof("rotated logfile to %s.old", logFile)
+	log.Infof("rotated logfile to %s", rotated)
+}
+
+// rotatedLogFileName returns the name of the rotated logfile.
+func rotatedLogFileName(logFile string) string {
+	return logFile + ".old"
 }
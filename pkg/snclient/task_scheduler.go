@@ -0,0 +1,510 @@
+package snclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg/nsca"
+	"pkg/utils"
+
+	"github.com/sni/shelltoken"
+)
+
+const (
+	// SchedulerIntervalInitial sets the delay until the first run of each scheduled check
+	SchedulerIntervalInitial = 1 * time.Second
+
+	// SchedulerMinInterval sets the minimum allowed interval for scheduled checks
+	SchedulerMinInterval = 1 * time.Second
+)
+
+func init() {
+	RegisterModule(&AvailableTasks, "Scheduler", "/settings/scheduler", NewSchedulerHandler)
+}
+
+// SchedulerHandler runs checks periodically and submits the results as passive check results.
+type SchedulerHandler struct {
+	noCopy noCopy
+
+	snc *Agent
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	schedules []*ScheduledCheck
+	outputs   map[string]SchedulerOutput
+}
+
+// ScheduledCheck contains a single scheduled check.
+type ScheduledCheck struct {
+	name        string
+	command     string
+	args        []string
+	hostName    string
+	description string
+	interval    time.Duration
+	channels    []string
+}
+
+// SchedulerResult contains a single result which will be submitted.
+type SchedulerResult struct {
+	HostName           string  `json:"host_name"`
+	ServiceDescription string  `json:"service_description"`
+	Command            string  `json:"command"`
+	State              int64   `json:"state"`
+	Output             string  `json:"output"`
+	Timestamp          int64   `json:"timestamp"`
+	Duration           float64 `json:"duration"`
+}
+
+// SchedulerOutput is the interface for all passive result outputs.
+type SchedulerOutput interface {
+	Submit(ctx context.Context, results []*SchedulerResult) error
+}
+
+func NewSchedulerHandler() Module {
+	return &SchedulerHandler{}
+}
+
+func (s *SchedulerHandler) Defaults() ConfigData {
+	defaults := ConfigData{
+		"interval":  "5m",
+		"host name": "${hostname}",
+		"channel":   "nsca",
+	}
+
+	return defaults
+}
+
+func (s *SchedulerHandler) Init(snc *Agent, section *ConfigSection, conf *Config, _ *ModuleSet) error {
+	s.snc = snc
+	ctx, cancel := context.WithCancel(WithRequestSource(context.Background(), "scheduler", "", ""))
+	s.ctx = ctx
+	s.cancel = cancel
+
+	if err := s.setOutputs(section, conf); err != nil {
+		return err
+	}
+
+	return s.setSchedules(section, conf)
+}
+
+func (s *SchedulerHandler) setOutputs(section *ConfigSection, conf *Config) error {
+	s.outputs = make(map[string]SchedulerOutput)
+
+	channels, err := s.parseChannels(section)
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		outConf := conf.Section("/settings/scheduler/" + channel).Clone()
+		conf.ReplaceDefaultMacros(outConf)
+
+		var output SchedulerOutput
+		switch channel {
+		case "nsca":
+			output, err = NewSchedulerOutputNSCA(outConf)
+		case "http":
+			output, err = NewSchedulerOutputHTTP(s.snc, outConf)
+		case "spool":
+			output, err = NewSchedulerOutputSpool(outConf)
+		}
+		if err != nil {
+			return fmt.Errorf("scheduler %s: %s", channel, err.Error())
+		}
+		s.outputs[channel] = output
+	}
+
+	return nil
+}
+
+func (s *SchedulerHandler) parseChannels(section *ConfigSection) ([]string, error) {
+	channels := []string{}
+	rawChannels, _ := section.GetString("channel")
+	for _, channel := range strings.Split(rawChannels, ",") {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		switch channel {
+		case "":
+			continue
+		case "nsca", "http", "spool":
+			channels = append(channels, channel)
+		default:
+			return nil, fmt.Errorf("channel: unknown channel %s, supported are: nsca, http and spool", channel)
+		}
+	}
+
+	return channels, nil
+}
+
+func (s *SchedulerHandler) setSchedules(section *ConfigSection, conf *Config) error {
+	// work on copies, the config sections are shared and must not change on every init
+	schedConfs := map[string]*ConfigSection{}
+	for sectionName, schedConf := range conf.SectionsByPrefix("/settings/scheduler/schedules/") {
+		schedConfs[path.Base(sectionName)] = schedConf.Clone()
+	}
+
+	// merge schedule shortcuts into separate config sections
+	schedules := conf.Section("/settings/scheduler/schedules")
+	for name, command := range schedules.data {
+		schedConf, ok := schedConfs[name]
+		if !ok {
+			schedConf = NewConfigSection(conf, "/settings/scheduler/schedules/"+name)
+			schedConfs[name] = schedConf
+		}
+		if !schedConf.HasKey("command") {
+			schedConf.Set("command", command)
+		}
+	}
+
+	defaultConf := conf.Section("/settings/scheduler/schedules/default")
+	names := make([]string, 0, len(schedConfs))
+	for name := range schedConfs {
+		if name != "default" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		schedConf := schedConfs[name]
+		schedConf.MergeSection(defaultConf)
+		schedConf.MergeSection(section)
+		conf.ReplaceDefaultMacros(schedConf)
+
+		sched, err := s.newScheduledCheck(name, schedConf)
+		if err != nil {
+			return fmt.Errorf("scheduler %s: %s", name, err.Error())
+		}
+		s.schedules = append(s.schedules, sched)
+	}
+
+	return nil
+}
+
+func (s *SchedulerHandler) newScheduledCheck(name string, schedConf *ConfigSection) (*ScheduledCheck, error) {
+	sched := &ScheduledCheck{
+		name:        name,
+		description: name,
+	}
+
+	command, ok := schedConf.GetString("command")
+	if !ok || command == "" {
+		return nil, fmt.Errorf("missing command")
+	}
+	cmdLine, err := shelltoken.SplitQuotes(command, shelltoken.Whitespace)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing command: %s", err.Error())
+	}
+	if len(cmdLine) == 0 {
+		return nil, fmt.Errorf("missing command")
+	}
+	sched.command = cmdLine[0]
+	sched.args = cmdLine[1:]
+
+	if hostName, ok := schedConf.GetString("host name"); ok {
+		sched.hostName = hostName
+	}
+
+	if description, ok := schedConf.GetString("service description"); ok && description != "" {
+		sched.description = description
+	}
+
+	interval, _, err := schedConf.GetDuration("interval")
+	if err != nil {
+		return nil, fmt.Errorf("interval: %s", err.Error())
+	}
+	sched.interval = time.Duration(interval * float64(time.Second))
+	if sched.interval < SchedulerMinInterval {
+		return nil, fmt.Errorf("interval: must be at least %s", SchedulerMinInterval.String())
+	}
+
+	channels, err := s.parseChannels(schedConf)
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if _, ok := s.outputs[channel]; !ok {
+			return nil, fmt.Errorf("channel %s is not enabled in /settings/scheduler", channel)
+		}
+	}
+	sched.channels = channels
+
+	log.Tracef("[scheduler] registered %s: %s every %s", name, command, sched.interval.String())
+
+	return sched, nil
+}
+
+func (s *SchedulerHandler) Start() error {
+	for _, sched := range s.schedules {
+		s.wg.Add(1)
+		go func(sched *ScheduledCheck) {
+			defer s.snc.logPanicExit()
+			defer s.wg.Done()
+			s.mainLoop(sched)
+		}(sched)
+	}
+
+	return nil
+}
+
+func (s *SchedulerHandler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *SchedulerHandler) mainLoop(sched *ScheduledCheck) {
+	ticker := time.NewTicker(SchedulerIntervalInitial)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Tracef("[scheduler] stopping %s mainLoop", sched.name)
+
+			return
+		case <-ticker.C:
+			ticker.Reset(sched.interval)
+			s.runSchedule(sched)
+		}
+	}
+}
+
+// runSchedule executes the check and submits the result to all configured channels.
+func (s *SchedulerHandler) runSchedule(sched *ScheduledCheck) {
+	start := time.Now()
+	res := s.snc.RunCheckWithContext(s.ctx, sched.command, sched.args)
+	if s.ctx.Err() != nil {
+		// agent is shutting down, result is not meaningful
+		return
+	}
+
+	result := &SchedulerResult{
+		HostName:           sched.hostName,
+		ServiceDescription: sched.description,
+		Command:            sched.command,
+		State:              res.State,
+		Output:             string(res.BuildPluginOutput()),
+		Timestamp:          start.Unix(),
+		Duration:           time.Since(start).Seconds(),
+	}
+	log.Debugf("[scheduler] %s finished in %.3fs: %s", sched.name, result.Duration, result.Output)
+
+	for _, channel := range sched.channels {
+		err := s.outputs[channel].Submit(s.ctx, []*SchedulerResult{result})
+		if err != nil {
+			log.Warnf("[scheduler] submitting %s result via %s failed: %s", sched.name, channel, err.Error())
+		}
+	}
+}
+
+// SchedulerOutputNSCA sends results via nsca protocol.
+type SchedulerOutputNSCA struct {
+	address    string
+	encryption int
+	password   string
+	timeout    time.Duration
+	maxOutput  int
+}
+
+func NewSchedulerOutputNSCA(conf *ConfigSection) (*SchedulerOutputNSCA, error) {
+	output := &SchedulerOutputNSCA{
+		address:   "127.0.0.1:5667",
+		timeout:   time.Duration(DefaultSocketTimeout) * time.Second,
+		maxOutput: nsca.NscaMaxOutputLength,
+	}
+
+	if address, ok := conf.GetString("address"); ok && address != "" {
+		output.address = address
+	}
+	if _, _, err := net.SplitHostPort(output.address); err != nil {
+		output.address = net.JoinHostPort(output.address, "5667")
+	}
+
+	if encryption, ok := conf.GetString("encryption"); ok {
+		method, err := nsca.ParseEncryption(encryption)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: %s", err.Error())
+		}
+		output.encryption = method
+	}
+
+	if password, ok := conf.GetString("password"); ok {
+		output.password = password
+	}
+
+	timeout, ok, err := conf.GetDuration("timeout")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("timeout: %s", err.Error())
+	case ok:
+		output.timeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	maxOutput, ok, err := conf.GetInt("max output length")
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("max output length: %s", err.Error())
+	case ok && maxOutput > 0:
+		output.maxOutput = int(maxOutput)
+	}
+
+	return output, nil
+}
+
+// Submit sends all results, nsca requires a new connection for every result set.
+func (o *SchedulerOutputNSCA) Submit(ctx context.Context, results []*SchedulerResult) error {
+	dialer := &net.Dialer{Timeout: o.timeout}
+	con, err := dialer.DialContext(ctx, "tcp", o.address)
+	if err != nil {
+		return fmt.Errorf("connect to %s failed: %s", o.address, err.Error())
+	}
+	defer con.Close()
+
+	LogDebug(con.SetDeadline(time.Now().Add(o.timeout)))
+
+	initPacket, err := nsca.ReadInitPacket(con)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		state := uint16(CheckExitUnknown)
+		if res.State >= CheckExitOK && res.State <= CheckExitUnknown {
+			state = uint16(res.State)
+		}
+		packet := nsca.BuildPacket(initPacket.Timestamp, state, res.HostName, res.ServiceDescription, res.Output, o.maxOutput)
+		err = packet.Encrypt(o.encryption, initPacket.IV, []byte(o.password))
+		if err != nil {
+			return err
+		}
+		err = packet.Write(con)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SchedulerOutputHTTP posts results as json to a http endpoint.
+type SchedulerOutputHTTP struct {
+	snc         *Agent
+	url         string
+	header      map[string]string
+	httpOptions *HTTPClientOptions
+}
+
+func NewSchedulerOutputHTTP(snc *Agent, conf *ConfigSection) (*SchedulerOutputHTTP, error) {
+	conf.MergeData(DefaultHTTPClientConfig)
+	output := &SchedulerOutputHTTP{
+		snc:    snc,
+		header: map[string]string{},
+	}
+
+	url, ok := conf.GetString("url")
+	if !ok || url == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+	output.url = url
+
+	httpOptions, err := snc.buildClientHTTPOptions(conf)
+	if err != nil {
+		return nil, err
+	}
+	output.httpOptions = httpOptions
+
+	if token, ok := conf.GetString("token"); ok && token != "" {
+		output.header["Authorization"] = "Bearer " + token
+	}
+
+	return output, nil
+}
+
+func (o *SchedulerOutputHTTP) Submit(ctx context.Context, results []*SchedulerResult) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"results": results,
+	})
+	if err != nil {
+		return fmt.Errorf("json error: %s", err.Error())
+	}
+
+	return o.snc.httpPostJSON(ctx, o.httpOptions, o.url, o.header, payload)
+}
+
+// SchedulerOutputSpool writes naemon / nagios checkresult files.
+type SchedulerOutputSpool struct {
+	path string
+}
+
+func NewSchedulerOutputSpool(conf *ConfigSection) (*SchedulerOutputSpool, error) {
+	spoolPath, ok := conf.GetString("path")
+	if !ok || spoolPath == "" {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	output := &SchedulerOutputSpool{
+		path: spoolPath,
+	}
+
+	return output, nil
+}
+
+func (o *SchedulerOutputSpool) Submit(_ context.Context, results []*SchedulerResult) error {
+	if err := utils.IsFolder(o.path); err != nil {
+		return fmt.Errorf("checkresult folder: %s", err.Error())
+	}
+
+	now := time.Now()
+	data := new(bytes.Buffer)
+	fmt.Fprintf(data, "### Active Check Result File ###\nfile_time=%d\n\n", now.Unix())
+	for _, res := range results {
+		finished := float64(res.Timestamp) + res.Duration
+		fmt.Fprintf(data, "### Nagios Service Check Result ###\n")
+		fmt.Fprintf(data, "# Time: %s\n", now.Format(time.ANSIC))
+		fmt.Fprintf(data, "host_name=%s\n", res.HostName)
+		fmt.Fprintf(data, "service_description=%s\n", res.ServiceDescription)
+		fmt.Fprintf(data, "check_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\nlatency=0.0\n")
+		fmt.Fprintf(data, "start_time=%d.0\n", res.Timestamp)
+		fmt.Fprintf(data, "finish_time=%.3f\n", finished)
+		fmt.Fprintf(data, "early_timeout=0\nexited_ok=1\n")
+		fmt.Fprintf(data, "return_code=%d\n", res.State)
+		fmt.Fprintf(data, "output=%s\n\n", strings.ReplaceAll(strings.ReplaceAll(res.Output, `\`, `\\`), "\n", `\n`))
+	}
+
+	// naemon only picks up files starting with a c and having 6 characters, followed by an .ok file
+	random := make([]byte, 3)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to create random file name: %s", err.Error())
+	}
+	fileName := filepath.Join(o.path, "c"+hex.EncodeToString(random))
+
+	// write into temporary file first and rename afterwards, so the core never sees partial files
+	tmpFile := fileName + ".tmp"
+	if err := os.WriteFile(tmpFile, data.Bytes(), 0o644); err != nil { //nolint:gosec // the core may run as different user and must read the results
+		return fmt.Errorf("write %s failed: %s", tmpFile, err.Error())
+	}
+	if err := os.Rename(tmpFile, fileName); err != nil {
+		os.Remove(tmpFile)
+
+		return fmt.Errorf("rename %s failed: %s", tmpFile, err.Error())
+	}
+	if err := os.WriteFile(fileName+".ok", []byte{}, 0o644); err != nil { //nolint:gosec // same as the result file
+		return fmt.Errorf("write %s.ok failed: %s", fileName, err.Error())
+	}
+
+	return nil
+}
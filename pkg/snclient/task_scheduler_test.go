@@ -0,0 +1,175 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"pkg/nsca"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerSubmit(t *testing.T) {
+	// fake nsca server
+	nscaListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoErrorf(t, err, "nsca listener started")
+	defer nscaListener.Close()
+
+	iv := []byte(strings.Repeat("0123456789abcdef", nsca.NscaIVLength/16))
+	nscaResults := make(chan *nsca.Packet, 5)
+	go func() {
+		con, err2 := nscaListener.Accept()
+		if err2 != nil {
+			return
+		}
+		defer con.Close()
+		initPacket := &nsca.InitPacket{IV: iv, Timestamp: uint32(time.Now().Unix())}
+		if initPacket.Write(con) != nil {
+			return
+		}
+		packet, err2 := nsca.ReadPacket(con, nsca.NscaMaxOutputLength)
+		if err2 != nil {
+			return
+		}
+		LogError(packet.Encrypt(nsca.EncryptionXOR, iv, []byte("test")))
+		nscaResults <- packet
+	}()
+
+	// fake http receiver
+	httpResults := make(chan []*SchedulerResult, 5)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		data := struct {
+			Results []*SchedulerResult `json:"results"`
+		}{}
+		LogError(json.NewDecoder(req.Body).Decode(&data))
+		httpResults <- data.Results
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer httpServer.Close()
+
+	spoolDir := t.TempDir()
+
+	config := fmt.Sprintf(`
+[/modules]
+Scheduler = enabled
+
+[/settings/scheduler]
+channel = nsca, http, spool
+host name = testhost
+
+[/settings/scheduler/nsca]
+address = %s
+encryption = xor
+password = test
+
+[/settings/scheduler/http]
+url = %s
+
+[/settings/scheduler/spool]
+path = %s
+
+[/settings/scheduler/schedules]
+version = check_snclient_version
+`, nscaListener.Addr().String(), httpServer.URL, spoolDir)
+
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	select {
+	case packet := <-nscaResults:
+		require.NoErrorf(t, packet.Verify(), "nsca packet verified")
+		host, service, output := packet.Data()
+		assert.Equalf(t, "testhost", host, "nsca host name")
+		assert.Equalf(t, "version", service, "nsca service description")
+		assert.Containsf(t, output, "SNClient", "nsca output")
+		assert.Equalf(t, uint16(0), packet.ReturnCode(), "nsca return code")
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no nsca result received")
+	}
+
+	select {
+	case results := <-httpResults:
+		require.Lenf(t, results, 1, "got one http result")
+		assert.Equalf(t, "testhost", results[0].HostName, "http host name")
+		assert.Equalf(t, "version", results[0].ServiceDescription, "http service description")
+		assert.Equalf(t, "check_snclient_version", results[0].Command, "http command")
+		assert.Equalf(t, CheckExitOK, results[0].State, "http state")
+		assert.Containsf(t, results[0].Output, "SNClient", "http output")
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no http result received")
+	}
+
+	var okFiles []string
+	for i := 0; i < 100; i++ {
+		okFiles, _ = filepath.Glob(filepath.Join(spoolDir, "c*.ok"))
+		if len(okFiles) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.Lenf(t, okFiles, 1, "checkresult file written")
+
+	content, err := os.ReadFile(strings.TrimSuffix(okFiles[0], ".ok"))
+	require.NoErrorf(t, err, "checkresult file readable")
+	assert.Containsf(t, string(content), "host_name=testhost\n", "checkresult host name")
+	assert.Containsf(t, string(content), "service_description=version\n", "checkresult service description")
+	assert.Containsf(t, string(content), "return_code=0\n", "checkresult return code")
+	assert.Containsf(t, string(content), "output=SNClient", "checkresult output")
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(strings.TrimSuffix(okFiles[0], ".ok"))
+		require.NoErrorf(t, err, "checkresult file exists")
+		assert.Equalf(t, os.FileMode(0o044), info.Mode().Perm()&0o044, "checkresult file is readable by the core")
+	}
+
+	assert.Emptyf(t, snc.Config.SectionsByPrefix("/settings/scheduler/schedules/version"), "shortcuts do not change the config")
+}
+
+func TestSchedulerConfigErrors(t *testing.T) {
+	conf := NewConfig(true)
+	section := conf.Section("/settings/scheduler")
+	section.Set("channel", "carrier pigeon")
+
+	handler := NewSchedulerHandler()
+	err := handler.Init(&Agent{}, section, conf, nil)
+	require.ErrorContainsf(t, err, "unknown channel", "invalid channel is rejected")
+
+	conf = NewConfig(true)
+	section = conf.Section("/settings/scheduler")
+	section.Set("channel", "spool")
+	conf.Section("/settings/scheduler/spool").Set("path", t.TempDir())
+	conf.Section("/settings/scheduler/schedules/test").Set("interval", "5m")
+
+	handler = NewSchedulerHandler()
+	err = handler.Init(&Agent{}, section, conf, nil)
+	require.ErrorContainsf(t, err, "missing command", "schedule without command is rejected")
+}
+
+func TestSchedulerNSCAConnectError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoErrorf(t, err, "listener started")
+	addr := listener.Addr().String()
+	listener.Close()
+
+	conf := NewConfig(true)
+	section := conf.Section("/settings/scheduler/nsca")
+	section.Set("address", addr)
+	section.Set("timeout", "1")
+
+	output, err := NewSchedulerOutputNSCA(section)
+	require.NoErrorf(t, err, "nsca output created")
+
+	err = output.Submit(context.Background(), []*SchedulerResult{{HostName: "test", Output: "test"}})
+	require.Errorf(t, err, "submit fails without server")
+}
@@ -3,6 +3,7 @@ package snclient
 import (
 	"archive/tar"
 	"archive/zip"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
@@ -18,6 +19,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -59,16 +61,24 @@ type UpdateHandler struct {
 	updateHours      []UpdateHours
 	updateDays       []UpdateDays
 
+	healthGateTimeout float64
+	canaryPercent     int64
+	canaryDelay       float64
+
 	httpOptions  *HTTPClientOptions
+	verifier     *UpdateVerifier
 	lastUpdate   *time.Time
 	lastModified map[string]*time.Time
+	rolloutLock  sync.Mutex // protects the rollout state file
 }
 
 type updatesAvailable struct {
-	channel string
-	url     string
-	version string
-	header  map[string]string
+	channel   string
+	url       string
+	version   string
+	header    map[string]string
+	manifest  string     // url of the sha256 manifest
+	published *time.Time // release date, used for canary rollouts
 }
 
 func NewUpdateHandler() Module {
@@ -79,13 +89,16 @@ func NewUpdateHandler() Module {
 
 func (u *UpdateHandler) Defaults() ConfigData {
 	defaults := ConfigData{
-		"automatic updates": "disabled",
-		"automatic restart": "disabled",
-		"channel":           "stable",
-		"pre release":       "false",
-		"update interval":   "1h",
-		"update hours":      "0-24",
-		"update days":       "mon-sun",
+		"automatic updates":   "disabled",
+		"automatic restart":   "disabled",
+		"channel":             "stable",
+		"pre release":         "false",
+		"update interval":     "1h",
+		"update hours":        "0-24",
+		"update days":         "mon-sun",
+		"health gate timeout": "60s",
+		"canary percent":      "100",
+		"canary delay":        "1d",
 	}
 
 	defaults.Merge(DefaultHTTPClientConfig)
@@ -145,6 +158,41 @@ func (u *UpdateHandler) setConfig(section *ConfigSection) error {
 		u.updateInterval = updateInterval
 	}
 
+	healthGateTimeout, ok, err := section.GetDuration("health gate timeout")
+	switch {
+	case err != nil:
+		return fmt.Errorf("health gate timeout: %s", err.Error())
+	case ok:
+		u.healthGateTimeout = healthGateTimeout
+	}
+
+	canaryPercent, ok, err := section.GetInt("canary percent")
+	switch {
+	case err != nil:
+		return fmt.Errorf("canary percent: %s", err.Error())
+	case ok:
+		if canaryPercent < 0 || canaryPercent > 100 {
+			return fmt.Errorf("canary percent: must be between 0 and 100")
+		}
+		u.canaryPercent = canaryPercent
+	}
+
+	canaryDelay, ok, err := section.GetDuration("canary delay")
+	switch {
+	case err != nil:
+		return fmt.Errorf("canary delay: %s", err.Error())
+	case ok:
+		u.canaryDelay = canaryDelay
+	}
+
+	if publicKey, ok := section.GetString("public key"); ok {
+		verifier, err := NewUpdateVerifier(publicKey)
+		if err != nil {
+			return fmt.Errorf("public key: %s", err.Error())
+		}
+		u.verifier = verifier
+	}
+
 	if updateHours, ok := section.GetString("update hours"); ok {
 		hours, err := NewUpdateHours(updateHours)
 		if err != nil {
@@ -165,6 +213,7 @@ func (u *UpdateHandler) setConfig(section *ConfigSection) error {
 }
 
 func (u *UpdateHandler) Start() error {
+	u.startHealthGate()
 	go u.mainLoop()
 
 	return nil
@@ -247,6 +296,9 @@ func (u *UpdateHandler) CheckUpdates(force, download, restarts, preRelease bool,
 	// check for updates unless file specified
 	if updateFile == "" {
 		available := u.fetchAvailableUpdates(preRelease, channel)
+		if !force {
+			available = u.filterRollout(available, buildRolloutStateFile(GlobalMacros["exe-full"]))
+		}
 		if len(available) == 0 {
 			return "", nil
 		}
@@ -261,15 +313,28 @@ func (u *UpdateHandler) CheckUpdates(force, download, restarts, preRelease bool,
 		}
 	}
 
-	return u.finishUpdateCheck(best, restarts)
+	return u.finishUpdateCheck(best, restarts, force)
 }
 
-func (u *UpdateHandler) finishUpdateCheck(best *updatesAvailable, restarts bool) (version string, err error) {
+func (u *UpdateHandler) finishUpdateCheck(best *updatesAvailable, restarts, force bool) (version string, err error) {
 	updateFile, err := u.downloadUpdate(best)
 	if err != nil {
 		return "", err
 	}
 
+	checksum, err := fileSha256(updateFile)
+	if err != nil {
+		LogError(os.Remove(updateFile))
+
+		return "", err
+	}
+	if !force && u.failedBefore(checksum, buildRolloutStateFile(GlobalMacros["exe-full"])) {
+		log.Debugf("[update] skipping update from %s, it failed the health gate before", best.url)
+		LogError(os.Remove(updateFile))
+
+		return "", nil
+	}
+
 	newVersion, err := u.verifyUpdate(updateFile)
 	if err != nil {
 		LogError(os.Remove(updateFile))
@@ -281,6 +346,10 @@ func (u *UpdateHandler) finishUpdateCheck(best *updatesAvailable, restarts bool)
 		log.Warnf("[update] downgrading to %s", newVersion)
 	}
 
+	if err = u.keepPrevious(newVersion, checksum); err != nil {
+		log.Warnf("[update] %s", err.Error())
+	}
+
 	if restarts {
 		log.Infof("[update] update successful from %s to %s, restarting into new version", u.snc.Version(), newVersion)
 		err = u.ApplyRestart(updateFile)
@@ -375,6 +444,7 @@ func (u *UpdateHandler) fetchAvailableUpdates(preRelease bool, channel string) (
 }
 
 func (u *UpdateHandler) checkUpdate(url string, preRelease bool, channel string) (updates []updatesAvailable, err error) {
+	manifest := ""
 	if ok, _ := regexp.MatchString(`^https://api\.github\.com/repos/.*/releases`, url); ok {
 		updates, err = u.checkUpdateGithubRelease(url, preRelease)
 	} else if ok, _ := regexp.MatchString(`^https://api\.github\.com/repos/.*/actions/artifacts`, url); ok {
@@ -383,6 +453,7 @@ func (u *UpdateHandler) checkUpdate(url string, preRelease bool, channel string)
 		updates, err = u.checkUpdateFile(url)
 	} else {
 		updates, err = u.checkUpdateCustomURL(url)
+		manifest, _ = u.snc.Config.Section("/settings/updates/channel/" + channel).GetString("sha256 manifest")
 	}
 
 	if err != nil {
@@ -392,6 +463,7 @@ func (u *UpdateHandler) checkUpdate(url string, preRelease bool, channel string)
 	log.Debugf("found %d versions in %s channel:", len(updates), channel)
 	for i, u := range updates {
 		updates[i].channel = channel
+		updates[i].manifest = manifest
 		log.Debugf("  - %s (from %s)", u.version, u.url)
 	}
 
@@ -417,6 +489,7 @@ func (u *UpdateHandler) checkUpdateGithubRelease(url string, preRelease bool) (u
 		Draft      bool          `json:"draft"`
 		PreRelease bool          `json:"prerelease"`
 		TagName    string        `json:"tag_name"`
+		Published  *time.Time    `json:"published_at"`
 		Assets     []GithubAsset `json:"assets"`
 	}
 
@@ -444,7 +517,7 @@ func (u *UpdateHandler) checkUpdateGithubRelease(url string, preRelease bool) (u
 		foundOne := false
 		for _, asset := range release.Assets {
 			if u.isUsableGithubAsset(strings.ToLower(asset.Name)) {
-				updates = append(updates, updatesAvailable{url: asset.URL, version: release.TagName})
+				updates = append(updates, updatesAvailable{url: asset.URL, version: release.TagName, published: release.Published})
 				foundOne = true
 			}
 		}
@@ -459,6 +532,10 @@ func (u *UpdateHandler) checkUpdateGithubRelease(url string, preRelease bool) (u
 // check available updates from github actions page
 func (u *UpdateHandler) checkUpdateGithubActions(url, channel string) (updates []updatesAvailable, err error) {
 	log.Tracef("[update] checking github action url at: %s", url)
+	// artifacts are zipped by github, so there is no file a detached signature could be created for
+	if u.verifier.Enabled() {
+		return nil, fmt.Errorf("github action artifacts cannot be signed and are not supported with a public key, skipping")
+	}
 	conf := u.snc.Config.Section("/settings/updates/channel/" + channel)
 	token, ok := conf.GetString("github token")
 	if !ok || token == "" || token == "<GITHUB-TOKEN>" { //nolint:gosec // false positive token, this is no token
@@ -475,8 +552,9 @@ func (u *UpdateHandler) checkUpdateGithubActions(url, channel string) (updates [
 	defer resp.Body.Close()
 
 	type GithubArtifact struct {
-		URL  string `json:"archive_download_url"`
-		Name string `json:"name"`
+		URL     string     `json:"archive_download_url"`
+		Name    string     `json:"name"`
+		Created *time.Time `json:"created_at"`
 	}
 
 	type GithubActions struct {
@@ -501,7 +579,7 @@ func (u *UpdateHandler) checkUpdateGithubActions(url, channel string) (updates [
 			matches := reActionVersion.FindStringSubmatch(artifact.Name)
 			if len(matches) > 1 {
 				version := matches[1]
-				updates = append(updates, updatesAvailable{url: artifact.URL, version: version, header: header})
+				updates = append(updates, updatesAvailable{url: artifact.URL, version: version, header: header, published: artifact.Created})
 			}
 		}
 	}
@@ -532,10 +610,16 @@ func (u *UpdateHandler) checkUpdateCustomURL(url string) (updates []updatesAvail
 		return nil, fmt.Errorf("stat: %s", err.Error())
 	}
 
+	// last modified date is used as release date for canary rollouts
+	var published *time.Time
+	if modifiedTime, err2 := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified")); err2 == nil {
+		published = &modifiedTime
+	}
+
 	if resp.ContentLength > 0 && resp.ContentLength != stat.Size() {
 		log.Tracef("[update] content size differs %s: %d vs. %s: %d", url, resp.ContentLength, executable, stat.Size())
 
-		return []updatesAvailable{{url: url, version: ""}}, nil
+		return []updatesAvailable{{url: url, version: "", published: published}}, nil
 	}
 
 	lastModified := resp.Header.Get("Last-Modified")
@@ -550,7 +634,7 @@ func (u *UpdateHandler) checkUpdateCustomURL(url string) (updates []updatesAvail
 				log.Tracef("[update] old %s", modifiedTime.UTC().String())
 				log.Tracef("[update] new %s", u.lastUpdate.UTC().String())
 
-				return []updatesAvailable{{url: url, version: ""}}, nil
+				return []updatesAvailable{{url: url, version: "", published: published}}, nil
 			}
 			u.lastModified[url] = &modifiedTime
 		}
@@ -570,6 +654,12 @@ func (u *UpdateHandler) checkUpdateFile(url string) (updates []updatesAvailable,
 		return nil, fmt.Errorf("could not find update file: %s", err.Error())
 	}
 
+	// verify before extracting and running the binary
+	err = u.verifyDownload(&updatesAvailable{url: url}, localPath)
+	if err != nil {
+		return nil, err
+	}
+
 	// copy to tmp location
 	tempFile, err := os.CreateTemp("", "snclient-tmpupdate")
 	if err != nil {
@@ -636,6 +726,13 @@ func (u *UpdateHandler) downloadUpdate(update *updatesAvailable) (binPath string
 	}
 	saveFile.Close()
 
+	err = u.verifyDownload(update, updateFile)
+	if err != nil {
+		LogError(os.Remove(updateFile))
+
+		return "", err
+	}
+
 	err = u.extractUpdate(updateFile)
 	if err != nil {
 		return "", err
@@ -644,6 +741,92 @@ func (u *UpdateHandler) downloadUpdate(update *updatesAvailable) (binPath string
 	return updateFile, nil
 }
 
+// verifyDownload checks the sha256 manifest and the detached signature of the update file.
+// Updates are refused if a public key is configured and the signature is missing or invalid.
+func (u *UpdateHandler) verifyDownload(update *updatesAvailable, fileName string) error {
+	err := u.verifyDownloadFile(update, fileName)
+	if err != nil {
+		log.Errorf("[update] refusing update from %s: %s", update.url, err.Error())
+
+		return fmt.Errorf("update verification failed for %s: %s", update.url, err.Error())
+	}
+
+	return nil
+}
+
+func (u *UpdateHandler) verifyDownloadFile(update *updatesAvailable, fileName string) error {
+	if update.manifest != "" {
+		manifest, err := u.fetchSmallFile(update.manifest, update.header)
+		if err != nil {
+			return fmt.Errorf("fetching sha256 manifest failed: %s", err.Error())
+		}
+
+		if u.verifier.Enabled() {
+			signature, err2 := u.fetchSmallFile(update.manifest+UpdateSignatureSuffix, update.header)
+			if err2 != nil {
+				return fmt.Errorf("sha256 manifest is not signed: %s", err2.Error())
+			}
+			if err2 = u.verifier.Verify(bytes.NewReader(manifest), signature); err2 != nil {
+				return fmt.Errorf("sha256 manifest %s: %s", update.manifest, err2.Error())
+			}
+		}
+
+		expected, err := parseSha256Manifest(manifest, update.url)
+		if err != nil {
+			return err
+		}
+
+		err = verifySha256(fileName, expected)
+		if err != nil {
+			return err
+		}
+		log.Debugf("[update] sha256 checksum verified: %s", expected)
+
+		return nil
+	}
+
+	if !u.verifier.Enabled() {
+		log.Debugf("[update] no public key configured, skipping signature verification")
+
+		return nil
+	}
+
+	signature, err := u.fetchSmallFile(update.url+UpdateSignatureSuffix, update.header)
+	if err != nil {
+		return fmt.Errorf("update is not signed: %s", err.Error())
+	}
+
+	return u.verifier.VerifyFile(fileName, signature)
+}
+
+// fetchSmallFile returns the content of signatures and manifests from local files or http urls
+func (u *UpdateHandler) fetchSmallFile(url string, header map[string]string) ([]byte, error) {
+	var src io.Reader
+	if strings.HasPrefix(url, "file://") {
+		localPath := strings.TrimPrefix(url, "file://")
+		file, err := os.Open(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("open failed %s: %s", localPath, err.Error())
+		}
+		defer file.Close()
+		src = file
+	} else {
+		resp, err := u.snc.httpDo(*u.ctx, u.httpOptions, "GET", url, header)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		src = resp.Body
+	}
+
+	data, err := io.ReadAll(io.LimitReader(src, updateSignatureMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("read: %s", err.Error())
+	}
+
+	return data, nil
+}
+
 func (u *UpdateHandler) extractUpdate(updateFile string) (err error) {
 	executable := GlobalMacros["exe-full"]
 
@@ -1083,6 +1266,11 @@ func (u *UpdateHandler) isUsableGithubAsset(name string) bool {
 		}
 	}
 
+	// signatures are fetched along with the update file
+	if strings.HasSuffix(name, UpdateSignatureSuffix) {
+		return false
+	}
+
 	for _, arch := range archVariants {
 		for _, os := range osVariants {
 			lookFor := strings.ToLower(fmt.Sprintf("%s-%s", os, arch))
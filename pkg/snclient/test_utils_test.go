@@ -31,10 +31,13 @@ func init() {
 // Starts a full Agent from given config
 func StartTestAgent(t *testing.T, config string) *Agent {
 	t.Helper()
-	testDefaultConfig := `
+	testDefaultConfig := fmt.Sprintf(`
+[/paths]
+state-file = %s
+
 [/modules]
 WEBServer = disabled
-`
+`, filepath.Join(t.TempDir(), "snclient.state"))
 	tmpConfig, err := os.CreateTemp("", "testconfig")
 	require.NoErrorf(t, err, "tmp config created")
 	_, err = tmpConfig.WriteString(testDefaultConfig)
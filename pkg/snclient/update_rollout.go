@@ -0,0 +1,427 @@
+package snclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"pkg/utils"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// interval between health gate checks after an update
+	UpdateHealthGateInterval = 1 * time.Second
+
+	// UpdateHealthGateMaxStarts sets how often an updated version may start without passing the health gate
+	UpdateHealthGateMaxStarts = 1
+)
+
+// updateRolloutState is stored next to the executable and tracks the health gate after updates.
+type updateRolloutState struct {
+	Pending         bool             `json:"pending"`                    // updated version has not yet passed the health gate
+	Version         string           `json:"version,omitempty"`          // version which has to pass the health gate
+	Checksum        string           `json:"checksum,omitempty"`         // sha256 checksum of the update which has to pass the health gate
+	Starts          int              `json:"starts,omitempty"`           // number of starts of the pending version
+	Failed          []string         `json:"failed,omitempty"`           // versions which failed the health gate, they won't be installed automatically
+	FailedChecksums []string         `json:"failed_checksums,omitempty"` // sha256 checksums of updates which failed the health gate
+	FirstSeen       map[string]int64 `json:"first_seen,omitempty"`       // unix timestamps when updates without release date have been seen first
+}
+
+// buildPreviousFile returns the path of the previous binary which is kept for rollbacks
+func buildPreviousFile(executable string) string {
+	return strings.TrimSuffix(executable, GlobalMacros["file-ext"]) + ".previous" + GlobalMacros["file-ext"]
+}
+
+// buildRolloutStateFile returns the path of the rollout state file
+func buildRolloutStateFile(executable string) string {
+	return strings.TrimSuffix(executable, GlobalMacros["file-ext"]) + ".rollout.json"
+}
+
+// readRolloutState reads the rollout state file, a missing file returns an empty state
+func readRolloutState(file string) (*updateRolloutState, error) {
+	state := &updateRolloutState{}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+
+		return nil, fmt.Errorf("failed to read rollout state: %s", err.Error())
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse rollout state %s: %s", file, err.Error())
+	}
+
+	return state, nil
+}
+
+// save writes the rollout state file atomically
+func (s *updateRolloutState) save(file string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("json: %s", err.Error())
+	}
+
+	tmpFile := file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write rollout state: %s", err.Error())
+	}
+
+	if err := os.Rename(tmpFile, file); err != nil {
+		return fmt.Errorf("failed to write rollout state: %s", err.Error())
+	}
+
+	return nil
+}
+
+// saveRolloutState writes the health gate result but keeps first seen times stored meanwhile
+func (u *UpdateHandler) saveRolloutState(state *updateRolloutState, stateFile string) error {
+	u.rolloutLock.Lock()
+	defer u.rolloutLock.Unlock()
+
+	current, err := readRolloutState(stateFile)
+	if err == nil {
+		state.FirstSeen = current.FirstSeen
+	}
+
+	return state.save(stateFile)
+}
+
+// fail records the pending update as failed, so it won't be installed again automatically
+func (s *updateRolloutState) fail() {
+	s.Pending = false
+	s.Starts = 0
+	if s.Version != "" && !slices.Contains(s.Failed, s.Version) {
+		s.Failed = append(s.Failed, s.Version)
+	}
+	if s.Checksum != "" && !slices.Contains(s.FailedChecksums, s.Checksum) {
+		s.FailedChecksums = append(s.FailedChecksums, s.Checksum)
+	}
+}
+
+// keepPrevious saves a copy of the current binary and arms the health gate for the new version
+func (u *UpdateHandler) keepPrevious(newVersion, checksum string) error {
+	executable := GlobalMacros["exe-full"]
+	previous := buildPreviousFile(executable)
+	log.Tracef("[update] keeping previous binary in %s", previous)
+	if err := utils.CopyFile(executable, previous); err != nil {
+		return fmt.Errorf("keeping previous binary failed: %s", err.Error())
+	}
+	LogError(utils.CopyFileMode(executable, previous))
+
+	stateFile := buildRolloutStateFile(executable)
+	state, err := readRolloutState(stateFile)
+	if err != nil {
+		log.Warnf("[update] %s", err.Error())
+		state = &updateRolloutState{}
+	}
+	state.Pending = u.healthGateTimeout > 0
+	state.Version = newVersion
+	state.Checksum = checksum
+	state.Starts = 0
+
+	return state.save(stateFile)
+}
+
+// checkPendingUpdate counts the starts of an updated version which has not passed the health gate yet. Since the
+// health gate runs inside the new version, a version which crashes during startup never reaches it. Such versions
+// are detected on the next start and the previous binary is restored.
+func (snc *Agent) checkPendingUpdate() {
+	executable := GlobalMacros["exe-full"]
+	if strings.Contains(executable, ".update") {
+		// update binary only moves itself in place
+		return
+	}
+
+	rollback, err := countPendingStart(buildRolloutStateFile(executable), snc.Version())
+	if err != nil {
+		log.Warnf("[update] %s", err.Error())
+
+		return
+	}
+	if !rollback {
+		return
+	}
+
+	handler := &UpdateHandler{snc: snc}
+	if err = handler.rollback(); err != nil {
+		log.Errorf("[update] rollback failed: %s", err.Error())
+	}
+}
+
+// countPendingStart increases the start counter if given version has not passed the health gate yet and
+// returns true if the version should be rolled back.
+func countPendingStart(stateFile, version string) (rollback bool, err error) {
+	state, err := readRolloutState(stateFile)
+	if err != nil {
+		return false, err
+	}
+
+	if !state.Pending || state.Version != version {
+		return false, nil
+	}
+
+	state.Starts++
+	if state.Starts <= UpdateHealthGateMaxStarts {
+		return false, state.save(stateFile)
+	}
+
+	log.Errorf("[update] version %s has been started %d times without passing the health gate", state.Version, state.Starts)
+	state.fail()
+
+	return true, state.save(stateFile)
+}
+
+// startHealthGate verifies the agent after an update and rolls back to the previous binary if it fails
+func (u *UpdateHandler) startHealthGate() {
+	stateFile := buildRolloutStateFile(GlobalMacros["exe-full"])
+	state, err := readRolloutState(stateFile)
+	if err != nil {
+		log.Warnf("[update] %s", err.Error())
+
+		return
+	}
+
+	if !state.Pending {
+		return
+	}
+
+	if state.Version != u.snc.Version() || u.healthGateTimeout <= 0 {
+		log.Debugf("[update] skipping health gate for version %s (running %s)", state.Version, u.snc.Version())
+		state.Pending = false
+		LogError(state.save(stateFile))
+
+		return
+	}
+
+	go func() {
+		defer u.snc.logPanicExit()
+
+		u.runHealthGate(state, stateFile)
+	}()
+}
+
+func (u *UpdateHandler) runHealthGate(state *updateRolloutState, stateFile string) {
+	log.Infof("[update] running health gate for version %s (timeout %s)", state.Version, time.Duration(u.healthGateTimeout*float64(time.Second)))
+
+	deadline := time.Now().Add(time.Duration(u.healthGateTimeout * float64(time.Second)))
+	ticker := time.NewTicker(UpdateHealthGateInterval)
+	defer ticker.Stop()
+
+	err := fmt.Errorf("timeout")
+	for time.Now().Before(deadline) {
+		if err = u.healthCheck(*u.ctx); err == nil {
+			log.Infof("[update] version %s passed the health gate", state.Version)
+			state.Pending = false
+			state.Starts = 0
+			LogError(u.saveRolloutState(state, stateFile))
+
+			return
+		}
+		log.Tracef("[update] health gate: %s", err.Error())
+
+		select {
+		case <-(*u.ctx).Done():
+			// agent is stopping or reloading, the gate will be checked again on next start
+			return
+		case <-ticker.C:
+		}
+	}
+
+	log.Errorf("[update] version %s failed the health gate: %s", state.Version, err.Error())
+	state.fail()
+	LogError(u.saveRolloutState(state, stateFile))
+
+	if err = u.rollback(); err != nil {
+		log.Errorf("[update] rollback failed: %s", err.Error())
+	}
+}
+
+// healthCheck returns an error unless all listeners are started and accept connections and the agent answers a self check
+func (u *UpdateHandler) healthCheck(ctx context.Context) error {
+	if !u.snc.IsRunning() {
+		return fmt.Errorf("agent is not running")
+	}
+
+	if failed := u.snc.Listeners.Failed(); len(failed) > 0 {
+		return fmt.Errorf("listener failed to start: %s", strings.Join(failed, ", "))
+	}
+
+	checked := map[*Listener]bool{}
+	for name, module := range u.snc.Listeners.Modules() {
+		handler, ok := module.(RequestHandler)
+		if !ok {
+			continue
+		}
+		listener := handler.Listener()
+		if listener == nil || checked[listener] {
+			continue
+		}
+		checked[listener] = true
+
+		if err := u.dialListener(ctx, listener); err != nil {
+			return fmt.Errorf("listener %s: %s", name, err.Error())
+		}
+	}
+
+	res := u.snc.RunCheckWithContext(ctx, "check_snclient_version", []string{})
+	if res.State != CheckExitOK {
+		return fmt.Errorf("self check failed: %s", res.Output)
+	}
+
+	return nil
+}
+
+// dialListener connects to the listener to verify it accepts connections
+func (u *UpdateHandler) dialListener(ctx context.Context, listener *Listener) error {
+	listen := listener.listen
+	if listen == nil {
+		return fmt.Errorf("not started")
+	}
+
+	addr, ok := listen.Addr().(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("unsupported address: %s", listen.Addr().String())
+	}
+
+	// connect to localhost when listening on all interfaces
+	host := addr.IP
+	if host.IsUnspecified() {
+		host = net.IPv4(127, 0, 0, 1)
+	}
+
+	dialer := net.Dialer{Timeout: DefaultSocketTimeout * time.Second}
+	con, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host.String(), fmt.Sprintf("%d", addr.Port)))
+	if err != nil {
+		return fmt.Errorf("connect failed: %s", err.Error())
+	}
+	con.Close()
+
+	return nil
+}
+
+// rollback restores the previous binary and restarts into it
+func (u *UpdateHandler) rollback() error {
+	executable := GlobalMacros["exe-full"]
+	previous := buildPreviousFile(executable)
+	if _, err := os.Stat(previous); err != nil {
+		return fmt.Errorf("no previous binary available: %s", err.Error())
+	}
+
+	// restart through the usual update procedure, so it works for windows services as well
+	updateFile := u.snc.buildUpdateFile(executable)
+	if err := utils.CopyFile(previous, updateFile); err != nil {
+		return fmt.Errorf("copy previous binary failed: %s", err.Error())
+	}
+	LogError(utils.CopyFileMode(executable, updateFile))
+
+	log.Warnf("[update] rolling back to previous binary %s", previous)
+
+	return u.ApplyRestart(updateFile)
+}
+
+// failedBefore returns true if the downloaded update file failed the health gate before. Custom url updates have
+// no version until they are downloaded, so failed updates are recognized by their checksum.
+func (u *UpdateHandler) failedBefore(checksum, stateFile string) bool {
+	state, err := readRolloutState(stateFile)
+	if err != nil {
+		log.Warnf("[update] %s", err.Error())
+
+		return false
+	}
+
+	return slices.Contains(state.FailedChecksums, checksum)
+}
+
+// filterRollout removes versions which failed the health gate and versions not yet released to this host by the canary settings
+func (u *UpdateHandler) filterRollout(updates []updatesAvailable, stateFile string) []updatesAvailable {
+	u.rolloutLock.Lock()
+	defer u.rolloutLock.Unlock()
+
+	state, err := readRolloutState(stateFile)
+	if err != nil {
+		log.Warnf("[update] %s", err.Error())
+		state = &updateRolloutState{}
+	}
+
+	now := time.Now()
+	seen := len(state.FirstSeen)
+	filtered := []updatesAvailable{}
+	for i := range updates {
+		update := &updates[i]
+		if update.version != "" && slices.Contains(state.Failed, update.version) {
+			log.Debugf("[update] skipping version %s, it failed the health gate before", update.version)
+
+			continue
+		}
+
+		if u.inCanaryDelay(update, state, now) {
+			log.Debugf("[update] skipping version %s, host is not in the canary group (%d%%) until %s",
+				update.version, u.canaryPercent, state.releaseTime(update, now).Add(time.Duration(u.canaryDelay*float64(time.Second))).Format(time.RFC3339))
+
+			continue
+		}
+
+		filtered = append(filtered, *update)
+	}
+
+	if len(state.FirstSeen) != seen {
+		LogError(state.save(stateFile))
+	}
+
+	return filtered
+}
+
+// inCanaryDelay returns true if the update is not yet available for this host
+func (u *UpdateHandler) inCanaryDelay(update *updatesAvailable, state *updateRolloutState, now time.Time) bool {
+	if u.canaryPercent >= 100 {
+		return false
+	}
+
+	if hostCanaryBucket() < u.canaryPercent {
+		return false
+	}
+
+	return now.Before(state.releaseTime(update, now).Add(time.Duration(u.canaryDelay * float64(time.Second))))
+}
+
+// releaseTime returns the publishing date of an update or the time it has been seen first
+func (s *updateRolloutState) releaseTime(update *updatesAvailable, now time.Time) time.Time {
+	if update.published != nil {
+		return *update.published
+	}
+
+	key := update.version + " " + update.url
+	if seen, ok := s.FirstSeen[key]; ok {
+		return time.Unix(seen, 0)
+	}
+
+	if s.FirstSeen == nil {
+		s.FirstSeen = make(map[string]int64)
+	}
+	s.FirstSeen[key] = now.Unix()
+
+	return now
+}
+
+// hostCanaryBucket returns a stable number from 0-99 based on the hostname
+func hostCanaryBucket() int64 {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Debugf("failed to get hostname: %s", err.Error())
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(strings.ToLower(hostname)))
+
+	return int64(hash.Sum32() % 100)
+}
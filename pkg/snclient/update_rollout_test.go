@@ -0,0 +1,187 @@
+package snclient
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateRolloutState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "snclient.rollout.json")
+
+	state, err := readRolloutState(stateFile)
+	require.NoErrorf(t, err, "missing state file is no error")
+	assert.Equalf(t, &updateRolloutState{}, state, "empty state")
+
+	state.Pending = true
+	state.Version = "v0.99"
+	state.Failed = []string{"v0.98"}
+	require.NoError(t, state.save(stateFile))
+
+	state, err = readRolloutState(stateFile)
+	require.NoError(t, err)
+	assert.Equalf(t, &updateRolloutState{Pending: true, Version: "v0.99", Failed: []string{"v0.98"}}, state, "state read back")
+
+	executable := "/usr/bin/snclient" + GlobalMacros["file-ext"]
+	assert.Equalf(t, "/usr/bin/snclient.previous"+GlobalMacros["file-ext"], buildPreviousFile(executable), "previous file")
+	assert.Equalf(t, "/usr/bin/snclient.rollout.json", buildRolloutStateFile(executable), "state file")
+}
+
+func TestUpdateRolloutFilter(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "snclient.rollout.json")
+	state := &updateRolloutState{Failed: []string{"v0.98"}}
+	require.NoError(t, state.save(stateFile))
+
+	handler := NewUpdateHandler().(*UpdateHandler)
+	handler.canaryPercent = 100
+	handler.canaryDelay = 86400
+
+	yesterday := time.Now().Add(-48 * time.Hour)
+	updates := []updatesAvailable{
+		{version: "v0.98", url: "https://localhost/v0.98"},
+		{version: "v0.99", url: "https://localhost/v0.99"},
+		{version: "v0.97", url: "https://localhost/v0.97", published: &yesterday},
+	}
+
+	filtered := handler.filterRollout(updates, stateFile)
+	require.Lenf(t, filtered, 2, "failed version is removed")
+	assert.Equalf(t, "v0.99", filtered[0].version, "new version is available")
+
+	// no host is part of the canary group
+	handler.canaryPercent = 0
+	filtered = handler.filterRollout(updates, stateFile)
+	require.Lenf(t, filtered, 1, "new version is delayed")
+	assert.Equalf(t, "v0.97", filtered[0].version, "version after canary delay is available")
+
+	handler.canaryDelay = 0
+	filtered = handler.filterRollout(updates, stateFile)
+	assert.Lenf(t, filtered, 2, "no canary delay")
+
+	state, err := readRolloutState(stateFile)
+	require.NoError(t, err)
+	assert.Containsf(t, state.FirstSeen, "v0.99 https://localhost/v0.99", "first seen time is stored in the state file")
+	assert.NotContainsf(t, state.FirstSeen, "v0.97 https://localhost/v0.97", "published versions are not stored")
+
+	// first seen time survives restarts
+	state.FirstSeen["v0.99 https://localhost/v0.99"] = time.Now().Add(-48 * time.Hour).Unix()
+	require.NoError(t, state.save(stateFile))
+
+	handler = NewUpdateHandler().(*UpdateHandler)
+	handler.canaryPercent = 0
+	handler.canaryDelay = 86400
+	filtered = handler.filterRollout(updates, stateFile)
+	assert.Lenf(t, filtered, 2, "canary delay is measured from stored first seen time")
+	bucket := hostCanaryBucket()
+	assert.Equalf(t, bucket, hostCanaryBucket(), "canary bucket is stable")
+	assert.Truef(t, bucket >= 0 && bucket < 100, "canary bucket is a percentage")
+}
+
+func TestUpdateHealthGate(t *testing.T) {
+	config := `
+[/modules]
+WEBServer = enabled
+
+[/settings/WEB/server]
+port = 0
+use ssl = false
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	ctx := context.Background()
+	handler := &UpdateHandler{snc: snc, ctx: &ctx, healthGateTimeout: 0.1}
+	require.NoErrorf(t, handler.healthCheck(ctx), "agent is healthy")
+
+	// failed listeners make the health gate fail and the version is never installed again
+	snc.Listeners.failed = append(snc.Listeners.failed, "NRPEServer")
+	err := handler.healthCheck(ctx)
+	require.Errorf(t, err, "failed listener is detected")
+	assert.Contains(t, err.Error(), "listener failed to start: NRPEServer")
+
+	stateFile := filepath.Join(t.TempDir(), "snclient.rollout.json")
+	state := &updateRolloutState{Pending: true, Version: "v0.99", Checksum: "abc", Starts: 1}
+	handler.runHealthGate(state, stateFile)
+
+	state, err = readRolloutState(stateFile)
+	require.NoError(t, err)
+	assert.Equalf(t, &updateRolloutState{
+		Pending:         false,
+		Version:         "v0.99",
+		Checksum:        "abc",
+		Failed:          []string{"v0.99"},
+		FailedChecksums: []string{"abc"},
+	}, state, "failed version is recorded")
+	assert.Truef(t, handler.failedBefore("abc", stateFile), "failed checksum is remembered")
+	assert.Falsef(t, handler.failedBefore("def", stateFile), "other checksums are not affected")
+}
+
+func TestUpdateHealthCheckStopListeners(t *testing.T) {
+	config := `
+[/modules]
+WEBServer = enabled
+
+[/settings/WEB/server]
+port = 0
+use ssl = false
+`
+	snc := StartTestAgent(t, config)
+	defer StopTestAgent(t, snc)
+
+	ctx := context.Background()
+	handler := &UpdateHandler{snc: snc, ctx: &ctx}
+
+	// listeners are removed on reload while the health gate is running
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = handler.healthCheck(ctx)
+		}
+	}()
+	snc.Listeners.StopRemove()
+	<-done
+
+	assert.Emptyf(t, snc.Listeners.Modules(), "listeners are removed")
+	assert.NoErrorf(t, handler.healthCheck(ctx), "health check without listeners")
+}
+
+func TestUpdateHealthGateStarts(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "snclient.rollout.json")
+
+	rollback, err := countPendingStart(stateFile, "v0.99")
+	require.NoErrorf(t, err, "missing state file is no error")
+	assert.Falsef(t, rollback, "nothing pending")
+
+	state := &updateRolloutState{Pending: true, Version: "v0.99", Checksum: "abc"}
+	require.NoError(t, state.save(stateFile))
+
+	rollback, err = countPendingStart(stateFile, "v0.98")
+	require.NoError(t, err)
+	assert.Falsef(t, rollback, "other version is not affected")
+
+	rollback, err = countPendingStart(stateFile, "v0.99")
+	require.NoError(t, err)
+	assert.Falsef(t, rollback, "first start waits for the health gate")
+
+	// the version crashed before passing the health gate and got restarted
+	rollback, err = countPendingStart(stateFile, "v0.99")
+	require.NoError(t, err)
+	assert.Truef(t, rollback, "second start rolls back")
+
+	state, err = readRolloutState(stateFile)
+	require.NoError(t, err)
+	assert.Equalf(t, &updateRolloutState{
+		Version:         "v0.99",
+		Checksum:        "abc",
+		Failed:          []string{"v0.99"},
+		FailedChecksums: []string{"abc"},
+	}, state, "failed version is recorded")
+
+	rollback, err = countPendingStart(stateFile, "v0.99")
+	require.NoError(t, err)
+	assert.Falsef(t, rollback, "no further rollbacks")
+}
@@ -0,0 +1,298 @@
+package snclient
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// UpdateSignatureSuffix is appended to the update url to fetch the detached signature
+	UpdateSignatureSuffix = ".minisig"
+
+	// maximum size of signature and manifest files
+	updateSignatureMaxSize = 1e6
+)
+
+// UpdateVerifier verifies detached minisign (ed25519) signatures of update files.
+type UpdateVerifier struct {
+	keys []*minisignPublicKey
+}
+
+type minisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+type minisignSignature struct {
+	algorithm      string // Ed: pure ed25519, ED: blake2b prehashed
+	keyID          [8]byte
+	signature      []byte
+	trustedComment string
+	globalSig      []byte
+}
+
+// NewUpdateVerifier creates a verifier from a comma separated list of minisign public keys or public key files.
+func NewUpdateVerifier(publicKeys string) (*UpdateVerifier, error) {
+	verifier := &UpdateVerifier{}
+	for _, def := range strings.Split(publicKeys, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+
+		// public key files contain an untrusted comment and the key
+		if keyFile, err := os.ReadFile(def); err == nil {
+			def = lastNonCommentLine(string(keyFile))
+		}
+
+		key, err := parseMinisignPublicKey(def)
+		if err != nil {
+			return nil, err
+		}
+		verifier.keys = append(verifier.keys, key)
+	}
+
+	return verifier, nil
+}
+
+// Enabled returns true if at least one public key is configured.
+func (v *UpdateVerifier) Enabled() bool {
+	return v != nil && len(v.keys) > 0
+}
+
+// VerifyFile checks the detached minisign signature of given file.
+func (v *UpdateVerifier) VerifyFile(fileName string, signature []byte) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("open: %s", err.Error())
+	}
+	defer file.Close()
+
+	return v.Verify(file, signature)
+}
+
+// Verify checks the detached minisign signature of the data from given reader.
+func (v *UpdateVerifier) Verify(reader io.Reader, signature []byte) error {
+	if !v.Enabled() {
+		return fmt.Errorf("no public key configured")
+	}
+
+	sig, err := parseMinisignSignature(signature)
+	if err != nil {
+		return err
+	}
+
+	var pubKey *minisignPublicKey
+	for _, key := range v.keys {
+		if key.keyID == sig.keyID {
+			pubKey = key
+
+			break
+		}
+	}
+	if pubKey == nil {
+		return fmt.Errorf("signature was created with unknown key id %X", reverseKeyID(sig.keyID))
+	}
+
+	var message []byte
+	switch sig.algorithm {
+	case "ED":
+		hash, _ := blake2b.New512(nil)
+		if _, err = io.Copy(hash, reader); err != nil {
+			return fmt.Errorf("read: %s", err.Error())
+		}
+		message = hash.Sum(nil)
+	default:
+		message, err = io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("read: %s", err.Error())
+		}
+	}
+
+	if !ed25519.Verify(pubKey.key, message, sig.signature) {
+		return fmt.Errorf("signature verification failed")
+	}
+
+	// the global signature covers the trusted comment
+	globalMessage := make([]byte, 0, len(sig.signature)+len(sig.trustedComment))
+	globalMessage = append(globalMessage, sig.signature...)
+	globalMessage = append(globalMessage, sig.trustedComment...)
+	if !ed25519.Verify(pubKey.key, globalMessage, sig.globalSig) {
+		return fmt.Errorf("trusted comment signature verification failed")
+	}
+
+	log.Debugf("[update] signature verified, key id %X, %s", reverseKeyID(sig.keyID), sig.trustedComment)
+
+	return nil
+}
+
+// parseMinisignPublicKey parses a base64 encoded public key: 2 bytes algorithm, 8 bytes key id, 32 bytes key
+func parseMinisignPublicKey(str string) (*minisignPublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, fmt.Errorf("public key: %s", err.Error())
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[0:2]) != "Ed" {
+		return nil, fmt.Errorf("public key: unsupported key format, expected minisign ed25519 public key")
+	}
+
+	key := &minisignPublicKey{
+		key: ed25519.PublicKey(raw[10:]),
+	}
+	copy(key.keyID[:], raw[2:10])
+
+	return key, nil
+}
+
+// parseMinisignSignature parses a minisign signature file which has 4 lines:
+//
+//	untrusted comment: <comment>
+//	<base64: 2 bytes algorithm, 8 bytes key id, 64 bytes signature>
+//	trusted comment: <comment>
+//	<base64: 64 bytes signature of signature and trusted comment>
+func parseMinisignSignature(data []byte) (*minisignSignature, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// keep trailing spaces, they are part of the signed trusted comment
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("signature: expected 4 lines, got %d", len(lines))
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("signature: %s", err.Error())
+	}
+	if len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("signature: invalid length %d", len(raw))
+	}
+
+	sig := &minisignSignature{
+		algorithm: string(raw[0:2]),
+		signature: raw[10:],
+	}
+	copy(sig.keyID[:], raw[2:10])
+	if sig.algorithm != "Ed" && sig.algorithm != "ED" {
+		return nil, fmt.Errorf("signature: unsupported algorithm %s", sig.algorithm)
+	}
+
+	trusted, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return nil, fmt.Errorf("signature: missing trusted comment")
+	}
+	sig.trustedComment = trusted
+
+	sig.globalSig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return nil, fmt.Errorf("signature: %s", err.Error())
+	}
+	if len(sig.globalSig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("signature: invalid global signature length %d", len(sig.globalSig))
+	}
+
+	return sig, nil
+}
+
+// parseSha256Manifest returns the checksum for given file name from a sha256sum style manifest.
+// A manifest with a single checksum and no file name matches any file.
+func parseSha256Manifest(manifest []byte, fileName string) (string, error) {
+	fileName = baseName(fileName)
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		sum := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+			return "", fmt.Errorf("manifest: invalid sha256 checksum: %s", fields[0])
+		}
+
+		if len(fields) == 1 {
+			return sum, nil
+		}
+
+		// binary mode marks the file name with a leading asterisk
+		name := baseName(strings.TrimPrefix(fields[1], "*"))
+		if name == fileName {
+			return sum, nil
+		}
+	}
+
+	return "", fmt.Errorf("manifest: no checksum found for %s", fileName)
+}
+
+// verifySha256 compares the sha256 checksum of given file
+func verifySha256(fileName, expected string) error {
+	sum, err := fileSha256(fileName)
+	if err != nil {
+		return err
+	}
+
+	if sum != expected {
+		return fmt.Errorf("sha256 checksum mismatch, expected %s, got %s", expected, sum)
+	}
+
+	return nil
+}
+
+// fileSha256 returns the hex encoded sha256 checksum of given file
+func fileSha256(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", fmt.Errorf("open: %s", err.Error())
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("read: %s", err.Error())
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// baseName returns the last element of a path or url with slashes or backslashes
+func baseName(name string) string {
+	return name[strings.LastIndexAny(name, "/\\")+1:]
+}
+
+// lastNonCommentLine returns the last line which is not empty and not a comment
+func lastNonCommentLine(str string) string {
+	last := ""
+	for _, line := range strings.Split(str, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		last = line
+	}
+
+	return last
+}
+
+// reverseKeyID returns the key id in the same byte order as minisign prints it
+func reverseKeyID(keyID [8]byte) []byte {
+	reversed := make([]byte, len(keyID))
+	for i := range keyID {
+		reversed[len(keyID)-1-i] = keyID[i]
+	}
+
+	return reversed
+}
@@ -0,0 +1,190 @@
+package snclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+type testMinisignKey struct {
+	keyID   []byte
+	private ed25519.PrivateKey
+	public  string
+}
+
+func newTestMinisignKey(t *testing.T, keyID string) *testMinisignKey {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key := &testMinisignKey{keyID: []byte(keyID), private: priv}
+	raw := append([]byte("Ed"), key.keyID...)
+	raw = append(raw, pub...)
+	key.public = base64.StdEncoding.EncodeToString(raw)
+
+	return key
+}
+
+// sign creates a minisign signature file, algorithm is either Ed (legacy) or ED (prehashed)
+func (k *testMinisignKey) sign(data []byte, algorithm, trustedComment string) []byte {
+	message := data
+	if algorithm == "ED" {
+		hash := blake2b.Sum512(data)
+		message = hash[:]
+	}
+	sig := ed25519.Sign(k.private, message)
+	globalSig := ed25519.Sign(k.private, append(append([]byte{}, sig...), []byte(trustedComment)...))
+
+	raw := append([]byte(algorithm), k.keyID...)
+	raw = append(raw, sig...)
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig),
+	))
+}
+
+func TestUpdateVerifier(t *testing.T) {
+	key := newTestMinisignKey(t, "12345678")
+	otherKey := newTestMinisignKey(t, "87654321")
+	data := []byte("snclient binary")
+
+	verifier, err := NewUpdateVerifier(key.public)
+	require.NoError(t, err)
+	assert.Truef(t, verifier.Enabled(), "verifier is enabled")
+
+	for _, algorithm := range []string{"ED", "Ed"} {
+		signature := key.sign(data, algorithm, "timestamp:1700000000\tfile:snclient")
+		require.NoErrorf(t, verifier.Verify(bytes.NewReader(data), signature), "valid %s signature", algorithm)
+
+		err = verifier.Verify(bytes.NewReader([]byte("tampered binary")), signature)
+		require.Errorf(t, err, "tampered data is refused")
+		assert.Contains(t, err.Error(), "signature verification failed")
+	}
+
+	signature := key.sign(data, "ED", "file:snclient")
+	tampered := bytes.Replace(signature, []byte("file:snclient"), []byte("file:other"), 1)
+	err = verifier.Verify(bytes.NewReader(data), tampered)
+	require.Errorf(t, err, "tampered trusted comment is refused")
+	assert.Contains(t, err.Error(), "trusted comment signature verification failed")
+
+	err = verifier.Verify(bytes.NewReader(data), otherKey.sign(data, "ED", "file:snclient"))
+	require.Errorf(t, err, "unknown key is refused")
+	assert.Contains(t, err.Error(), "unknown key id")
+
+	require.Errorf(t, verifier.Verify(bytes.NewReader(data), []byte("garbage")), "invalid signature is refused")
+
+	// multiple keys and public key files
+	keyFile := filepath.Join(t.TempDir(), "minisign.pub")
+	require.NoError(t, os.WriteFile(keyFile, []byte("untrusted comment: minisign public key 3837363534333231\n"+otherKey.public+"\n"), 0o600))
+	verifier, err = NewUpdateVerifier(key.public + ", " + keyFile)
+	require.NoError(t, err)
+	require.NoErrorf(t, verifier.Verify(bytes.NewReader(data), otherKey.sign(data, "ED", "")), "key from file is used")
+
+	_, err = NewUpdateVerifier("RWQinvalid")
+	require.Errorf(t, err, "invalid public key")
+
+	verifier, err = NewUpdateVerifier("")
+	require.NoError(t, err)
+	assert.Falsef(t, verifier.Enabled(), "verifier is disabled without keys")
+}
+
+func TestUpdateSha256Manifest(t *testing.T) {
+	sum1 := hex.EncodeToString(bytes.Repeat([]byte{1}, sha256.Size))
+	sum2 := hex.EncodeToString(bytes.Repeat([]byte{2}, sha256.Size))
+	manifest := []byte(sum1 + "  snclient-linux-amd64\n" + sum2 + " *snclient-windows-amd64.exe\n")
+
+	sum, err := parseSha256Manifest(manifest, "https://company-server.local/snclient/snclient-windows-amd64.exe")
+	require.NoError(t, err)
+	assert.Equalf(t, sum2, sum, "binary mode entry found")
+
+	sum, err = parseSha256Manifest(manifest, `file://z:\updates\snclient-linux-amd64`)
+	require.NoError(t, err)
+	assert.Equalf(t, sum1, sum, "windows path entry found")
+
+	_, err = parseSha256Manifest(manifest, "snclient-darwin-arm64")
+	require.Errorf(t, err, "missing entry")
+
+	sum, err = parseSha256Manifest([]byte(sum1+"\n"), "anything")
+	require.NoError(t, err)
+	assert.Equalf(t, sum1, sum, "single checksum matches any file")
+
+	_, err = parseSha256Manifest([]byte("abc  snclient\n"), "snclient")
+	require.Errorf(t, err, "invalid checksum")
+}
+
+func TestUpdateVerifyDownload(t *testing.T) {
+	key := newTestMinisignKey(t, "12345678")
+	tempDir := t.TempDir()
+	data := []byte("snclient binary")
+	updateFile := filepath.Join(tempDir, "snclient-linux-amd64")
+	require.NoError(t, os.WriteFile(updateFile, data, 0o600))
+
+	ctx := context.Background()
+	handler := &UpdateHandler{ctx: &ctx}
+	update := &updatesAvailable{url: "file://" + updateFile}
+
+	require.NoErrorf(t, handler.verifyDownload(update, updateFile), "no verification without public key")
+
+	verifier, err := NewUpdateVerifier(key.public)
+	require.NoError(t, err)
+	handler.verifier = verifier
+
+	err = handler.verifyDownload(update, updateFile)
+	require.Errorf(t, err, "unsigned update is refused")
+	assert.Contains(t, err.Error(), "update is not signed")
+
+	require.NoError(t, os.WriteFile(updateFile+UpdateSignatureSuffix, key.sign(data, "ED", "file:snclient-linux-amd64"), 0o600))
+	require.NoErrorf(t, handler.verifyDownload(update, updateFile), "signed update is accepted")
+
+	require.NoError(t, os.WriteFile(updateFile, []byte("tampered binary"), 0o600))
+	require.Errorf(t, handler.verifyDownload(update, updateFile), "tampered update is refused")
+
+	// sha256 manifest
+	hash := sha256.Sum256(data)
+	manifestFile := filepath.Join(tempDir, "SHA256SUMS")
+	manifest := []byte(hex.EncodeToString(hash[:]) + "  snclient-linux-amd64\n")
+	require.NoError(t, os.WriteFile(manifestFile, manifest, 0o600))
+	update.manifest = "file://" + manifestFile
+
+	err = handler.verifyDownload(update, updateFile)
+	require.Errorf(t, err, "unsigned manifest is refused")
+	assert.Contains(t, err.Error(), "sha256 manifest is not signed")
+
+	require.NoError(t, os.WriteFile(manifestFile+UpdateSignatureSuffix, key.sign(manifest, "ED", "file:SHA256SUMS"), 0o600))
+	err = handler.verifyDownload(update, updateFile)
+	require.Errorf(t, err, "checksum mismatch is refused")
+	assert.Contains(t, err.Error(), "sha256 checksum mismatch")
+
+	require.NoError(t, os.WriteFile(updateFile, data, 0o600))
+	require.NoErrorf(t, handler.verifyDownload(update, updateFile), "checksum matches")
+
+	handler.verifier = nil
+	require.NoErrorf(t, handler.verifyDownload(update, updateFile), "manifest is checked without public key")
+}
+
+func TestUpdateGithubActionsSigned(t *testing.T) {
+	key := newTestMinisignKey(t, "12345678")
+	verifier, err := NewUpdateVerifier(key.public)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	handler := &UpdateHandler{ctx: &ctx, verifier: verifier}
+	_, err = handler.checkUpdateGithubActions("https://api.github.com/repos/ConSol-Monitoring/snclient/actions/artifacts", "dev")
+	require.Errorf(t, err, "github actions are refused with public key")
+	assert.Containsf(t, err.Error(), "not supported with a public key", "error message")
+}